@@ -0,0 +1,253 @@
+// Lokale HTTP/JSON Schnittstelle um eine laufende Node abzufragen und zu
+// steuern. Es gibt keine Authentifizierung, der Server darf deshalb nur auf
+// einer Loopback Adresse lauschen. ite prüft das beim Laden der Config.
+package admin
+
+import (
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rrawrriw/ite/dictator"
+)
+
+type (
+	// Die zuletzt per DHCP erhaltene Adresse
+	Lease struct {
+		IP       net.IP
+		Received time.Time
+		// 0 wenn der Server keine Lease Time gesendet hat
+		Duration time.Duration
+	}
+
+	// Gibt false zurück solange es keine Lease gibt
+	LeaseFunc func() (Lease, bool)
+
+	LeaseResponse struct {
+		IP               string    `json:"ip"`
+		Received         time.Time `json:"received"`
+		DurationSeconds  float64   `json:"duration_seconds"`
+		RemainingSeconds float64   `json:"remaining_seconds"`
+	}
+
+	Status struct {
+		ID       string `json:"id"`
+		Name     string `json:"name,omitempty"`
+		Role     string `json:"role"`
+		Term     int    `json:"term"`
+		Dictator string `json:"dictator"`
+	}
+
+	Member struct {
+		ID       string    `json:"id"`
+		Name     string    `json:"name,omitempty"`
+		LastSeen time.Time `json:"last_seen"`
+		Dictator bool      `json:"dictator"`
+	}
+
+	Command struct {
+		ID        string    `json:"id"`
+		Name      string    `json:"name"`
+		Target    string    `json:"target,omitempty"`
+		Sent      time.Time `json:"sent"`
+		Responses int       `json:"responses"`
+		TraceID   string    `json:"trace_id,omitempty"`
+		// Nur bei GET /commands/{id} gesetzt
+		Results []Result `json:"results,omitempty"`
+	}
+
+	// Die Antwort einer Node auf einen Befehl
+	Result struct {
+		NodeID     string      `json:"node_id"`
+		NodeName   string      `json:"node_name,omitempty"`
+		Status     int         `json:"status"`
+		StatusText string      `json:"status_text"`
+		Result     interface{} `json:"result,omitempty"`
+		Error      string      `json:"error,omitempty"`
+		Received   time.Time   `json:"received"`
+	}
+
+	// Body von POST /commands. Ohne Target geht der Befehl an alle Nodes.
+	CommandRequest struct {
+		Name   string          `json:"name"`
+		Value  json.RawMessage `json:"value,omitempty"`
+		Target string          `json:"target,omitempty"`
+	}
+
+	CommandResponse struct {
+		ID string `json:"id"`
+	}
+
+	ErrorResponse struct {
+		Error string `json:"error"`
+	}
+)
+
+// Erzeugt den Handler für node. lease darf nil sein.
+func NewHandler(node *dictator.Handle, lease LeaseFunc) http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /status", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, Status{
+			ID:       node.NodeID(),
+			Name:     node.Name(),
+			Role:     node.State().String(),
+			Term:     node.Term(),
+			Dictator: node.CurrentDictator(),
+		})
+	})
+
+	mux.HandleFunc("GET /members", func(w http.ResponseWriter, r *http.Request) {
+		members := []Member{}
+		for _, m := range node.Members() {
+			members = append(members, Member{
+				ID:       m.ID,
+				Name:     m.Name,
+				LastSeen: m.LastSeen,
+				Dictator: m.Dictator,
+			})
+		}
+		writeJSON(w, http.StatusOK, members)
+	})
+
+	mux.HandleFunc("GET /commands", func(w http.ResponseWriter, r *http.Request) {
+		inFlight, err := node.InFlight()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+
+		cmds := []Command{}
+		for _, c := range inFlight {
+			cmds = append(cmds, newCommand(c))
+		}
+		writeJSON(w, http.StatusOK, cmds)
+	})
+
+	mux.HandleFunc("GET /commands/{id}", func(w http.ResponseWriter, r *http.Request) {
+		c, ok, err := node.Command(r.PathValue("id"))
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		if !ok {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{"Unknown command"})
+			return
+		}
+
+		cmd := newCommand(c)
+		cmd.Results = []Result{}
+		for _, r := range c.Results {
+			cmd.Results = append(cmd.Results, Result{
+				NodeID:     r.NodeID,
+				NodeName:   r.NodeName,
+				Status:     r.Status,
+				StatusText: dictator.StatusText(r.Status),
+				Result:     r.Result,
+				Error:      r.Error,
+				Received:   r.Received,
+			})
+		}
+		writeJSON(w, http.StatusOK, cmd)
+	})
+
+	mux.HandleFunc("POST /commands", func(w http.ResponseWriter, r *http.Request) {
+		req := CommandRequest{}
+		err := json.NewDecoder(r.Body).Decode(&req)
+		if err != nil || req.Name == "" {
+			writeJSON(w, http.StatusBadRequest, ErrorResponse{"Expect a JSON body with a command name"})
+			return
+		}
+
+		var value interface{}
+		if len(req.Value) > 0 {
+			err = json.Unmarshal(req.Value, &value)
+			if err != nil {
+				writeJSON(w, http.StatusBadRequest, ErrorResponse{err.Error()})
+				return
+			}
+		}
+
+		id, err := node.SendTo(req.Target, req.Name, value)
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		writeJSON(w, http.StatusAccepted, CommandResponse{ID: id})
+	})
+
+	mux.HandleFunc("GET /lease", func(w http.ResponseWriter, r *http.Request) {
+		if lease == nil {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{"No lease"})
+			return
+		}
+
+		l, ok := lease()
+		if !ok {
+			writeJSON(w, http.StatusNotFound, ErrorResponse{"No lease"})
+			return
+		}
+
+		remaining := time.Until(l.Received.Add(l.Duration))
+		if remaining < 0 {
+			remaining = 0
+		}
+		writeJSON(w, http.StatusOK, LeaseResponse{
+			IP:               l.IP.String(),
+			Received:         l.Received,
+			DurationSeconds:  l.Duration.Seconds(),
+			RemainingSeconds: remaining.Seconds(),
+		})
+	})
+
+	mux.HandleFunc("POST /stepdown", func(w http.ResponseWriter, r *http.Request) {
+		err := node.StepDown()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	mux.HandleFunc("POST /election", func(w http.ResponseWriter, r *http.Request) {
+		err := node.Elect()
+		if err != nil {
+			writeError(w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	})
+
+	return mux
+}
+
+func newCommand(c dictator.InFlightCommand) Command {
+	return Command{
+		ID:        c.ID,
+		Name:      c.Name,
+		Target:    c.Target,
+		Sent:      c.Sent,
+		Responses: c.Responses,
+		TraceID:   c.Trace.TraceID,
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, dictator.NotDictatorError), errors.Is(err, dictator.IneligibleError):
+		status = http.StatusConflict
+	case errors.Is(err, dictator.NodeStoppedError):
+		status = http.StatusServiceUnavailable
+	}
+
+	writeJSON(w, status, ErrorResponse{err.Error()})
+}
@@ -0,0 +1,174 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/rrawrriw/ite/dictator"
+)
+
+func makeTestServer(t *testing.T, lease LeaseFunc) (*httptest.Server, *dictator.Handle, dictator.Context) {
+	ctx := dictator.NewContext()
+
+	udpOut := make(chan dictator.UDPPacket)
+	go func() {
+		for range udpOut {
+		}
+	}()
+
+	specs := dictator.MissionSpecs{
+		Mission:  func(dictator.NodeContext) {},
+		Identity: dictator.Identity{Name: "test"},
+	}
+	node, err := dictator.Node(ctx, make(chan dictator.UDPPacket), udpOut, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return httptest.NewServer(NewHandler(node, lease)), node, ctx
+}
+
+func Test_Status(t *testing.T) {
+	srv, node, ctx := makeTestServer(t, nil)
+	defer ctx.Done()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/status")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	status := Status{}
+	err = json.NewDecoder(resp.Body).Decode(&status)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if status.ID != node.NodeID() || status.Name != "test" || status.Role != dictator.StateCandidate.String() {
+		t.Fatal("Expect candidate", node.NodeID(), "was", status)
+	}
+}
+
+func Test_Commands(t *testing.T) {
+	srv, node, ctx := makeTestServer(t, nil)
+	defer ctx.Done()
+	defer srv.Close()
+
+	body := []byte(`{"name": "test", "value": {"ip": "192.168.1.2"}}`)
+
+	resp, err := http.Post(srv.URL+"/commands", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusConflict {
+		t.Fatal("Expect", http.StatusConflict, "was", resp.StatusCode)
+	}
+
+	c := node.Subscribe()
+	resp, err = http.Post(srv.URL+"/election", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal("Expect", http.StatusNoContent, "was", resp.StatusCode)
+	}
+	for tr := range c {
+		if tr.To == dictator.StateDictator {
+			break
+		}
+	}
+
+	resp, err = http.Post(srv.URL+"/commands", "application/json", bytes.NewReader(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd := CommandResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&cmd)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.StatusCode != http.StatusAccepted || cmd.ID == "" {
+		t.Fatal("Expect an accepted command was", resp.StatusCode, cmd)
+	}
+
+	resp, err = http.Get(srv.URL + "/commands")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmds := []Command{}
+	err = json.NewDecoder(resp.Body).Decode(&cmds)
+	resp.Body.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].ID != cmd.ID || cmds[0].TraceID == "" {
+		t.Fatal("Expect command", cmd.ID, "in flight was", cmds)
+	}
+
+	resp, err = http.Post(srv.URL+"/stepdown", "", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusNoContent {
+		t.Fatal("Expect", http.StatusNoContent, "was", resp.StatusCode)
+	}
+	if node.State() == dictator.StateDictator {
+		t.Fatal("Expect node to step down")
+	}
+}
+
+func Test_Lease(t *testing.T) {
+	received := time.Now()
+	lease := func() (Lease, bool) {
+		return Lease{
+			IP:       net.ParseIP("192.168.1.2"),
+			Received: received,
+			Duration: time.Hour,
+		}, true
+	}
+	srv, _, ctx := makeTestServer(t, lease)
+	defer ctx.Done()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	l := LeaseResponse{}
+	err = json.NewDecoder(resp.Body).Decode(&l)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if l.IP != "192.168.1.2" || l.DurationSeconds != 3600 || l.RemainingSeconds > 3600 || l.RemainingSeconds < 3500 {
+		t.Fatal("Expect a lease of 192.168.1.2 for an hour was", l)
+	}
+}
+
+func Test_NoLease(t *testing.T) {
+	srv, _, ctx := makeTestServer(t, nil)
+	defer ctx.Done()
+	defer srv.Close()
+
+	resp, err := http.Get(srv.URL + "/lease")
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+
+	if resp.StatusCode != http.StatusNotFound {
+		t.Fatal("Expect", http.StatusNotFound, "was", resp.StatusCode)
+	}
+}
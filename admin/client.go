@@ -0,0 +1,121 @@
+package admin
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+// Spricht mit der Admin API einer Node
+type Client struct {
+	// z.B. http://127.0.0.1:7070
+	BaseURL string
+	HTTP    *http.Client
+}
+
+func NewClient(addr string) Client {
+	return Client{
+		BaseURL: "http://" + addr,
+		HTTP: &http.Client{
+			Timeout: 10 * time.Second,
+		},
+	}
+}
+
+func (c Client) Status() (Status, error) {
+	s := Status{}
+	err := c.do(http.MethodGet, "/status", nil, &s)
+	return s, err
+}
+
+func (c Client) Members() ([]Member, error) {
+	m := []Member{}
+	err := c.do(http.MethodGet, "/members", nil, &m)
+	return m, err
+}
+
+func (c Client) Commands() ([]Command, error) {
+	cmds := []Command{}
+	err := c.do(http.MethodGet, "/commands", nil, &cmds)
+	return cmds, err
+}
+
+func (c Client) Command(id string) (Command, error) {
+	cmd := Command{}
+	err := c.do(http.MethodGet, "/commands/"+url.PathEscape(id), nil, &cmd)
+	return cmd, err
+}
+
+// Sendet einen Befehl über den Diktator und gibt dessen ID zurück. Ist
+// target leer geht der Befehl an alle Nodes.
+func (c Client) Send(target, name string, value json.RawMessage) (string, error) {
+	resp := CommandResponse{}
+	err := c.do(http.MethodPost, "/commands", CommandRequest{
+		Name:   name,
+		Value:  value,
+		Target: target,
+	}, &resp)
+	return resp.ID, err
+}
+
+func (c Client) Lease() (LeaseResponse, error) {
+	l := LeaseResponse{}
+	err := c.do(http.MethodGet, "/lease", nil, &l)
+	return l, err
+}
+
+func (c Client) StepDown() error {
+	return c.do(http.MethodPost, "/stepdown", nil, nil)
+}
+
+func (c Client) Elect() error {
+	return c.do(http.MethodPost, "/election", nil, nil)
+}
+
+func (c Client) do(method, path string, body, v interface{}) error {
+	var r io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		r = bytes.NewReader(b)
+	}
+
+	req, err := http.NewRequest(method, c.BaseURL+path, r)
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	httpClient := c.HTTP
+	if httpClient == nil {
+		httpClient = http.DefaultClient
+	}
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		e := ErrorResponse{}
+		err = json.NewDecoder(resp.Body).Decode(&e)
+		if err != nil || e.Error == "" {
+			return fmt.Errorf("%v %v: %v", method, path, resp.Status)
+		}
+		return fmt.Errorf("%v %v: %v", method, path, e.Error)
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return json.NewDecoder(resp.Body).Decode(v)
+}
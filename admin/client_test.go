@@ -0,0 +1,78 @@
+package admin
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/rrawrriw/ite/dictator"
+)
+
+func Test_Client(t *testing.T) {
+	srv, node, ctx := makeTestServer(t, nil)
+	defer ctx.Done()
+	defer srv.Close()
+
+	c := Client{BaseURL: srv.URL}
+
+	s, err := c.Status()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.ID != node.NodeID() {
+		t.Fatal("Expect", node.NodeID(), "was", s.ID)
+	}
+
+	_, err = c.Send("", "test", nil)
+	if err == nil || !strings.Contains(err.Error(), dictator.NotDictatorError.Error()) {
+		t.Fatal("Expect", dictator.NotDictatorError, "was", err)
+	}
+
+	_, err = c.Lease()
+	if err == nil {
+		t.Fatal("Expect an error without lease")
+	}
+
+	sub := node.Subscribe()
+	err = c.Elect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for tr := range sub {
+		if tr.To == dictator.StateDictator {
+			break
+		}
+	}
+
+	id, err := c.Send("2", "test", json.RawMessage(`{"ip": "192.168.1.2"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmd, err := c.Command(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmd.ID != id || cmd.Target != "2" || len(cmd.Results) != 0 {
+		t.Fatal("Expect command", id, "for node 2 without results was", cmd)
+	}
+
+	_, err = c.Command("unknown")
+	if err == nil {
+		t.Fatal("Expect an error for an unknown command")
+	}
+
+	err = c.StepDown()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx.Done()
+	// Wird geschlossen sobald die Node beendet ist
+	for range sub {
+	}
+	_, err = c.Commands()
+	if err == nil {
+		t.Fatal("Expect an error after the node stopped")
+	}
+}
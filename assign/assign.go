@@ -0,0 +1,90 @@
+// Der Diktator vergibt mit dem Befehl AssignIP die Adressen der Followers.
+// Ohne Adresse fragt der Befehl nur die aktuelle Adresse der Nodes ab,
+// mit Adresse geht er gezielt an eine Node welche diese setzt und mit
+// ihrer neuen Adresse antwortet.
+package assign
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Name des Befehls
+const Command = "AssignIP"
+
+var InvalidAssignmentError = errors.New("Invalid assignment")
+
+type (
+	// Wert des Befehls AssignIP
+	Assignment struct {
+		Address string `bson:",omitempty"`
+		// Länge des Präfixes, z.B. 24
+		Prefix  int      `bson:",omitempty"`
+		Gateway string   `bson:",omitempty"`
+		DNS     []string `bson:",omitempty"`
+	}
+
+	// Antwort auf AssignIP, leer solange die Node keine Adresse hat
+	Result struct {
+		Address string `bson:",omitempty"`
+	}
+)
+
+// Ohne Adresse fragt der Diktator nur nach der aktuellen Adresse
+func (a Assignment) IsQuery() bool {
+	return a.Address == ""
+}
+
+func (a Assignment) Validate() error {
+	ip := net.ParseIP(a.Address).To4()
+	if ip == nil {
+		return fmt.Errorf("%w: %q is not an IPv4 address", InvalidAssignmentError, a.Address)
+	}
+	if a.Prefix < 1 || a.Prefix > 32 {
+		return fmt.Errorf("%w: prefix must be between 1 and 32, was %v", InvalidAssignmentError, a.Prefix)
+	}
+
+	network := a.Network()
+	if a.Gateway != "" {
+		gw := net.ParseIP(a.Gateway).To4()
+		if gw == nil || !network.Contains(gw) || gw.Equal(ip) {
+			return fmt.Errorf("%w: gateway %q is not another address in %v", InvalidAssignmentError, a.Gateway, network)
+		}
+	}
+	for _, dns := range a.DNS {
+		if net.ParseIP(dns) == nil {
+			return fmt.Errorf("%w: DNS server %q is not an IP address", InvalidAssignmentError, dns)
+		}
+	}
+
+	return nil
+}
+
+// Das Netz der Adresse, z.B. 10.0.0.0/24
+func (a Assignment) Network() *net.IPNet {
+	mask := net.CIDRMask(a.Prefix, 32)
+
+	return &net.IPNet{
+		IP:   net.ParseIP(a.Address).To4().Mask(mask),
+		Mask: mask,
+	}
+}
+
+// Die Adresse mit Präfix, z.B. 10.0.0.5/24
+func (a Assignment) CIDR() string {
+	return fmt.Sprintf("%v/%v", a.Address, a.Prefix)
+}
+
+func (a Assignment) String() string {
+	s := a.CIDR()
+	if a.Gateway != "" {
+		s = s + " via " + a.Gateway
+	}
+	if len(a.DNS) > 0 {
+		s = s + " dns " + strings.Join(a.DNS, ",")
+	}
+
+	return s
+}
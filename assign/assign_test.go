@@ -0,0 +1,49 @@
+package assign
+
+import (
+	"errors"
+	"testing"
+)
+
+func Test_Assignment_Validate(t *testing.T) {
+	valid := Assignment{
+		Address: "10.0.0.5",
+		Prefix:  24,
+		Gateway: "10.0.0.1",
+		DNS:     []string{"10.0.0.1", "2001:db8::1"},
+	}
+	err := valid.Validate()
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if valid.String() != "10.0.0.5/24 via 10.0.0.1 dns 10.0.0.1,2001:db8::1" {
+		t.Fatal("Expect 10.0.0.5/24 via 10.0.0.1 dns 10.0.0.1,2001:db8::1 was", valid.String())
+	}
+	if valid.Network().String() != "10.0.0.0/24" {
+		t.Fatal("Expect 10.0.0.0/24 was", valid.Network())
+	}
+
+	invalid := []Assignment{
+		{},
+		{Address: "10.0.0.5"},
+		{Address: "2001:db8::5", Prefix: 64},
+		{Address: "10.0.0.5", Prefix: 24, Gateway: "10.0.1.1"},
+		{Address: "10.0.0.5", Prefix: 24, Gateway: "10.0.0.5"},
+		{Address: "10.0.0.5", Prefix: 24, DNS: []string{"dns"}},
+	}
+	for _, a := range invalid {
+		err := a.Validate()
+		if !errors.Is(err, InvalidAssignmentError) {
+			t.Fatal("Expect", InvalidAssignmentError, "for", a, "was", err)
+		}
+	}
+}
+
+func Test_Assignment_IsQuery(t *testing.T) {
+	if !(Assignment{}).IsQuery() {
+		t.Fatal("Expect an empty assignment to be a query")
+	}
+	if (Assignment{Address: "10.0.0.5", Prefix: 24}).IsQuery() {
+		t.Fatal("Expect an assignment with address not to be a query")
+	}
+}
@@ -0,0 +1,267 @@
+package assign
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"sync"
+	"time"
+)
+
+const (
+	// Die Node hat die Adresse erhalten aber noch nicht bestätigt
+	StateOffered = iota + 1
+	// Die Node hat die Adresse gesetzt
+	StateConfirmed
+)
+
+var (
+	NoFreeAddressError = errors.New("No free address in pool")
+	UnknownHolderError = errors.New("Unknown holder")
+)
+
+type (
+	// Eine Node und ihre Adresse
+	Holder struct {
+		NodeID     string
+		Assignment Assignment
+		State      int
+		// Zeitpunkt des letzten Angebots oder der Bestätigung
+		Since time.Time
+		// Zeitpunkt zu dem sich die Node zuletzt gemeldet hat, siehe
+		// Expire
+		Seen time.Time
+	}
+
+	// Die Adressen welche der Diktator vergibt und wer welche hält.
+	// Netz- und Broadcast Adresse, das Gateway und reservierte Adressen
+	// werden nicht vergeben.
+	Pool struct {
+		mutex    *sync.Mutex
+		network  *net.IPNet
+		gateway  string
+		dns      []string
+		reserved map[string]bool
+		holders  map[string]Holder
+	}
+)
+
+// Ein Pool für das Netz cidr, z.B. 10.0.0.0/24. gateway und dns sind
+// optional und werden mit jeder Adresse verschickt.
+func NewPool(cidr, gateway string, dns []string) (*Pool, error) {
+	_, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return nil, err
+	}
+	ones, bits := network.Mask.Size()
+	if bits != 32 || ones > 30 {
+		return nil, fmt.Errorf("%v: must be an IPv4 network with at most 30 prefix bits", cidr)
+	}
+
+	p := &Pool{
+		mutex:    &sync.Mutex{},
+		network:  network,
+		gateway:  gateway,
+		dns:      dns,
+		reserved: map[string]bool{},
+		holders:  map[string]Holder{},
+	}
+	if gateway != "" {
+		gw := net.ParseIP(gateway).To4()
+		if gw == nil || !network.Contains(gw) {
+			return nil, fmt.Errorf("%w: gateway %q is not in %v", InvalidAssignmentError, gateway, network)
+		}
+		p.reserved[gw.String()] = true
+	}
+
+	return p, nil
+}
+
+func (p *Pool) Network() *net.IPNet {
+	return p.network
+}
+
+// Die Adresse ip wird nicht vergeben, z.B. die des Diktators
+func (p *Pool) Reserve(ip net.IP) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.reserved[ip.String()] = true
+}
+
+func (p *Pool) assignment(ip net.IP) Assignment {
+	prefix, _ := p.network.Mask.Size()
+
+	return Assignment{
+		Address: ip.String(),
+		Prefix:  prefix,
+		Gateway: p.gateway,
+		DNS:     p.dns,
+	}
+}
+
+// Prüft ob ip vergeben werden darf und von keiner anderen Node als
+// nodeID gehalten wird
+func (p *Pool) free(ip net.IP, nodeID string) bool {
+	ip = ip.To4()
+	if ip == nil || !p.network.Contains(ip) || p.reserved[ip.String()] {
+		return false
+	}
+	network := binary.BigEndian.Uint32(p.network.IP.To4())
+	broadcast := network | ^binary.BigEndian.Uint32(p.network.Mask)
+	i := binary.BigEndian.Uint32(ip)
+	if i == network || i == broadcast {
+		return false
+	}
+
+	for _, h := range p.holders {
+		if h.NodeID != nodeID && h.Assignment.Address == ip.String() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Bietet nodeID eine Adresse an. Hält die Node bereits eine, erhält sie
+// diese erneut.
+func (p *Pool) Offer(nodeID string) (Assignment, error) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h, ok := p.holders[nodeID]
+	if ok {
+		h.State = StateOffered
+		h.Since = time.Now()
+		h.Seen = h.Since
+		p.holders[nodeID] = h
+		return h.Assignment, nil
+	}
+
+	network := binary.BigEndian.Uint32(p.network.IP.To4())
+	broadcast := network | ^binary.BigEndian.Uint32(p.network.Mask)
+	for i := network + 1; i < broadcast; i++ {
+		ip := make(net.IP, 4)
+		binary.BigEndian.PutUint32(ip, i)
+		if !p.free(ip, nodeID) {
+			continue
+		}
+
+		a := p.assignment(ip)
+		now := time.Now()
+		p.holders[nodeID] = Holder{
+			NodeID:     nodeID,
+			Assignment: a,
+			State:      StateOffered,
+			Since:      now,
+			Seen:       now,
+		}
+		return a, nil
+	}
+
+	return Assignment{}, NoFreeAddressError
+}
+
+// Die Node hat die angebotene Adresse address gesetzt
+func (p *Pool) Confirm(nodeID, address string) error {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h, ok := p.holders[nodeID]
+	if !ok || h.Assignment.Address != address {
+		return fmt.Errorf("%w: %v with %v", UnknownHolderError, nodeID, address)
+	}
+	h.State = StateConfirmed
+	h.Since = time.Now()
+	h.Seen = h.Since
+	p.holders[nodeID] = h
+
+	return nil
+}
+
+// Übernimmt die Adresse welche eine Node bereits hat, z.B. von einem
+// früheren Diktator. Gibt false zurück falls die Adresse nicht frei ist.
+func (p *Pool) Adopt(nodeID, address string) bool {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ip := net.ParseIP(address)
+	if _, ok := p.holders[nodeID]; ok || !p.free(ip, nodeID) {
+		return false
+	}
+
+	now := time.Now()
+	p.holders[nodeID] = Holder{
+		NodeID:     nodeID,
+		Assignment: p.assignment(ip.To4()),
+		State:      StateConfirmed,
+		Since:      now,
+		Seen:       now,
+	}
+
+	return true
+}
+
+// Die Node nodeID hat sich gemeldet, z.B. auf eine Abfrage
+func (p *Pool) Seen(nodeID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h, ok := p.holders[nodeID]
+	if !ok {
+		return
+	}
+	h.Seen = time.Now()
+	p.holders[nodeID] = h
+}
+
+// Gibt die Adressen aller Nodes frei welche sich länger als age nicht
+// gemeldet haben und liefert diese zurück
+func (p *Pool) Expire(age time.Duration) []Holder {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	expired := []Holder{}
+	for id, h := range p.holders {
+		if time.Since(h.Seen) > age {
+			expired = append(expired, h)
+			delete(p.holders, id)
+		}
+	}
+
+	return expired
+}
+
+// Gibt die Adresse von nodeID wieder frei
+func (p *Pool) Release(nodeID string) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	delete(p.holders, nodeID)
+}
+
+func (p *Pool) Holder(nodeID string) (Holder, bool) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	h, ok := p.holders[nodeID]
+	return h, ok
+}
+
+// Alle Nodes mit Adresse, nach ID sortiert
+func (p *Pool) Holders() []Holder {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	holders := make([]Holder, 0, len(p.holders))
+	for _, h := range p.holders {
+		holders = append(holders, h)
+	}
+	sort.Slice(holders, func(i, j int) bool {
+		return holders[i].NodeID < holders[j].NodeID
+	})
+
+	return holders
+}
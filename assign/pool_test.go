@@ -0,0 +1,137 @@
+package assign
+
+import (
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func makeTestPool(t *testing.T, cidr, gateway string) *Pool {
+	p, err := NewPool(cidr, gateway, []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return p
+}
+
+func Test_NewPool_Invalid(t *testing.T) {
+	for _, c := range [][2]string{
+		{"10.0.0.0", ""},
+		{"10.0.0.0/31", ""},
+		{"2001:db8::/64", ""},
+		{"10.0.0.0/24", "10.0.1.1"},
+	} {
+		_, err := NewPool(c[0], c[1], nil)
+		if err == nil {
+			t.Fatal("Expect an error for", c)
+		}
+	}
+}
+
+// Netz, Broadcast, Gateway und reservierte Adressen werden ausgelassen
+func Test_Pool_Offer(t *testing.T) {
+	p := makeTestPool(t, "10.0.0.0/29", "10.0.0.1")
+	p.Reserve(net.ParseIP("10.0.0.2"))
+
+	expect := []string{"10.0.0.3", "10.0.0.4", "10.0.0.5", "10.0.0.6"}
+	for x, ip := range expect {
+		a, err := p.Offer(string(rune('a' + x)))
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if a.Address != ip || a.Prefix != 29 || a.Gateway != "10.0.0.1" || len(a.DNS) != 1 {
+			t.Fatal("Expect", ip, "/29 via 10.0.0.1 was", a)
+		}
+	}
+
+	_, err := p.Offer("z")
+	if !errors.Is(err, NoFreeAddressError) {
+		t.Fatal("Expect", NoFreeAddressError, "was", err)
+	}
+
+	// Eine Node erhält immer wieder ihre Adresse
+	a, err := p.Offer("b")
+	if err != nil || a.Address != "10.0.0.4" {
+		t.Fatal("Expect 10.0.0.4 was", a, err)
+	}
+}
+
+func Test_Pool_ConfirmRelease(t *testing.T) {
+	p := makeTestPool(t, "10.0.0.0/24", "")
+	a, err := p.Offer("a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = p.Confirm("a", "10.0.0.99")
+	if !errors.Is(err, UnknownHolderError) {
+		t.Fatal("Expect", UnknownHolderError, "was", err)
+	}
+	err = p.Confirm("a", a.Address)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	h, ok := p.Holder("a")
+	if !ok || h.State != StateConfirmed {
+		t.Fatal("Expect a confirmed holder was", h)
+	}
+
+	p.Release("a")
+	if len(p.Holders()) != 0 {
+		t.Fatal("Expect no holders was", p.Holders())
+	}
+	b, err := p.Offer("b")
+	if err != nil || b.Address != a.Address {
+		t.Fatal("Expect released", a.Address, "was", b.Address)
+	}
+}
+
+func Test_Pool_Adopt(t *testing.T) {
+	p := makeTestPool(t, "10.0.0.0/24", "10.0.0.1")
+
+	if !p.Adopt("a", "10.0.0.50") {
+		t.Fatal("Expect a to keep 10.0.0.50")
+	}
+	for _, address := range []string{"10.0.0.50", "10.0.0.1", "10.0.0.255", "10.0.1.5"} {
+		if p.Adopt("b", address) {
+			t.Fatal("Expect b not to get", address)
+		}
+	}
+
+	holders := p.Holders()
+	if len(holders) != 1 || holders[0].Assignment.Address != "10.0.0.50" || holders[0].State != StateConfirmed {
+		t.Fatal("Expect only a with 10.0.0.50 was", holders)
+	}
+}
+
+// Nodes welche sich nicht mehr melden verlieren ihre Adresse
+func Test_Pool_Expire(t *testing.T) {
+	p := makeTestPool(t, "10.0.0.0/29", "")
+	_, err := p.Offer("a")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !p.Adopt("b", "10.0.0.5") {
+		t.Fatal("Expect b to keep 10.0.0.5")
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	p.Seen("b")
+	p.Seen("unknown")
+
+	expired := p.Expire(10 * time.Millisecond)
+	if len(expired) != 1 || expired[0].NodeID != "a" {
+		t.Fatal("Expect a to expire was", expired)
+	}
+	if _, ok := p.Holder("a"); ok {
+		t.Fatal("Expect the address of a to be released")
+	}
+	if _, ok := p.Holder("unknown"); ok {
+		t.Fatal("Expect no holder for unknown")
+	}
+	if len(p.Expire(time.Second)) != 0 || len(p.Holders()) != 1 {
+		t.Fatal("Expect b to keep its address was", p.Holders())
+	}
+}
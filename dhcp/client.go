@@ -2,18 +2,20 @@ package dhcp
 
 import (
 	"bytes"
+	"context"
 	"crypto/rand"
 	"encoding/binary"
 	"errors"
 	"fmt"
-	"io"
-	"log"
+	"log/slog"
 	"math"
 	"math/big"
 	"net"
-	"os"
 	"time"
 	"unicode/utf8"
+
+	"github.com/rrawrriw/ite/lifecycle"
+	"github.com/rrawrriw/ite/logging"
 )
 
 const MaxUDPPacketSize = 1024
@@ -50,53 +52,48 @@ type DHCPOption struct {
 	Len   uint64
 }
 
+var ShutdownError = lifecycle.ShutdownError
+
+// Baut auf einem context.Context auf. Läuft dessen Deadline ab wird das
+// wie ein abgelaufener Timeout behandelt. Done bzw. Cancel beenden den
+// Context, Err liefert die Ursache.
 type Context struct {
-	Done     func()
-	DoneChan <-chan struct{}
-	Err      error
-	Timeout  *time.Timer
-	Log      Logger
+	lifecycle.Lifecycle
+	Timeout *time.Timer
+	// Ohne eigenen Logger wird slog.Default verwendet
+	Log     *slog.Logger
+	Metrics Metrics
 }
 
-type Logger struct {
-	Error *log.Logger
-	Debug *log.Logger
+func NewContext(conns []*net.UDPConn, timeout *time.Timer) Context {
+	return NewContextFrom(context.Background(), conns, timeout)
 }
 
-func NewLogger(errWriter, debugWriter io.Writer) Logger {
-
-	l := Logger{
-		Error: log.New(errWriter, "Error: ", log.LstdFlags|log.Lshortfile),
-		Debug: log.New(debugWriter, "Debug: ", log.LstdFlags|log.Lshortfile),
+// timeout darf nil sein wenn parent eine Deadline besitzt
+func NewContextFrom(parent context.Context, conns []*net.UDPConn, timeout *time.Timer) Context {
+	return Context{
+		Lifecycle: lifecycle.New(parent, conns, nil),
+		Timeout:   timeout,
+		Log:       slog.Default(),
 	}
-
-	return l
 }
 
-func NewContext(conns []*net.UDPConn, timeout *time.Timer) Context {
-	doneC := make(chan struct{})
+// Ohne Log im Context wird slog.Default verwendet
+func (c Context) log() *slog.Logger {
+	return logging.Or(c.Log)
+}
 
-	doneF := func() {
-		close(doneC)
-		for _, c := range conns {
-			err := c.Close()
-			if err != nil {
-				panic(err.Error())
-			}
-		}
+func (c Context) timeoutC() <-chan time.Time {
+	if c.Timeout == nil {
+		return nil
 	}
 
-	return Context{
-		Done:     doneF,
-		DoneChan: doneC,
-		Err:      nil,
-		Timeout:  timeout,
-		Log:      NewLogger(os.Stderr, os.Stdout),
-	}
+	return c.Timeout.C
 }
 
 func UDPInbox(ctx Context, conn *net.UDPConn, buf int) (chan UDPPacket, error) {
 	udpIn := make(chan UDPPacket, buf)
+	l := ctx.log()
 	go func() {
 		for {
 			payload := make([]byte, MaxUDPPacketSize)
@@ -106,17 +103,17 @@ func UDPInbox(ctx Context, conn *net.UDPConn, buf int) (chan UDPPacket, error) {
 				// Check if the done channel closed then shutdown goroutine
 				select {
 				case <-ctx.DoneChan:
-					ctx.Log.Debug.Println("UDPInbox shutdown")
+					l.Debug("UDPInbox shutdown")
 					close(udpIn)
 					return
 				default:
 					// Need default case otherwise the select statment would block
 				}
 
-				ctx.Log.Error.Println(err.Error())
+				l.Error("Read UDP packet", logging.Err(err))
 				continue
 			}
-			ctx.Log.Debug.Println("Receive UDP Packet")
+			l.Debug("Receive UDP packet")
 			udpIn <- UDPPacket{
 				RemoteAddr: rAddr,
 				Size:       size,
@@ -281,41 +278,12 @@ func MakeClientPayload(specs DHCPSpecs) ([]byte, error) {
 }
 
 func NewDHCPDiscover(nodeID uint64, iName string) ([]byte, error) {
-	zeroIP := net.ParseIP("0.0.0.0")
 	iFace, err := net.InterfaceByName(iName)
 	if err != nil {
 		return []byte{}, err
 	}
-	clientMACAddr := iFace.HardwareAddr
-	specs := DHCPSpecs{
-		Op:     1,
-		HType:  1,
-		HLen:   6,
-		Hops:   0,
-		Xid:    nodeID,
-		Secs:   1,
-		Flags:  0,
-		CiAddr: zeroIP,
-		YiAddr: zeroIP,
-		SiAddr: zeroIP,
-		GiAddr: zeroIP,
-		CHAddr: clientMACAddr,
-		SName:  "",
-		File:   "",
-		Options: []DHCPOption{
-			DHCPOption{53, []byte{1}, 1},
-			DHCPOption{61, MakeMACAddrBytes(clientMACAddr), 16},
-			DHCPOption{12, []byte("GO"), 2},
-		},
-	}
-
-	p, err := MakeClientPayload(specs)
-	if err != nil {
-		return []byte{}, err
-	}
-
-	return p, nil
 
+	return newClientMessage(nodeID, iFace.HardwareAddr, MsgDiscover, nil)
 }
 
 func ReadUint64(payload []byte, s, e int) (uint64, error) {
@@ -554,34 +522,48 @@ func ReadDHCPSpecs(payload []byte) (DHCPSpecs, error) {
 }
 
 func ResponseHandlerDiscover(ctx Context, in chan UDPPacket, nodeID uint64) (<-chan net.IP, <-chan struct{}) {
-	ipOut := make(chan net.IP)
+	return responseHandler(ctx, in, nodeID, readYiAddr)
+}
+
+// Liest die Antworten zur Anfrage nodeID und gibt sie über read gewandelt
+// weiter
+func responseHandler[T any](ctx Context, in chan UDPPacket, nodeID uint64, read func(DHCPSpecs) T) (<-chan T, <-chan struct{}) {
+	out := make(chan T)
 	timeout := make(chan struct{})
+	l := ctx.log().With(logging.KeyXID, nodeID)
 	go func() {
 		for {
 			select {
 			case <-ctx.DoneChan:
-				ctx.Log.Debug.Println("ResponseHandlerDiscover Done")
+				if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+					l.Debug("ResponseHandlerDiscover deadline")
+					timeout <- struct{}{}
+					return
+				}
+				l.Debug("ResponseHandlerDiscover done")
 				return
-			case <-ctx.Timeout.C:
-				ctx.Log.Debug.Println("ResponseHandlerDiscover Timeout")
+			case <-ctx.timeoutC():
+				l.Debug("ResponseHandlerDiscover timeout")
 				timeout <- struct{}{}
 				ctx.Done()
 				return
 			case packet := <-in:
 				specs, err := ReadDHCPSpecs(packet.Payload)
 				if err != nil {
-					ctx.Log.Error.Println(err.Error())
+					l.Error("Read DHCP packet", logging.Err(err))
 					continue
 				}
 				if specs.Xid == nodeID {
-					ipOut <- specs.YiAddr
+					l.Debug("Receive DHCP response", "ip", specs.YiAddr)
+					countResponse(ctx.metrics(), specs)
+					out <- read(specs)
 				}
 
 			}
 		}
 	}()
 
-	return ipOut, timeout
+	return out, timeout
 
 }
 
@@ -595,6 +577,20 @@ func NewNodeID() (uint64, error) {
 }
 
 func RequestIPAddr(inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName string) (<-chan net.IP, <-chan struct{}, error) {
+	return request(context.Background(), time.NewTimer(timeout), inAddr, remoteAddr, iName, readYiAddr)
+}
+
+// Wie RequestIPAddr, der Timeout ergibt sich aus der Deadline von parent.
+// Wird parent beendet wird auch die Anfrage beendet.
+func RequestIPAddrContext(parent context.Context, inAddr, remoteAddr net.UDPAddr, iName string) (<-chan net.IP, <-chan struct{}, error) {
+	return request(parent, nil, inAddr, remoteAddr, iName, readYiAddr)
+}
+
+func readYiAddr(specs DHCPSpecs) net.IP {
+	return specs.YiAddr
+}
+
+func request[T any](parent context.Context, timer *time.Timer, inAddr, remoteAddr net.UDPAddr, iName string, read func(DHCPSpecs) T) (<-chan T, <-chan struct{}, error) {
 	connIn, err := net.ListenUDP("udp", &inAddr)
 	if err != nil {
 		return nil, nil, err
@@ -602,7 +598,7 @@ func RequestIPAddr(inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName
 	conns := []*net.UDPConn{
 		connIn,
 	}
-	ctx := NewContext(conns, time.NewTimer(timeout))
+	ctx := NewContextFrom(parent, conns, timer)
 	udpIn, err := UDPInbox(ctx, connIn, 10)
 	if err != nil {
 		return nil, nil, err
@@ -612,7 +608,7 @@ func RequestIPAddr(inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName
 	if err != nil {
 		return nil, nil, err
 	}
-	newIP, timeoutC := ResponseHandlerDiscover(ctx, udpIn, nodeID)
+	out, timeoutC := responseHandler(ctx, udpIn, nodeID, read)
 
 	conn, err := net.DialUDP("udp", nil, &remoteAddr)
 	if err != nil {
@@ -622,6 +618,7 @@ func RequestIPAddr(inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName
 
 	p, err := NewDHCPDiscover(nodeID, iName)
 	if err != nil {
+		ctx.Done()
 		return nil, nil, err
 	}
 
@@ -630,6 +627,7 @@ func RequestIPAddr(inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName
 		ctx.Done()
 		return nil, nil, err
 	}
+	ctx.metrics().DHCPAttempt()
 
-	return newIP, timeoutC, nil
+	return out, timeoutC, nil
 }
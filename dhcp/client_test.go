@@ -2,6 +2,7 @@ package dhcp
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"net"
@@ -762,3 +763,30 @@ func Test_ResponseHandlerDiscover_OK(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func Test_ResponseHandlerDiscover_Deadline(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ctx := NewContextFrom(parent, []*net.UDPConn{}, nil)
+	in := make(chan UDPPacket)
+
+	_, timeout := ResponseHandlerDiscover(ctx, in, 1)
+
+	select {
+	case <-timeout:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expect a timeout after the deadline")
+	}
+}
+
+func Test_ContextDoneTwice(t *testing.T) {
+	ctx := NewContext([]*net.UDPConn{}, nil)
+
+	ctx.Done()
+	ctx.Done()
+
+	if ctx.Err() != ShutdownError {
+		t.Fatal("Expect", ShutdownError, "was", ctx.Err())
+	}
+}
@@ -0,0 +1,447 @@
+package dhcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"net"
+	"slices"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+)
+
+// Codes der verwendeten DHCP Optionen
+const (
+	OptSubnetMask      = 1
+	OptRouter          = 3
+	OptDNS             = 6
+	OptRequestedIP     = 50
+	OptLeaseTime       = 51
+	OptMessageType     = 53
+	OptServerID        = 54
+	OptParameterList   = 55
+	OptRenewalTime     = 58
+	OptRebindingTime   = 59
+	OptClasslessRoutes = 121
+)
+
+// DHCP Message Types welche der Client sendet
+const (
+	MsgDiscover = 1
+	MsgRequest  = 3
+)
+
+// Werden mit Option 55 in jedem Discover und Request angefragt
+var requestedOptions = []byte{OptSubnetMask, OptRouter, OptDNS, OptLeaseTime, OptRenewalTime, OptRebindingTime, OptClasslessRoutes}
+
+var (
+	InvalidClasslessRoutesError = errors.New("Invalid classless static routes")
+	// Der Server hat die Anfrage mit DHCPNAK abgelehnt
+	NakError = errors.New("DHCP request declined")
+	// Bis zum Timeout kam keine passende Antwort
+	TimeoutError = errors.New("DHCP request timed out")
+)
+
+type (
+	// Eine Route aus Option 121. Ohne Dst ist es die Default Route, ohne
+	// Gateway ist das Ziel direkt am Link erreichbar.
+	Route struct {
+		Dst     *net.IPNet
+		Gateway net.IP
+	}
+
+	// Die Adresse und Netzwerk Parameter aus einer Antwort des Servers
+	Lease struct {
+		IP       net.IP
+		Mask     net.IPMask
+		Routers  []net.IP
+		DNS      []net.IP
+		Routes   []Route
+		Duration time.Duration
+		// T1 aus Option 58, 0 wenn der Server keine vorgibt
+		Renewal time.Duration
+		// T2 aus Option 59, 0 wenn der Server keine vorgibt
+		Rebinding time.Duration
+		// Der Server aus Option 54, an ihn geht der DHCPREQUEST
+		Server net.IP
+	}
+)
+
+// Liest eine Liste von IPv4 Adressen wie in Option 3 und 6
+func readIPList(opts []DHCPOption, code uint64) []net.IP {
+	o, ok := FindDHCPOption(opts, code)
+	if !ok {
+		return nil
+	}
+
+	ips := []net.IP{}
+	for i := 0; i+4 <= len(o.Value); i += 4 {
+		ips = append(ips, net.IPv4(o.Value[i], o.Value[i+1], o.Value[i+2], o.Value[i+3]).To4())
+	}
+
+	return ips
+}
+
+// Liest die Routen aus Option 121 (RFC 3442). Jede Route besteht aus der
+// Länge des Präfixes, den signifikanten Bytes des Ziels und dem Router.
+func ReadClasslessRoutes(opts []DHCPOption) ([]Route, error) {
+	o, ok := FindDHCPOption(opts, OptClasslessRoutes)
+	if !ok {
+		return nil, nil
+	}
+
+	routes := []Route{}
+	v := o.Value
+	for len(v) > 0 {
+		width := int(v[0])
+		if width > 32 {
+			return nil, InvalidClasslessRoutesError
+		}
+		significant := (width + 7) / 8
+		if len(v) < 1+significant+4 {
+			return nil, InvalidClasslessRoutesError
+		}
+
+		dst := make(net.IP, 4)
+		copy(dst, v[1:1+significant])
+		gw := net.IP(append([]byte{}, v[1+significant:1+significant+4]...))
+		v = v[1+significant+4:]
+
+		r := Route{}
+		if width > 0 {
+			mask := net.CIDRMask(width, 32)
+			r.Dst = &net.IPNet{IP: dst.Mask(mask), Mask: mask}
+		}
+		if !gw.Equal(net.IPv4zero) {
+			r.Gateway = gw
+		}
+		routes = append(routes, r)
+	}
+
+	return routes, nil
+}
+
+// Die Lease aus der Antwort specs. Fehlt die Maske wird die Standardmaske
+// der Adresse verwendet, ungültige Routen werden ignoriert.
+func ReadLease(specs DHCPSpecs) Lease {
+	lease := Lease{
+		IP:      specs.YiAddr,
+		Mask:    specs.YiAddr.DefaultMask(),
+		Routers: readIPList(specs.Options, OptRouter),
+		DNS:     readIPList(specs.Options, OptDNS),
+	}
+
+	o, ok := FindDHCPOption(specs.Options, OptSubnetMask)
+	if ok && len(o.Value) == 4 {
+		lease.Mask = net.IPMask(append([]byte{}, o.Value...))
+	}
+	routes, err := ReadClasslessRoutes(specs.Options)
+	if err == nil {
+		lease.Routes = routes
+	}
+	d, ok := ReadLeaseTime(specs.Options)
+	if ok {
+		lease.Duration = d
+	}
+	o, ok = FindDHCPOption(specs.Options, OptRenewalTime)
+	if ok && len(o.Value) == 4 {
+		lease.Renewal = time.Duration(binary.BigEndian.Uint32(o.Value)) * time.Second
+	}
+	o, ok = FindDHCPOption(specs.Options, OptRebindingTime)
+	if ok && len(o.Value) == 4 {
+		lease.Rebinding = time.Duration(binary.BigEndian.Uint32(o.Value)) * time.Second
+	}
+	servers := readIPList(specs.Options, OptServerID)
+	if len(servers) > 0 {
+		lease.Server = servers[0]
+	}
+
+	return lease
+}
+
+// Nach dieser Zeit wird die Lease verlängert (T1). Ohne Option 58 nach der
+// halben Laufzeit, 0 bei einer Lease ohne Ablauf.
+func (l Lease) RenewAfter() time.Duration {
+	if l.Duration == 0 {
+		return 0
+	}
+	if l.Renewal > 0 && l.Renewal < l.Duration {
+		return l.Renewal
+	}
+
+	return l.Duration / 2
+}
+
+// Nach dieser Zeit wird die Lease bei einem beliebigen Server verlängert
+// (T2). Ohne Option 59 nach 7/8 der Laufzeit, 0 bei einer Lease ohne Ablauf.
+func (l Lease) RebindAfter() time.Duration {
+	if l.Duration == 0 {
+		return 0
+	}
+	if l.Rebinding > l.RenewAfter() && l.Rebinding < l.Duration {
+		return l.Rebinding
+	}
+
+	return l.Duration * 7 / 8
+}
+
+// Die Adresse mit Maske, z.B. 10.0.0.5/24
+func (l Lease) Address() *net.IPNet {
+	return &net.IPNet{
+		IP:   l.IP.To4(),
+		Mask: l.Mask,
+	}
+}
+
+// Die zu setzenden Routen. Nach RFC 3442 ersetzt Option 121 die Router
+// aus Option 3, ansonsten geht die Default Route über den ersten Router.
+func (l Lease) AllRoutes() []Route {
+	if len(l.Routes) > 0 {
+		return l.Routes
+	}
+	if len(l.Routers) > 0 {
+		return []Route{{Gateway: l.Routers[0]}}
+	}
+
+	return nil
+}
+
+// Fragt per DHCPDISCOVER nach einer Adresse und fordert das erste
+// Angebot per DHCPREQUEST an. Die Lease gilt erst mit dem DHCPACK, lehnt
+// der Server ab gibt es NakError. Kommt bis timeout bzw. bis zur Deadline
+// von parent keine Antwort gibt es TimeoutError. m darf nil sein.
+func RequestLease(parent context.Context, inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName string, m Metrics) (Lease, error) {
+	return exchange(parent, inAddr, remoteAddr, timeout, iName, m, func(c leaseClient) (Lease, error) {
+		return c.acquire()
+	})
+}
+
+// Verlängert lease per DHCPREQUEST mit der bisherigen Adresse nach
+// RenewAfter. Der Request geht direkt an den Server der Lease, siehe
+// RenewAddr. Lehnt der Server ab gibt es NakError, die Adresse darf dann
+// nicht weiter verwendet werden. m darf nil sein.
+func RenewLease(parent context.Context, inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName string, lease Lease, m Metrics) (Lease, error) {
+	return exchange(parent, inAddr, RenewAddr(remoteAddr, lease), timeout, iName, m, func(c leaseClient) (Lease, error) {
+		return c.renew(lease)
+	})
+}
+
+// Wie RenewLease, aber nach RebindAfter per Broadcast an remoteAddr, damit
+// auch ein anderer Server die Lease verlängern kann.
+func RebindLease(parent context.Context, inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName string, lease Lease, m Metrics) (Lease, error) {
+	return exchange(parent, inAddr, remoteAddr, timeout, iName, m, func(c leaseClient) (Lease, error) {
+		return c.renew(lease)
+	})
+}
+
+// Die Adresse des Servers aus Option 54 auf dem Port von remoteAddr. Ohne
+// Server bleibt es bei remoteAddr.
+func RenewAddr(remoteAddr net.UDPAddr, lease Lease) net.UDPAddr {
+	if lease.Server == nil {
+		return remoteAddr
+	}
+
+	return net.UDPAddr{
+		IP:   lease.Server,
+		Port: remoteAddr.Port,
+	}
+}
+
+// Öffnet die Verbindungen für einen Austausch mit dem Server und schließt
+// sie danach wieder. Die Anfragen und Antworten werden in m gezählt.
+func exchange(parent context.Context, inAddr, remoteAddr net.UDPAddr, timeout time.Duration, iName string, m Metrics, f func(leaseClient) (Lease, error)) (Lease, error) {
+	iFace, err := net.InterfaceByName(iName)
+	if err != nil {
+		return Lease{}, err
+	}
+	xid, err := NewNodeID()
+	if err != nil {
+		return Lease{}, err
+	}
+
+	connIn, err := net.ListenUDP("udp", &inAddr)
+	if err != nil {
+		return Lease{}, err
+	}
+	conn, err := net.DialUDP("udp", nil, &remoteAddr)
+	if err != nil {
+		connIn.Close()
+		return Lease{}, err
+	}
+	ctx := NewContextFrom(parent, []*net.UDPConn{connIn, conn}, time.NewTimer(timeout))
+	ctx.Metrics = m
+	defer ctx.Done()
+
+	in, err := UDPInbox(ctx, connIn, 10)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return f(leaseClient{
+		ctx: ctx,
+		in:  in,
+		send: func(p []byte) error {
+			_, err := conn.Write(p)
+			return err
+		},
+		mac: iFace.HardwareAddr,
+		xid: xid,
+	})
+}
+
+// Ein Austausch mit dem Server unter der Transaction ID xid
+type leaseClient struct {
+	ctx  Context
+	in   <-chan UDPPacket
+	send func([]byte) error
+	mac  net.HardwareAddr
+	xid  uint64
+}
+
+// DISCOVER, OFFER, REQUEST und ACK
+func (c leaseClient) acquire() (Lease, error) {
+	err := c.sendMessage(MsgDiscover, nil)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	specs, err := c.await(MsgOffer)
+	if err != nil {
+		return Lease{}, err
+	}
+	offer := ReadLease(specs)
+	c.ctx.log().Debug("Receive DHCP offer", "ip", offer.IP, "server", offer.Server)
+
+	opts := []DHCPOption{makeIPOption(OptRequestedIP, offer.IP)}
+	if offer.Server != nil {
+		opts = append(opts, makeIPOption(OptServerID, offer.Server))
+	}
+	err = c.sendMessage(MsgRequest, nil, opts...)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return c.ack()
+}
+
+// REQUEST mit der bisherigen Adresse und ACK
+func (c leaseClient) renew(lease Lease) (Lease, error) {
+	err := c.sendMessage(MsgRequest, lease.IP)
+	if err != nil {
+		return Lease{}, err
+	}
+
+	return c.ack()
+}
+
+func (c leaseClient) ack() (Lease, error) {
+	specs, err := c.await(MsgAck, MsgNak)
+	if err != nil {
+		return Lease{}, err
+	}
+	if ReadMessageType(specs.Options) == MsgNak {
+		return Lease{}, NakError
+	}
+
+	return ReadLease(specs), nil
+}
+
+// Wartet auf eine Antwort zu xid mit einem der Message Types
+func (c leaseClient) await(types ...int) (DHCPSpecs, error) {
+	l := c.ctx.log().With(logging.KeyXID, c.xid)
+	for {
+		select {
+		case <-c.ctx.DoneChan:
+			if errors.Is(c.ctx.Err(), context.DeadlineExceeded) {
+				return DHCPSpecs{}, TimeoutError
+			}
+			return DHCPSpecs{}, c.ctx.Err()
+		case <-c.ctx.timeoutC():
+			return DHCPSpecs{}, TimeoutError
+		case packet := <-c.in:
+			specs, err := ReadDHCPSpecs(packet.Payload)
+			if err != nil {
+				l.Error("Read DHCP packet", logging.Err(err))
+				continue
+			}
+			if specs.Xid != c.xid || !slices.Contains(types, ReadMessageType(specs.Options)) {
+				continue
+			}
+			countResponse(c.ctx.metrics(), specs)
+			return specs, nil
+		}
+	}
+}
+
+// Sendet eine Nachricht vom Typ msgType. ciAddr ist nur beim Verlängern
+// gesetzt.
+func (c leaseClient) sendMessage(msgType int, ciAddr net.IP, opts ...DHCPOption) error {
+	p, err := newClientMessage(c.xid, c.mac, msgType, ciAddr, opts...)
+	if err != nil {
+		return err
+	}
+	err = c.send(p)
+	if err != nil {
+		return err
+	}
+	if msgType == MsgDiscover || ciAddr != nil {
+		c.ctx.metrics().DHCPAttempt()
+	}
+
+	return nil
+}
+
+func newClientMessage(xid uint64, mac net.HardwareAddr, msgType int, ciAddr net.IP, opts ...DHCPOption) ([]byte, error) {
+	if len(mac) != 6 {
+		return nil, fmt.Errorf("%v is not an ethernet address", mac)
+	}
+	zeroIP := net.ParseIP("0.0.0.0")
+	if ciAddr == nil {
+		ciAddr = zeroIP
+	}
+
+	specs := DHCPSpecs{
+		Op:     1,
+		HType:  1,
+		HLen:   6,
+		Xid:    xid,
+		Secs:   1,
+		CiAddr: ciAddr.To16(),
+		YiAddr: zeroIP,
+		SiAddr: zeroIP,
+		GiAddr: zeroIP,
+		CHAddr: mac,
+		Options: append([]DHCPOption{
+			{OptMessageType, []byte{byte(msgType)}, 1},
+			{61, MakeMACAddrBytes(mac), 16},
+			{12, []byte("GO"), 2},
+			{OptParameterList, requestedOptions, uint64(len(requestedOptions))},
+		}, opts...),
+	}
+
+	return MakeClientPayload(specs)
+}
+
+func makeIPOption(code uint64, ip net.IP) DHCPOption {
+	return DHCPOption{Code: code, Value: ip.To4(), Len: 4}
+}
+
+// Kodiert eine Route für Option 121
+func MakeClasslessRouteBytes(r Route) []byte {
+	width := 0
+	dst := net.IPv4zero.To4()
+	if r.Dst != nil {
+		width, _ = r.Dst.Mask.Size()
+		dst = r.Dst.IP.To4()
+	}
+	gw := net.IPv4zero.To4()
+	if r.Gateway != nil {
+		gw = r.Gateway.To4()
+	}
+
+	b := []byte{byte(width)}
+	b = append(b, dst[:(width+7)/8]...)
+	return append(b, gw...)
+}
@@ -0,0 +1,265 @@
+package dhcp
+
+import (
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_ReadClasslessRoutes(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("172.16.0.0/12")
+	_, onLink, _ := net.ParseCIDR("10.1.0.0/16")
+	routes := []Route{
+		{Gateway: net.ParseIP("10.0.0.1")},
+		{Dst: dst, Gateway: net.ParseIP("10.0.0.2")},
+		{Dst: onLink},
+	}
+
+	value := []byte{}
+	for _, r := range routes {
+		value = append(value, MakeClasslessRouteBytes(r)...)
+	}
+	// 0 / 12 + 2 Bytes / 16 + 2 Bytes, jeweils mit Router
+	if len(value) != 5+7+7 {
+		t.Fatal("Expect 19 bytes was", len(value))
+	}
+
+	read, err := ReadClasslessRoutes([]DHCPOption{{Code: OptClasslessRoutes, Value: value, Len: uint64(len(value))}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read) != 3 ||
+		read[0].Dst != nil || !read[0].Gateway.Equal(net.ParseIP("10.0.0.1")) ||
+		read[1].Dst.String() != "172.16.0.0/12" || !read[1].Gateway.Equal(net.ParseIP("10.0.0.2")) ||
+		read[2].Dst.String() != "10.1.0.0/16" || read[2].Gateway != nil {
+		t.Fatal("Expect", routes, "was", read)
+	}
+}
+
+func Test_ReadClasslessRoutes_Invalid(t *testing.T) {
+	for _, value := range [][]byte{{33, 0, 0, 0, 0, 0, 0, 0, 0}, {24, 10, 0}} {
+		_, err := ReadClasslessRoutes([]DHCPOption{{Code: OptClasslessRoutes, Value: value}})
+		if err != InvalidClasslessRoutesError {
+			t.Fatal("Expect", InvalidClasslessRoutesError, "was", err)
+		}
+	}
+}
+
+func Test_ReadLease(t *testing.T) {
+	specs := DHCPSpecs{
+		YiAddr: net.ParseIP("10.0.0.5"),
+		Options: []DHCPOption{
+			{Code: OptSubnetMask, Value: []byte{255, 255, 255, 0}, Len: 4},
+			{Code: OptRouter, Value: []byte{10, 0, 0, 1, 10, 0, 0, 2}, Len: 8},
+			{Code: OptDNS, Value: []byte{1, 1, 1, 1}, Len: 4},
+			{Code: OptLeaseTime, Value: []byte{0, 0, 0x0e, 0x10}, Len: 4},
+		},
+	}
+
+	lease := ReadLease(specs)
+	if lease.Address().String() != "10.0.0.5/24" || lease.Duration != time.Hour {
+		t.Fatal("Expect 10.0.0.5/24 for an hour was", lease)
+	}
+	if len(lease.Routers) != 2 || len(lease.DNS) != 1 || !lease.DNS[0].Equal(net.ParseIP("1.1.1.1")) {
+		t.Fatal("Expect 2 routers and 1.1.1.1 was", lease)
+	}
+	routes := lease.AllRoutes()
+	if len(routes) != 1 || routes[0].Dst != nil || !routes[0].Gateway.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatal("Expect a default route via 10.0.0.1 was", routes)
+	}
+
+	// Option 121 ersetzt die Router
+	value := MakeClasslessRouteBytes(Route{Gateway: net.ParseIP("10.0.0.9")})
+	specs.Options = append(specs.Options, DHCPOption{Code: OptClasslessRoutes, Value: value, Len: uint64(len(value))})
+	routes = ReadLease(specs).AllRoutes()
+	if len(routes) != 1 || !routes[0].Gateway.Equal(net.ParseIP("10.0.0.9")) {
+		t.Fatal("Expect a default route via 10.0.0.9 was", routes)
+	}
+
+	// Ohne Maske die Standardmaske der Adresse
+	lease = ReadLease(DHCPSpecs{YiAddr: net.ParseIP("192.168.1.7")})
+	if lease.Address().String() != "192.168.1.7/24" || lease.AllRoutes() != nil {
+		t.Fatal("Expect 192.168.1.7/24 without routes was", lease)
+	}
+}
+
+func Test_Lease_RenewAfter(t *testing.T) {
+	tests := map[time.Duration]Lease{
+		0:                {},
+		30 * time.Minute: {Duration: time.Hour},
+		10 * time.Minute: {Duration: time.Hour, Renewal: 10 * time.Minute},
+		45 * time.Minute: {Duration: 90 * time.Minute, Renewal: 2 * time.Hour},
+	}
+	for expect, l := range tests {
+		if l.RenewAfter() != expect {
+			t.Fatal("Expect", expect, "was", l.RenewAfter(), "for", l)
+		}
+	}
+}
+
+func Test_Lease_RebindAfter(t *testing.T) {
+	tests := map[time.Duration]Lease{
+		0:                 {},
+		105 * time.Minute: {Duration: 2 * time.Hour},
+		50 * time.Minute:  {Duration: time.Hour, Rebinding: 50 * time.Minute},
+		// T2 muss zwischen T1 und dem Ablauf liegen
+		35 * time.Minute: {Duration: 40 * time.Minute, Rebinding: 10 * time.Minute},
+		70 * time.Minute: {Duration: 80 * time.Minute, Rebinding: 2 * time.Hour},
+	}
+	for expect, l := range tests {
+		if l.RebindAfter() != expect {
+			t.Fatal("Expect", expect, "was", l.RebindAfter(), "for", l)
+		}
+	}
+}
+
+func Test_RenewAddr(t *testing.T) {
+	remote := net.UDPAddr{IP: net.IPv4bcast, Port: 67}
+
+	addr := RenewAddr(remote, Lease{Server: net.ParseIP("10.0.0.1")})
+	if addr.String() != "10.0.0.1:67" {
+		t.Fatal("Expect 10.0.0.1:67 was", addr.String())
+	}
+
+	addr = RenewAddr(remote, Lease{})
+	if addr.String() != "255.255.255.255:67" {
+		t.Fatal("Expect 255.255.255.255:67 was", addr.String())
+	}
+}
+
+// Ein Server welcher auf jede Nachricht des Clients mit reply antwortet
+func newTestLeaseClient(t *testing.T, reply func(req DHCPSpecs) (int, net.IP)) (leaseClient, *[]DHCPSpecs) {
+	mac, err := net.ParseMAC("34:23:87:01:c2:f9")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := NewContext(nil, time.NewTimer(time.Second))
+	t.Cleanup(ctx.Done)
+
+	in := make(chan UDPPacket, 10)
+	sent := []DHCPSpecs{}
+	c := leaseClient{
+		ctx: ctx,
+		in:  in,
+		mac: mac,
+		xid: 11,
+	}
+	c.send = func(p []byte) error {
+		req, err := ReadDHCPSpecs(p)
+		if err != nil {
+			return err
+		}
+		sent = append(sent, req)
+
+		msgType, ip := reply(req)
+		if msgType == 0 {
+			return nil
+		}
+		// Eine fremde Antwort wird ignoriert
+		in <- UDPPacket{Payload: makeTestReply(t, req.Xid+1, MsgAck, ip)}
+		in <- UDPPacket{Payload: makeTestReply(t, req.Xid, msgType, ip)}
+		return nil
+	}
+
+	return c, &sent
+}
+
+func makeTestReply(t *testing.T, xid uint64, msgType int, ip net.IP) []byte {
+	zeroIP := net.ParseIP("0.0.0.0")
+	if ip == nil {
+		ip = zeroIP
+	}
+	p, err := MakeClientPayload(DHCPSpecs{
+		Op:     2,
+		HType:  1,
+		HLen:   6,
+		Xid:    xid,
+		CiAddr: zeroIP,
+		YiAddr: ip,
+		SiAddr: zeroIP,
+		GiAddr: zeroIP,
+		CHAddr: net.HardwareAddr{0, 0, 0, 0, 0, 0},
+		Options: []DHCPOption{
+			{OptMessageType, []byte{byte(msgType)}, 1},
+			{OptServerID, []byte{10, 0, 0, 1}, 4},
+			{OptSubnetMask, []byte{255, 255, 255, 0}, 4},
+			{OptLeaseTime, []byte{0, 0, 0x0e, 0x10}, 4},
+			{OptRenewalTime, []byte{0, 0, 0x07, 0x08}, 4},
+			{OptRebindingTime, []byte{0, 0, 0x0b, 0xb8}, 4},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return p
+}
+
+func Test_LeaseClient_Acquire(t *testing.T) {
+	c, sent := newTestLeaseClient(t, func(req DHCPSpecs) (int, net.IP) {
+		if ReadMessageType(req.Options) == MsgDiscover {
+			return MsgOffer, net.ParseIP("10.0.0.5")
+		}
+		return MsgAck, net.ParseIP("10.0.0.5")
+	})
+
+	lease, err := c.acquire()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lease.Address().String() != "10.0.0.5/24" || lease.Duration != time.Hour || lease.Renewal != 30*time.Minute || lease.Rebinding != 50*time.Minute || !lease.Server.Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatal("Expect 10.0.0.5/24 from 10.0.0.1 was", lease)
+	}
+
+	if len(*sent) != 2 || ReadMessageType((*sent)[1].Options) != MsgRequest {
+		t.Fatal("Expect a discover and a request was", *sent)
+	}
+	requested := readIPList((*sent)[1].Options, OptRequestedIP)
+	server := readIPList((*sent)[1].Options, OptServerID)
+	if len(requested) != 1 || !requested[0].Equal(net.ParseIP("10.0.0.5")) || len(server) != 1 || !server[0].Equal(net.ParseIP("10.0.0.1")) {
+		t.Fatal("Expect to request 10.0.0.5 from 10.0.0.1 was", requested, server)
+	}
+}
+
+func Test_LeaseClient_Nak(t *testing.T) {
+	c, _ := newTestLeaseClient(t, func(req DHCPSpecs) (int, net.IP) {
+		if ReadMessageType(req.Options) == MsgDiscover {
+			return MsgOffer, net.ParseIP("10.0.0.5")
+		}
+		return MsgNak, nil
+	})
+
+	_, err := c.acquire()
+	if err != NakError {
+		t.Fatal("Expect", NakError, "was", err)
+	}
+}
+
+func Test_LeaseClient_Renew(t *testing.T) {
+	c, sent := newTestLeaseClient(t, func(req DHCPSpecs) (int, net.IP) {
+		return MsgAck, req.CiAddr
+	})
+
+	lease, err := c.renew(Lease{IP: net.ParseIP("10.0.0.5")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !lease.IP.Equal(net.ParseIP("10.0.0.5")) || lease.Duration != time.Hour {
+		t.Fatal("Expect 10.0.0.5 for an hour was", lease)
+	}
+	if len(*sent) != 1 || !(*sent)[0].CiAddr.Equal(net.ParseIP("10.0.0.5")) {
+		t.Fatal("Expect a request from 10.0.0.5 was", *sent)
+	}
+}
+
+func Test_LeaseClient_Timeout(t *testing.T) {
+	c, _ := newTestLeaseClient(t, func(req DHCPSpecs) (int, net.IP) {
+		return 0, nil
+	})
+	c.ctx.Timeout.Reset(10 * time.Millisecond)
+
+	_, err := c.acquire()
+	if err != TimeoutError {
+		t.Fatal("Expect", TimeoutError, "was", err)
+	}
+}
@@ -0,0 +1,90 @@
+package dhcp
+
+import (
+	"encoding/binary"
+	"time"
+)
+
+// DHCP Message Types aus Option 53
+const (
+	MsgOffer = 2
+	MsgAck   = 5
+	MsgNak   = 6
+)
+
+type (
+	// Wird bei jeder Anfrage und Antwort aufgerufen. Die Implementierung
+	// muss von mehreren goroutines nutzbar sein.
+	Metrics interface {
+		DHCPAttempt()
+		DHCPOffer()
+		DHCPAck()
+		DHCPNak()
+		// Laufzeit der zuletzt erhaltenen Lease
+		DHCPLease(d time.Duration)
+	}
+
+	// Verwirft alle Werte
+	NoopMetrics struct{}
+)
+
+func (NoopMetrics) DHCPAttempt()              {}
+func (NoopMetrics) DHCPOffer()                {}
+func (NoopMetrics) DHCPAck()                  {}
+func (NoopMetrics) DHCPNak()                  {}
+func (NoopMetrics) DHCPLease(d time.Duration) {}
+
+func (c Context) metrics() Metrics {
+	if c.Metrics == nil {
+		return NoopMetrics{}
+	}
+
+	return c.Metrics
+}
+
+func FindDHCPOption(opts []DHCPOption, code uint64) (DHCPOption, bool) {
+	for _, o := range opts {
+		if o.Code == code {
+			return o, true
+		}
+	}
+
+	return DHCPOption{}, false
+}
+
+// Liest den Message Type aus Option 53, 0 wenn dieser fehlt
+func ReadMessageType(opts []DHCPOption) int {
+	o, ok := FindDHCPOption(opts, 53)
+	if !ok || len(o.Value) < 1 {
+		return 0
+	}
+
+	return int(o.Value[0])
+}
+
+// Liest die Lease Time aus Option 51
+func ReadLeaseTime(opts []DHCPOption) (time.Duration, bool) {
+	o, ok := FindDHCPOption(opts, 51)
+	if !ok || len(o.Value) < 4 {
+		return 0, false
+	}
+
+	secs := binary.BigEndian.Uint32(o.Value[:4])
+	return time.Duration(secs) * time.Second, true
+}
+
+// Die Lease zählt erst mit dem ACK, ein OFFER ist nur ein Angebot
+func countResponse(m Metrics, specs DHCPSpecs) {
+	switch ReadMessageType(specs.Options) {
+	case MsgOffer:
+		m.DHCPOffer()
+	case MsgAck:
+		m.DHCPAck()
+		lease, ok := ReadLeaseTime(specs.Options)
+		if ok {
+			m.DHCPLease(lease)
+		}
+	case MsgNak:
+		m.DHCPNak()
+	}
+}
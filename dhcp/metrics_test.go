@@ -0,0 +1,72 @@
+package dhcp
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ReadMessageType(t *testing.T) {
+	opts := []DHCPOption{
+		{Code: 53, Value: []byte{MsgAck}, Len: 1},
+	}
+
+	if ReadMessageType(opts) != MsgAck {
+		t.Fatal("Expect", MsgAck, "was", ReadMessageType(opts))
+	}
+
+	if ReadMessageType([]DHCPOption{}) != 0 {
+		t.Fatal("Expect 0 without option 53")
+	}
+}
+
+func Test_ReadLeaseTime(t *testing.T) {
+	opts := []DHCPOption{
+		{Code: 51, Value: []byte{0, 0, 0x0e, 0x10}, Len: 4},
+	}
+
+	lease, ok := ReadLeaseTime(opts)
+	if !ok || lease != time.Hour {
+		t.Fatal("Expect", time.Hour, "was", lease, ok)
+	}
+
+	_, ok = ReadLeaseTime([]DHCPOption{{Code: 51, Value: []byte{1}, Len: 1}})
+	if ok {
+		t.Fatal("Expect a short option to fail")
+	}
+}
+
+type testMetrics struct {
+	NoopMetrics
+	offers int
+	leases []time.Duration
+}
+
+func (m *testMetrics) DHCPOffer() {
+	m.offers++
+}
+
+func (m *testMetrics) DHCPLease(d time.Duration) {
+	m.leases = append(m.leases, d)
+}
+
+// Nur das ACK meldet die Laufzeit der Lease
+func Test_CountResponse_LeaseOnAck(t *testing.T) {
+	m := &testMetrics{}
+	leaseTime := DHCPOption{Code: 51, Value: []byte{0, 0, 0x0e, 0x10}, Len: 4}
+
+	countResponse(m, DHCPSpecs{Options: []DHCPOption{
+		{Code: 53, Value: []byte{MsgOffer}, Len: 1},
+		leaseTime,
+	}})
+	if m.offers != 1 || len(m.leases) != 0 {
+		t.Fatal("Expect an offer without lease was", m.offers, m.leases)
+	}
+
+	countResponse(m, DHCPSpecs{Options: []DHCPOption{
+		{Code: 53, Value: []byte{MsgAck}, Len: 1},
+		leaseTime,
+	}})
+	if len(m.leases) != 1 || m.leases[0] != time.Hour {
+		t.Fatal("Expect", time.Hour, "was", m.leases)
+	}
+}
@@ -0,0 +1,180 @@
+package dictator
+
+import (
+	"errors"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	// Ein Codec übersetzt den Wert eines Befehls in den Typ welchen der
+	// Handler erwartet und das Ergebnis des Handlers zurück in einen Wert
+	// der sich in CommandResponseBlob.Result verpacken lässt.
+	Codec interface {
+		DecodeValue(raw bson.Raw) (interface{}, error)
+		EncodeResult(result interface{}) (interface{}, error)
+	}
+
+	// Codec für Befehle mit einem Wert vom Typ T und einem Ergebnis vom
+	// Typ R. Beide Typen müssen sich mit BSON (un)marshalen lassen.
+	TypedCodec[T, R any] struct{}
+
+	TypedCommandHandler[T, R any] func(NodeContext, DictatorPayload, T) (R, error)
+
+	// Wird benötigt um den Wert eines Befehls erst im Handler zu dekodieren
+	rawCommandBlob struct {
+		Name  string
+		Value bson.Raw
+	}
+
+	rawCommandResponseBlob struct {
+		CommandID string
+		NodeID    string
+		NodeName  string `bson:",omitempty"`
+		Status    int
+		Result    bson.Raw
+		Error     string
+	}
+)
+
+func (c TypedCodec[T, R]) DecodeValue(raw bson.Raw) (interface{}, error) {
+	value := *new(T)
+	// Ein fehlender Wert ergibt den Nullwert von T
+	if raw.Kind == 0 || raw.Kind == 0x0A {
+		return value, nil
+	}
+
+	err := raw.Unmarshal(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	return value, nil
+}
+
+func (c TypedCodec[T, R]) EncodeResult(result interface{}) (interface{}, error) {
+	if result == nil {
+		return nil, nil
+	}
+
+	r, ok := result.(R)
+	if !ok {
+		return nil, errors.New("Result has the wrong type")
+	}
+
+	return r, nil
+}
+
+func (r *CommandRouter) AddCodec(name string, codec Codec) {
+	if r.codecs == nil {
+		r.codecs = map[string]Codec{}
+	}
+	r.codecs[name] = codec
+}
+
+func (r CommandRouter) FindCodec(name string) (Codec, bool) {
+	codec, ok := r.codecs[name]
+	if !ok {
+		return nil, ok
+	}
+
+	return codec, true
+}
+
+// Registriert einen Handler welcher den Wert des Befehls bereits dekodiert
+// als T erhält. Das Ergebnis des Handlers wird als CommandResponse an den
+// Diktator gesendet. Lässt sich der Wert nicht als T lesen erhält der
+// Diktator eine Antwort mit dem Status StatusBadPayload.
+func AddTypedHandler[T, R any](r *CommandRouter, name string, fun TypedCommandHandler[T, R]) {
+	codec := TypedCodec[T, R]{}
+	r.AddCodec(name, codec)
+
+	h := func(nCtx NodeContext, payload DictatorPayload) error {
+		blob := rawCommandBlob{}
+		err := bson.Unmarshal(payload.Blob, &blob)
+		if err != nil {
+			return NewCommandError(StatusBadPayload, err.Error())
+		}
+
+		value, err := codec.DecodeValue(blob.Value)
+		if err != nil {
+			return NewCommandError(StatusBadPayload, err.Error())
+		}
+
+		v, _ := value.(T)
+		result, err := fun(nCtx, payload, v)
+		if err != nil {
+			return err
+		}
+
+		encoded, err := codec.EncodeResult(result)
+		if err != nil {
+			return err
+		}
+
+		return SendCommandResponse(nCtx, payload, StatusOK, encoded)
+	}
+
+	r.AddHandler(name, h)
+}
+
+// Antwortet dem Diktator welcher den Befehl gesendet hat
+func SendCommandResponse(nCtx NodeContext, payload DictatorPayload, status int, result interface{}) error {
+	packet, err := newCommandResponsePacket(payload.DictatorID, responseTrace(nCtx, payload), CommandResponseBlob{
+		CommandID: nCtx.Cmd.ID,
+		NodeID:    nCtx.NodeID,
+		NodeName:  nCtx.Mission.Identity.Name,
+		Status:    status,
+		Result:    result,
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case nCtx.UDPOut <- packet:
+		return nil
+	case <-nCtx.AppContext.DoneChan:
+		return nCtx.AppContext.Err()
+	}
+}
+
+// Liest den Wert eines Befehls in v
+func ReadCommandValue(payload DictatorPayload, v interface{}) error {
+	blob := rawCommandBlob{}
+	err := bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return err
+	}
+
+	return blob.Value.Unmarshal(v)
+}
+
+// Liest das Ergebnis einer CommandResponse in v
+func ReadCommandResult(payload DictatorPayload, v interface{}) (CommandResponseBlob, error) {
+	blob := rawCommandResponseBlob{}
+	err := bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return CommandResponseBlob{}, err
+	}
+
+	resp := CommandResponseBlob{
+		CommandID: blob.CommandID,
+		NodeID:    blob.NodeID,
+		NodeName:  blob.NodeName,
+		Status:    blob.Status,
+		Error:     blob.Error,
+	}
+
+	if blob.Result.Kind == 0 || blob.Result.Kind == 0x0A {
+		return resp, nil
+	}
+
+	err = blob.Result.Unmarshal(v)
+	if err != nil {
+		return CommandResponseBlob{}, err
+	}
+	resp.Result = v
+
+	return resp, nil
+}
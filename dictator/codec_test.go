@@ -0,0 +1,132 @@
+package dictator
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type testCmdValue struct {
+	IP  string
+	Sub int
+}
+
+type testCmdResult struct {
+	Applied bool
+}
+
+func Test_AddTypedHandler_OK(t *testing.T) {
+	router := CommandRouter{}
+	h := func(nCtx NodeContext, p DictatorPayload, v testCmdValue) (testCmdResult, error) {
+		if v.IP != "192.168.1.2" || v.Sub != 24 {
+			t.Fatal("Expect", "192.168.1.2/24", "was", v)
+		}
+		return testCmdResult{Applied: true}, nil
+	}
+	AddTypedHandler(&router, "test", h)
+
+	if _, ok := router.FindCodec("test"); !ok {
+		t.Fatal("Expect to find a codec")
+	}
+
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+		Mission: MissionSpecs{
+			CommandRouter: router,
+		},
+	}
+
+	value := testCmdValue{IP: "192.168.1.2", Sub: 24}
+	err := nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", value))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	payload := readTestPayload(t, <-udpOut)
+
+	result := testCmdResult{}
+	resp, err := ReadCommandResult(payload, &result)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.Status != StatusOK {
+		t.Fatal("Expect", StatusOK, "was", resp.Status)
+	}
+
+	if resp.NodeID != "2" {
+		t.Fatal("Expect", "2", "was", resp.NodeID)
+	}
+
+	if !result.Applied {
+		t.Fatal("Expect result to be applied")
+	}
+}
+
+func Test_AddTypedHandler_BadPayload(t *testing.T) {
+	router := CommandRouter{}
+	h := func(nCtx NodeContext, p DictatorPayload, v int) (int, error) {
+		t.Fatal("Expect handler not to be called")
+		return 0, nil
+	}
+	AddTypedHandler(&router, "test", h)
+
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+		Mission: MissionSpecs{
+			CommandRouter: router,
+		},
+	}
+
+	err := nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", "no int"))
+	if err == nil {
+		t.Fatal("Expect HandlePacket to return a error")
+	}
+
+	payload := readTestPayload(t, <-udpOut)
+
+	resp := CommandResponseBlob{}
+	err = bson.Unmarshal(payload.Blob, &resp)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if resp.Status != StatusBadPayload {
+		t.Fatal("Expect", StatusBadPayload, "was", resp.Status)
+	}
+}
+
+func Test_ReadCommandValue_OK(t *testing.T) {
+	payload := readTestPayload(t, makeTestCommandPacket(t, "1", "test", testCmdValue{IP: "10.0.0.1"}))
+
+	value := testCmdValue{}
+	err := ReadCommandValue(payload, &value)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	if value.IP != "10.0.0.1" {
+		t.Fatal("Expect", "10.0.0.1", "was", value.IP)
+	}
+}
+
+// Nach dem Beenden wartet die Antwort nicht mehr auf den UDP Sender
+func Test_SendCommandResponse_Done(t *testing.T) {
+	nodeCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     make(chan UDPPacket),
+	}
+	nodeCtx.AppContext.Done()
+
+	err := SendCommandResponse(nodeCtx, DictatorPayload{DictatorID: "1"}, StatusOK, nil)
+	if err != ShutdownError {
+		t.Fatal("Expect", ShutdownError, "was", err)
+	}
+}
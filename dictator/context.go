@@ -1,49 +1,61 @@
 package dictator
 
 import (
+	"context"
+	"log/slog"
 	"net"
-	"os"
+	"sync"
+
+	"github.com/rrawrriw/ite/lifecycle"
 )
 
+var ShutdownError = lifecycle.ShutdownError
+
+// Der AppContext einer Node. Baut auf einem context.Context auf, damit
+// sich eine Node in eine bestehende Anwendung einbetten lässt. Wird der
+// übergeordnete Context beendet fährt auch die Node herunter. Done bzw.
+// Cancel fahren die Node herunter, Err liefert die Ursache.
 type Context struct {
-	Done     func()
-	DoneChan <-chan struct{}
-	Err      error
-	Log      Logger
+	lifecycle.Lifecycle
+	// Leitet ein geordnetes Herunterfahren ein. Ein Diktator dankt ab,
+	// laufende Befehle werden beendet und danach wird Done aufgerufen.
+	// Kann mehrfach aufgerufen werden.
+	Shutdown     func()
+	ShutdownChan <-chan struct{}
+	// Ohne eigenen Logger wird slog.Default verwendet
+	Log *slog.Logger
+	// Ohne Metrics werden keine Werte erfasst
+	Metrics Metrics
+	// Erhält die Spans aller Befehle. Ohne Exporter wird der
+	// TraceContext nur weitergegeben.
+	Exporter SpanExporter
 }
 
 func NewContextWithConn(conns []*net.UDPConn) Context {
-	doneC := make(chan struct{})
-
-	doneF := func() {
-		close(doneC)
-		for _, c := range conns {
-			err := c.Close()
-			if err != nil {
-				panic(err.Error())
-			}
-		}
-	}
-
-	return Context{
-		Done:     doneF,
-		DoneChan: doneC,
-		Err:      nil,
-		Log:      NewLogger(os.Stderr, os.Stdout),
-	}
+	return NewContextFrom(context.Background(), conns)
 }
 
 func NewContext() Context {
-	doneC := make(chan struct{})
+	return NewContextFrom(context.Background(), nil)
+}
 
-	doneF := func() {
-		close(doneC)
+// Erzeugt einen Context welcher beendet wird sobald parent beendet wird
+// oder Done bzw. Cancel aufgerufen wird. Dabei werden alle conns
+// geschlossen.
+func NewContextFrom(parent context.Context, conns []*net.UDPConn) Context {
+	shutdownC := make(chan struct{})
+	shutdownOnce := sync.Once{}
+	shutdownF := func() {
+		shutdownOnce.Do(func() {
+			close(shutdownC)
+		})
 	}
 
 	return Context{
-		Done:     doneF,
-		DoneChan: doneC,
-		Err:      nil,
-		Log:      NewLogger(os.Stderr, os.Stdout),
+		Lifecycle:    lifecycle.New(parent, conns, nil),
+		Shutdown:     shutdownF,
+		ShutdownChan: shutdownC,
+		Log:          slog.Default(),
+		Metrics:      NoopMetrics{},
 	}
 }
@@ -1,6 +1,7 @@
 package dictator
 
 import (
+	"context"
 	"errors"
 	"net"
 	"testing"
@@ -67,3 +68,69 @@ func Test_ContextCloseFuncWithConn(t *testing.T) {
 
 	time.Sleep(1 * time.Second)
 }
+
+func Test_ContextDoneTwice(t *testing.T) {
+	ctx := NewContext()
+
+	ctx.Done()
+	ctx.Done()
+
+	select {
+	case <-ctx.DoneChan:
+	default:
+		t.Fatal("Expect done channel to be closed")
+	}
+
+	if ctx.Err() != ShutdownError {
+		t.Fatal("Expect", ShutdownError, "was", ctx.Err())
+	}
+}
+
+func Test_ContextCancelCause(t *testing.T) {
+	ctx := NewContext()
+	if ctx.Err() != nil {
+		t.Fatal("Expect no error was", ctx.Err())
+	}
+
+	cause := errors.New("test")
+	ctx.Cancel(cause)
+	ctx.Done()
+
+	if ctx.Err() != cause {
+		t.Fatal("Expect", cause, "was", ctx.Err())
+	}
+}
+
+func Test_ContextFromParent(t *testing.T) {
+	a := net.UDPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 12345,
+	}
+	c, err := net.ListenUDP("udp", &a)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	ctx := NewContextFrom(parent, []*net.UDPConn{c})
+
+	select {
+	case <-ctx.DoneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expect done channel to be closed after the deadline")
+	}
+
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Fatal("Expect", context.DeadlineExceeded, "was", ctx.Err())
+	}
+
+	// Die Verbindung wird nebenläufig geschlossen
+	time.Sleep(50 * time.Millisecond)
+	c, err = net.ListenUDP("udp", &a)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.Close()
+}
@@ -0,0 +1,200 @@
+package dictator
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	// Die Node läuft nicht mehr
+	NodeStoppedError = errors.New("Node stopped")
+	// Nur der Diktator darf Befehle senden oder abdanken
+	NotDictatorError = errors.New("Node is not the dictator")
+	// Die Node darf laut Leadership nicht Diktator werden
+	IneligibleError = errors.New("Node is not eligible")
+)
+
+type (
+	// Eine andere Node des Clusters. Followers werden erst bekannt wenn
+	// sie auf einen Befehl antworten.
+	Member struct {
+		ID string
+		// Leer solange die Node keinen Namen gesendet hat
+		Name     string
+		LastSeen time.Time
+		Dictator bool
+	}
+
+	// Wird von LoopNode ausgeführt, damit fun den NodeContext ohne Locks
+	// verändern darf
+	nodeRequest struct {
+		fun  func(nodeCtx *NodeContext) error
+		errC chan error
+	}
+)
+
+// Führt fun in der goroutine der Node aus und wartet auf das Ergebnis
+func (h *Handle) do(fun func(nodeCtx *NodeContext) error) error {
+	if h == nil {
+		return NodeStoppedError
+	}
+
+	req := nodeRequest{
+		fun:  fun,
+		errC: make(chan error, 1),
+	}
+
+	select {
+	case h.requests <- req:
+	case <-h.done:
+		return NodeStoppedError
+	}
+
+	select {
+	case err := <-req.errC:
+		return err
+	case <-h.done:
+		return NodeStoppedError
+	}
+}
+
+// Ohne Handle gibt es keine Anfragen, ein nil Channel blockiert im select
+func (h *Handle) requestC() <-chan nodeRequest {
+	if h == nil {
+		return nil
+	}
+
+	return h.requests
+}
+
+// Sendet als Diktator einen Befehl an alle Nodes und gibt dessen ID zurück
+func (h *Handle) Send(name string, value interface{}) (string, error) {
+	return h.SendTo("", name, value)
+}
+
+// Wie Send, nur die Node target führt den Befehl aus
+func (h *Handle) SendTo(target, name string, value interface{}) (string, error) {
+	cmdID := ""
+	err := h.do(func(nodeCtx *NodeContext) error {
+		if !nodeCtx.IsDictatorAlive {
+			return NotDictatorError
+		}
+
+		var err error
+		cmdID, err = nodeCtx.Dispatcher.SendTo(*nodeCtx, target, name, value)
+		return err
+	})
+
+	return cmdID, err
+}
+
+// Alle Befehle des Diktators welche noch Antworten erwarten
+func (h *Handle) InFlight() ([]InFlightCommand, error) {
+	cmds := []InFlightCommand{}
+	err := h.do(func(nodeCtx *NodeContext) error {
+		cmds = nodeCtx.Dispatcher.InFlight()
+		return nil
+	})
+
+	return cmds, err
+}
+
+// Der Befehl id mit allen bisherigen Antworten
+func (h *Handle) Command(id string) (InFlightCommand, bool, error) {
+	cmd := InFlightCommand{}
+	ok := false
+	err := h.do(func(nodeCtx *NodeContext) error {
+		cmd, ok = nodeCtx.Dispatcher.Command(id)
+		return nil
+	})
+
+	return cmd, ok, err
+}
+
+// Der Diktator dankt ab ohne herunterzufahren. Die übrigen Nodes wählen
+// sofort einen Nachfolger, die Node selbst wartet die normale Wahlzeit ab.
+func (h *Handle) StepDown() error {
+	return h.do(func(nodeCtx *NodeContext) error {
+		if !nodeCtx.IsDictatorAlive {
+			return NotDictatorError
+		}
+
+		nodeCtx.stepDown()
+		nodeCtx.Handle.campaign()
+
+		packet, err := NewAbdicationPacket(nodeCtx.NodeID, "")
+		if err != nil {
+			return err
+		}
+		nodeCtx.UDPOut <- packet
+
+		timeout, err := ElectionTimeout(nodeCtx.Mission.Leadership)
+		if err != nil {
+			return err
+		}
+		nodeCtx.ResetElection(timeout)
+
+		return nil
+	})
+}
+
+// Die Node bewirbt sich sofort als Diktator
+func (h *Handle) Elect() error {
+	return h.do(func(nodeCtx *NodeContext) error {
+		if nodeCtx.Mission.Leadership.Ineligible {
+			return IneligibleError
+		}
+		if nodeCtx.IsDictatorAlive {
+			return nil
+		}
+
+		nodeCtx.ResetElection(0)
+		return nil
+	})
+}
+
+// Alle Nodes von welchen bisher ein Paket empfangen wurde, nach ID
+// sortiert
+func (h *Handle) Members() []Member {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	members := make([]Member, 0, len(h.members))
+	for _, m := range h.members {
+		members = append(members, m)
+	}
+	sort.Slice(members, func(i, j int) bool {
+		return members[i].ID < members[j].ID
+	})
+
+	return members
+}
+
+// Ein leerer name behält den zuletzt empfangenen Namen bei, Befehle und
+// Abdankungen enthalten keinen.
+func (h *Handle) seen(id, name string, dictator bool) {
+	if h == nil || id == "" || id == h.nodeID {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	if dictator {
+		for mID, m := range h.members {
+			m.Dictator = false
+			h.members[mID] = m
+		}
+	}
+
+	if name == "" {
+		name = h.members[id].Name
+	}
+	h.members[id] = Member{
+		ID:       id,
+		Name:     name,
+		LastSeen: time.Now(),
+		Dictator: dictator,
+	}
+}
@@ -0,0 +1,130 @@
+package dictator
+
+import (
+	"errors"
+	"testing"
+	"time"
+)
+
+func waitForState(t *testing.T, c <-chan Transition, state NodeState) {
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case tr := <-c:
+			if tr.To == state {
+				return
+			}
+		case <-timeout:
+			t.Fatal("Expect state", state)
+		}
+	}
+}
+
+func Test_Handle_Control(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	udpIn := make(chan UDPPacket)
+	udpOut := make(chan UDPPacket, 10)
+	packets := make(chan DictatorPayload, 100)
+	go func() {
+		for p := range udpOut {
+			payload, err := ReadDictatorPayload(p)
+			if err == nil && !IsHeartbeat(payload) {
+				packets <- payload
+			}
+		}
+	}()
+
+	specs := MissionSpecs{
+		Mission:      func(NodeContext) {},
+		ResponseChan: make(ResponseChan, 10),
+		// Die Wahl selbst wird über Elect ausgelöst
+		Leadership: Leadership{Priority: 0},
+	}
+	h, err := Node(ctx, udpIn, udpOut, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := h.Subscribe()
+
+	_, err = h.Send("test", nil)
+	if !errors.Is(err, NotDictatorError) {
+		t.Fatal("Expect", NotDictatorError, "was", err)
+	}
+
+	err = h.Elect()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, c, StateDictator)
+
+	cmdID, err := h.Send("test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := <-packets
+	if !IsCommand(p) {
+		t.Fatal("Expect a command was", p.Type)
+	}
+
+	cmds, err := h.InFlight()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cmds) != 1 || cmds[0].ID != cmdID {
+		t.Fatal("Expect command", cmdID, "in flight was", cmds)
+	}
+
+	resp, err := newCommandResponsePacket(h.NodeID(), TraceContext{}, CommandResponseBlob{
+		CommandID: cmdID,
+		NodeID:    "2",
+		Status:    StatusOK,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	udpIn <- resp
+	<-specs.ResponseChan
+
+	members := h.Members()
+	if len(members) != 1 || members[0].ID != "2" || members[0].Dictator {
+		t.Fatal("Expect follower 2 was", members)
+	}
+
+	err = h.StepDown()
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForState(t, c, StateCandidate)
+	p = <-packets
+	if !IsAbdication(p) {
+		t.Fatal("Expect an abdication was", p.Type)
+	}
+
+	ctx.Done()
+	waitForState(t, c, StateShuttingDown)
+	_, err = h.Send("test", nil)
+	if !errors.Is(err, NodeStoppedError) {
+		t.Fatal("Expect", NodeStoppedError, "was", err)
+	}
+}
+
+func Test_Handle_ElectIneligible(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	specs := MissionSpecs{
+		Mission:    func(NodeContext) {},
+		Leadership: Leadership{Ineligible: true},
+	}
+	h, err := Node(ctx, make(chan UDPPacket), make(chan UDPPacket), specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = h.Elect()
+	if !errors.Is(err, IneligibleError) {
+		t.Fatal("Expect", IneligibleError, "was", err)
+	}
+}
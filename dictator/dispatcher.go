@@ -0,0 +1,223 @@
+package dictator
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	// Verschickt die Befehle eines Diktators und merkt sich diese, damit
+	// die Antworten dem Befehl zugeordnet werden können. Da ein Befehl
+	// von allen Nodes beantwortet wird, bleibt er bis zum Ablauf von TTL
+	// offen.
+	Dispatcher struct {
+		TTL      time.Duration
+		mutex    *sync.Mutex
+		inFlight map[string]InFlightCommand
+	}
+
+	InFlightCommand struct {
+		ID   string
+		Name string
+		// Leer wenn der Befehl an alle Nodes ging
+		Target string
+		Sent   time.Time
+		// Anzahl der bisher erhaltenen Antworten
+		Responses int
+		// Die letzte Antwort jeder Node, ein Zwischenergebnis wird durch
+		// die endgültige Antwort ersetzt
+		Results []CommandResult
+		// Der Versand des Befehls, alle Antworten gehören zu diesem Trace
+		Trace TraceContext
+	}
+
+	CommandResult struct {
+		NodeID   string
+		NodeName string
+		Status   int
+		Result   interface{}
+		Error    string
+		Received time.Time
+	}
+)
+
+func NewDispatcher(ttl time.Duration) *Dispatcher {
+	return &Dispatcher{
+		TTL:      ttl,
+		mutex:    &sync.Mutex{},
+		inFlight: map[string]InFlightCommand{},
+	}
+}
+
+// Sendet den Befehl name an alle Nodes und gibt dessen ID zurück. Ohne
+// Dispatcher wird der Befehl nur gesendet.
+func (d *Dispatcher) Send(nCtx NodeContext, name string, value interface{}) (string, error) {
+	return d.SendTo(nCtx, "", name, value)
+}
+
+// Wie Send, nur die Node target führt den Befehl aus
+func (d *Dispatcher) SendTo(nCtx NodeContext, target, name string, value interface{}) (string, error) {
+	cmdID, err := NewCommandID()
+	if err != nil {
+		return "", err
+	}
+
+	span := StartSpan(TraceContext{}, "send "+name, nCtx.NodeID)
+	span = commandSpanAttributes(span, name, cmdID)
+
+	packet, err := newCommandPacket(nCtx.NodeID, span.Context(), CommandBlob{
+		ID:     cmdID,
+		Name:   name,
+		Value:  value,
+		Target: target,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if d != nil {
+		d.mutex.Lock()
+		d.clean()
+		d.inFlight[cmdID] = InFlightCommand{
+			ID:     cmdID,
+			Name:   name,
+			Target: target,
+			Sent:   time.Now(),
+			Trace:  span.Context(),
+		}
+		d.mutex.Unlock()
+	}
+
+	nCtx.AppContext.metrics().CommandSent(name)
+	nCtx.UDPOut <- packet
+	nCtx.AppContext.exportSpan(span, nil)
+
+	return cmdID, nil
+}
+
+// Alle Befehle deren TTL noch nicht abgelaufen ist
+func (d *Dispatcher) InFlight() []InFlightCommand {
+	if d == nil {
+		return []InFlightCommand{}
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clean()
+
+	cmds := []InFlightCommand{}
+	for _, c := range d.inFlight {
+		cmds = append(cmds, c.copy())
+	}
+
+	return cmds
+}
+
+// Der Befehl id solange dessen TTL nicht abgelaufen ist
+func (d *Dispatcher) Command(id string) (InFlightCommand, bool) {
+	if d == nil {
+		return InFlightCommand{}, false
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+	d.clean()
+
+	cmd, ok := d.inFlight[id]
+	return cmd.copy(), ok
+}
+
+func (c InFlightCommand) copy() InFlightCommand {
+	results := make([]CommandResult, len(c.Results))
+	copy(results, c.Results)
+	c.Results = results
+
+	return c
+}
+
+func (c *InFlightCommand) addResult(r CommandResult) {
+	for i, old := range c.Results {
+		if old.NodeID == r.NodeID {
+			c.Results[i] = r
+			return
+		}
+	}
+
+	c.Results = append(c.Results, r)
+}
+
+// Ordnet eine CommandResponse ihrem Befehl zu und zählt diese. Gibt den
+// Namen des Befehls zurück, falls dieser bekannt ist.
+func (d *Dispatcher) Response(nCtx NodeContext, payload DictatorPayload) (string, bool) {
+	if d == nil {
+		return "", false
+	}
+
+	blob := CommandResponseBlob{}
+	err := bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return "", false
+	}
+
+	d.mutex.Lock()
+	cmd, ok := d.inFlight[blob.CommandID]
+	if ok {
+		if blob.Status != StatusProgress {
+			cmd.Responses = cmd.Responses + 1
+		}
+		cmd.addResult(CommandResult{
+			NodeID:   blob.NodeID,
+			NodeName: blob.NodeName,
+			Status:   blob.Status,
+			Result:   blob.Result,
+			Error:    blob.Error,
+			Received: time.Now(),
+		})
+		d.inFlight[blob.CommandID] = cmd
+	}
+	d.mutex.Unlock()
+	if !ok {
+		return "", false
+	}
+
+	// Die Antwort gehört zur Ausführung auf der Node, fehlt diese zum
+	// Versand
+	parent := payload.Trace
+	if !parent.IsValid() || parent.TraceID != cmd.Trace.TraceID {
+		parent = cmd.Trace
+	}
+	span := StartSpan(parent, "response "+cmd.Name, nCtx.NodeID)
+	span = commandSpanAttributes(span, cmd.Name, cmd.ID)
+	span.Attributes[logging.KeyNode] = blob.NodeID
+	span.Attributes["status"] = strconv.Itoa(blob.Status)
+
+	var respErr error
+	m := nCtx.AppContext.metrics()
+	switch blob.Status {
+	case StatusProgress:
+	case StatusOK:
+		m.CommandAcked(cmd.Name)
+	default:
+		m.CommandFailed(cmd.Name)
+		respErr = NewCommandError(blob.Status, blob.Error)
+	}
+	nCtx.AppContext.exportSpan(span, respErr)
+
+	return cmd.Name, true
+}
+
+func (d *Dispatcher) clean() {
+	if d.TTL <= 0 {
+		return
+	}
+
+	for id, c := range d.inFlight {
+		if time.Since(c.Sent) > d.TTL {
+			delete(d.inFlight, id)
+		}
+	}
+}
@@ -0,0 +1,173 @@
+package dictator
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+type testMetrics struct {
+	NoopMetrics
+	mutex  *sync.Mutex
+	sent   map[string]int
+	acked  map[string]int
+	failed map[string]int
+	won    int
+}
+
+func newTestMetrics() *testMetrics {
+	return &testMetrics{
+		mutex:  &sync.Mutex{},
+		sent:   map[string]int{},
+		acked:  map[string]int{},
+		failed: map[string]int{},
+	}
+}
+
+func (m *testMetrics) CommandSent(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.sent[name]++
+}
+
+func (m *testMetrics) CommandAcked(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.acked[name]++
+}
+
+func (m *testMetrics) CommandFailed(name string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.failed[name]++
+}
+
+func (m *testMetrics) ElectionWon() {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.won++
+}
+
+func Test_Dispatcher_Responses(t *testing.T) {
+	m := newTestMetrics()
+	ctx := NewContext()
+	defer ctx.Done()
+	ctx.Metrics = m
+
+	udpOut := make(chan UDPPacket, 1)
+	nCtx := NodeContext{
+		NodeID:     "1",
+		AppContext: ctx,
+		UDPOut:     udpOut,
+	}
+	d := NewDispatcher(time.Minute)
+
+	cmdID, err := d.Send(nCtx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-udpOut
+
+	if m.sent["test"] != 1 {
+		t.Fatal("Expect 1 sent command was", m.sent["test"])
+	}
+
+	for _, s := range []int{StatusProgress, StatusOK, StatusHandlerError} {
+		name, ok := d.Response(nCtx, readTestPayload(t, makeTestResponsePacket(t, cmdID, s)))
+		if !ok || name != "test" {
+			t.Fatal("Expect response to test was", name, ok)
+		}
+	}
+
+	if m.acked["test"] != 1 || m.failed["test"] != 1 {
+		t.Fatal("Expect 1 acked and 1 failed was", m.acked["test"], m.failed["test"])
+	}
+
+	cmds := d.InFlight()
+	if len(cmds) != 1 || cmds[0].Responses != 2 {
+		t.Fatal("Expect 1 command with 2 responses was", cmds)
+	}
+
+	_, ok := d.Response(nCtx, readTestPayload(t, makeTestResponsePacket(t, "unknown", StatusOK)))
+	if ok {
+		t.Fatal("Expect unknown command to be ignored")
+	}
+}
+
+func Test_Dispatcher_TTL(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nCtx := NodeContext{
+		NodeID:     "1",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+	}
+	defer nCtx.AppContext.Done()
+	d := NewDispatcher(10 * time.Millisecond)
+
+	cmdID, err := d.Send(nCtx, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-udpOut
+
+	time.Sleep(20 * time.Millisecond)
+
+	if len(d.InFlight()) != 0 {
+		t.Fatal("Expect no command in flight after the TTL")
+	}
+
+	_, ok := d.Response(nCtx, readTestPayload(t, makeTestResponsePacket(t, cmdID, StatusOK)))
+	if ok {
+		t.Fatal("Expect expired command to be ignored")
+	}
+}
+
+func Test_Dispatcher_Results(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nCtx := NodeContext{
+		NodeID:     "1",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+	}
+	defer nCtx.AppContext.Done()
+	d := NewDispatcher(time.Minute)
+
+	cmdID, err := d.SendTo(nCtx, "2", "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := readTestPayload(t, <-udpOut)
+	blob := CommandBlob{}
+	err = bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.Target != "2" {
+		t.Fatal("Expect target 2 was", blob.Target)
+	}
+
+	d.Response(nCtx, readTestPayload(t, makeTestResponsePacket(t, cmdID, StatusProgress)))
+	d.Response(nCtx, readTestPayload(t, makeTestResponsePacket(t, cmdID, StatusOK)))
+
+	cmd, ok := d.Command(cmdID)
+	if !ok {
+		t.Fatal("Expect command", cmdID)
+	}
+	if cmd.Target != "2" || len(cmd.Results) != 1 || cmd.Results[0].Status != StatusOK {
+		t.Fatal("Expect 1 successful result of node 2 was", cmd)
+	}
+
+	// Die Kopie darf den Dispatcher nicht verändern
+	cmd.Results[0].Status = StatusRejected
+	cmd, _ = d.Command(cmdID)
+	if cmd.Results[0].Status != StatusOK {
+		t.Fatal("Expect", StatusOK, "was", cmd.Results[0].Status)
+	}
+
+	_, ok = d.Command("unknown")
+	if ok {
+		t.Fatal("Expect unknown command to be missing")
+	}
+}
@@ -0,0 +1,53 @@
+package dictator
+
+import (
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Baut einen Befehl des Diktators dictatorID
+func makeTestCommandPacket(t *testing.T, dictatorID, name string, value interface{}) UDPPacket {
+	packet, err := NewCommandPacket(dictatorID, name, value)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return packet
+}
+
+// Baut die Antwort der Node 2 auf den Befehl cmdID an den Diktator 1
+func makeTestResponsePacket(t *testing.T, cmdID string, status int) UDPPacket {
+	packet, err := newCommandResponsePacket("1", TraceContext{}, CommandResponseBlob{
+		CommandID: cmdID,
+		NodeID:    "2",
+		Status:    status,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return packet
+}
+
+func readTestPayload(t *testing.T, packet UDPPacket) DictatorPayload {
+	payload, err := ReadDictatorPayload(packet)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return payload
+}
+
+// Liest die Antwort einer Node aus packet
+func readTestCommandResponse(t *testing.T, packet UDPPacket) CommandResponseBlob {
+	dPayload := readTestPayload(t, packet)
+
+	resp := CommandResponseBlob{}
+	err := bson.Unmarshal(dPayload.Blob, &resp)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return resp
+}
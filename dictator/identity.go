@@ -0,0 +1,18 @@
+package dictator
+
+// Längere Namen würden jeden Heartbeat unnötig aufblähen
+const MaxNodeNameLength = 64
+
+// Wer die Node ist. Bleibt die ID über einen Neustart gleich, erkennt der
+// Cluster die Node wieder.
+type Identity struct {
+	// Ohne ID erzeugt Node eine zufällige, siehe NewNodeID
+	ID string
+	// Optionaler lesbarer Name, wird mit Heartbeats und Antworten gesendet
+	Name string
+}
+
+// Name der Node, leer wenn keiner gesetzt ist
+func (h *Handle) Name() string {
+	return h.name
+}
@@ -0,0 +1,114 @@
+package dictator
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_Node_Identity(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	udpOut := make(chan UDPPacket, 10)
+	specs := MissionSpecs{
+		Mission:  func(NodeContext) {},
+		Identity: Identity{ID: "gw-1", Name: "gateway"},
+	}
+	h, err := Node(ctx, make(chan UDPPacket), udpOut, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.NodeID() != "gw-1" || h.Name() != "gateway" {
+		t.Fatal("Expect gw-1 gateway was", h.NodeID(), h.Name())
+	}
+
+	err = h.Elect()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	timeout := time.After(3 * time.Second)
+	for {
+		select {
+		case p := <-udpOut:
+			payload, err := ReadDictatorPayload(p)
+			if err != nil || !IsHeartbeat(payload) {
+				continue
+			}
+			if payload.DictatorID != "gw-1" {
+				t.Fatal("Expect gw-1 was", payload.DictatorID)
+			}
+			hb := ReadHeartbeat(payload)
+			if hb.Name != "gateway" {
+				t.Fatal("Expect gateway was", hb.Name)
+			}
+			return
+		case <-timeout:
+			t.Fatal("Expect a heartbeat")
+		}
+	}
+}
+
+func Test_SendCommandResponse_NodeName(t *testing.T) {
+	nCtx := NodeContext{
+		NodeID:  "2",
+		UDPOut:  make(chan UDPPacket, 1),
+		Mission: MissionSpecs{Identity: Identity{ID: "2", Name: "beta"}},
+	}
+
+	err := SendCommandResponse(nCtx, DictatorPayload{DictatorID: "1"}, StatusOK, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := readTestPayload(t, <-nCtx.UDPOut)
+	blob := CommandResponseBlob{}
+	err = bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if blob.NodeID != "2" || blob.NodeName != "beta" {
+		t.Fatal("Expect node 2 beta was", blob.NodeID, blob.NodeName)
+	}
+}
+
+// Der Name übersteht den Weg vom Follower zum Diktator
+func Test_ReadCommandResult_NodeName(t *testing.T) {
+	nCtx := NodeContext{
+		NodeID:  "2",
+		UDPOut:  make(chan UDPPacket, 1),
+		Mission: MissionSpecs{Identity: Identity{ID: "2", Name: "beta"}},
+	}
+
+	err := SendCommandResponse(nCtx, DictatorPayload{DictatorID: "1"}, StatusOK, testCmdResult{Applied: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	result := testCmdResult{}
+	resp, err := ReadCommandResult(readTestPayload(t, <-nCtx.UDPOut), &result)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.NodeID != "2" || resp.NodeName != "beta" {
+		t.Fatal("Expect node 2 beta was", resp.NodeID, resp.NodeName)
+	}
+	if !result.Applied {
+		t.Fatal("Expect result to be applied")
+	}
+}
+
+func Test_Handle_SeenKeepsName(t *testing.T) {
+	h := NewHandle("1")
+
+	h.seen("2", "alpha", true)
+	// Befehle und Abdankungen enthalten keinen Namen
+	h.seen("2", "", false)
+
+	members := h.Members()
+	if len(members) != 1 || members[0].Name != "alpha" || members[0].Dictator {
+		t.Fatal("Expect follower 2 named alpha was", members)
+	}
+}
@@ -0,0 +1,180 @@
+package dictator
+
+import (
+	"fmt"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Standardwerte falls Leadership keine Zeiten vorgibt
+const (
+	DefaultElectionTimeoutMin = 500 * time.Millisecond
+	DefaultElectionTimeoutMax = 1500 * time.Millisecond
+	DefaultHeartbeatMin       = 100 * time.Millisecond
+	DefaultHeartbeatMax       = 150 * time.Millisecond
+)
+
+type (
+	// Legt fest ob und wie bevorzugt eine Node zum Diktator wird
+	Leadership struct {
+		// Nodes mit höherer Priorität warten kürzer bis sie Diktator
+		// werden und übernehmen von Diktatoren mit niedrigerer Priorität
+		Priority int
+		// Die Node wird niemals Diktator
+		Ineligible bool
+		// Bereich aus dem der Timeout bis zur Wahl gewählt wird. Muss
+		// größer als der Abstand der Heartbeats sein.
+		ElectionTimeoutMin time.Duration
+		ElectionTimeoutMax time.Duration
+		// Bereich aus dem der Abstand der Heartbeats gewählt wird
+		HeartbeatMin time.Duration
+		HeartbeatMax time.Duration
+	}
+
+	// Wird mit jedem Heartbeat des Diktators gesendet
+	HeartbeatBlob struct {
+		Priority int
+		Term     int
+		// Name des Diktators, siehe Identity
+		Name string `bson:",omitempty"`
+	}
+)
+
+// Zufälliger Timeout nach dem eine Node ohne Heartbeat zum Diktator wird.
+// Der Bereich, ohne Angabe 500-1500ms, wird durch Priority+1 geteilt.
+// Das Minimum bleibt dabei über dem Abstand der Heartbeats, sonst wählt
+// sich die Node zwischen zwei Heartbeats des Diktators.
+func ElectionTimeout(l Leadership) (time.Duration, error) {
+	min, max := l.priorityElectionRange()
+	_, hMax := l.heartbeatRange()
+
+	minMs := int(min.Milliseconds())
+	if limit := int(hMax.Milliseconds()) + 1; minMs < limit {
+		minMs = limit
+	}
+	maxMs := int(max.Milliseconds())
+	if maxMs <= minMs {
+		maxMs = minMs + 1
+	}
+
+	return NewRandomTimeout(minMs, maxMs)
+}
+
+// Zufälliger Abstand der Heartbeats, ohne Angabe 100-150ms
+func HeartbeatInterval(l Leadership) (time.Duration, error) {
+	min, max := l.heartbeatRange()
+	return NewRandomTimeout(int(min.Milliseconds()), int(max.Milliseconds()))
+}
+
+// Prüft ob die Zeiten zueinander passen
+func (l Leadership) Validate() error {
+	if l.Priority < 0 {
+		return fmt.Errorf("Priority must not be negative, was %v", l.Priority)
+	}
+
+	eMin, eMax := l.electionRange()
+	hMin, hMax := l.heartbeatRange()
+	if eMin < time.Millisecond || hMin < time.Millisecond {
+		return fmt.Errorf("Election timeout and heartbeat interval must be at least 1ms")
+	}
+	if eMax <= eMin {
+		return fmt.Errorf("Election timeout max %v must be greater than min %v", eMax, eMin)
+	}
+	if hMax <= hMin {
+		return fmt.Errorf("Heartbeat max %v must be greater than min %v", hMax, hMin)
+	}
+
+	// Sonst wählen sich Nodes ohne Priorität zwischen zwei Heartbeats
+	if eMin <= hMax {
+		return fmt.Errorf("Election timeout min %v must be greater than heartbeat max %v", eMin, hMax)
+	}
+
+	// Die Priorität darf den Bereich nur so weit verkürzen, dass er über
+	// den Heartbeats liegt und nicht leer wird
+	pMin, pMax := l.priorityElectionRange()
+	if pMin.Truncate(time.Millisecond) <= hMax {
+		return fmt.Errorf("Priority %v lowers the election timeout min to %v, must be greater than heartbeat max %v", l.Priority, pMin, hMax)
+	}
+	if pMax.Truncate(time.Millisecond) <= pMin.Truncate(time.Millisecond) {
+		return fmt.Errorf("Priority %v leaves no election timeout range", l.Priority)
+	}
+
+	return nil
+}
+
+func (l Leadership) electionRange() (time.Duration, time.Duration) {
+	if l.ElectionTimeoutMin == 0 && l.ElectionTimeoutMax == 0 {
+		return DefaultElectionTimeoutMin, DefaultElectionTimeoutMax
+	}
+
+	return l.ElectionTimeoutMin, l.ElectionTimeoutMax
+}
+
+// Der Bereich der Wahl geteilt durch Priority+1
+func (l Leadership) priorityElectionRange() (time.Duration, time.Duration) {
+	min, max := l.electionRange()
+	if l.Priority <= 0 {
+		return min, max
+	}
+
+	div := time.Duration(l.Priority + 1)
+	return min / div, max / div
+}
+
+func (l Leadership) heartbeatRange() (time.Duration, time.Duration) {
+	if l.HeartbeatMin == 0 && l.HeartbeatMax == 0 {
+		return DefaultHeartbeatMin, DefaultHeartbeatMax
+	}
+
+	return l.HeartbeatMin, l.HeartbeatMax
+}
+
+// Prüft ob ein Diktator mit Priorität a einem Diktator mit Priorität b
+// vorgezogen wird. Bei gleicher Priorität dankt wie bisher der Diktator
+// ab, welcher den Heartbeat des anderen empfängt.
+func Outranks(a, b int) bool {
+	return a > b
+}
+
+func NewHeartbeatPacket(dictatorID string, heartbeatBlob HeartbeatBlob) (UDPPacket, error) {
+	blob, err := bson.Marshal(heartbeatBlob)
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	heartbeat := DictatorPayload{
+		Type:       1,
+		DictatorID: dictatorID,
+		Blob:       blob,
+	}
+	p, err := bson.Marshal(heartbeat)
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	return UDPPacket{Payload: p}, nil
+}
+
+// Heartbeats älterer Diktatoren haben keinen Blob, diese erhalten die
+// Priorität 0.
+func ReadHeartbeat(payload DictatorPayload) HeartbeatBlob {
+	blob := HeartbeatBlob{}
+	err := bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return HeartbeatBlob{}
+	}
+
+	return blob
+}
+
+// Setzt den Timer für die nächste Wahl. Nodes die nicht Diktator werden
+// dürfen stoppen den Timer nur.
+func (nodeCtx NodeContext) ResetElection(timeout time.Duration) {
+	if nodeCtx.Mission.Leadership.Ineligible {
+		nodeCtx.BecomeDictator.Stop()
+		return
+	}
+
+	nodeCtx.BecomeDictator.Reset(timeout)
+}
@@ -0,0 +1,236 @@
+package dictator
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_ElectionTimeout_Priority(t *testing.T) {
+	for x := 0; x < 20; x++ {
+		timeout, err := ElectionTimeout(Leadership{Priority: 2})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timeout >= 500*time.Millisecond {
+			t.Fatal("Expect timeout below 500ms was", timeout)
+		}
+	}
+}
+
+func Test_ElectionTimeout_Custom(t *testing.T) {
+	l := Leadership{
+		ElectionTimeoutMin: 2 * time.Second,
+		ElectionTimeoutMax: 3 * time.Second,
+	}
+	for x := 0; x < 20; x++ {
+		timeout, err := ElectionTimeout(l)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timeout < 2*time.Second || timeout >= 3*time.Second {
+			t.Fatal("Expect timeout between 2s and 3s was", timeout)
+		}
+	}
+}
+
+// Auch ohne Validate bleibt der Timeout über den Heartbeats und der
+// Bereich nie leer
+func Test_ElectionTimeout_Clamped(t *testing.T) {
+	for _, priority := range []int{3, 9, 1500, 100000} {
+		timeout, err := ElectionTimeout(Leadership{Priority: priority})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if timeout <= DefaultHeartbeatMax {
+			t.Fatal("Expect timeout above", DefaultHeartbeatMax, "was", timeout, "for", priority)
+		}
+	}
+}
+
+func Test_Leadership_Validate(t *testing.T) {
+	tests := []struct {
+		L  Leadership
+		OK bool
+	}{
+		{Leadership{}, true},
+		{Leadership{Priority: 2}, true},
+		// 500ms / 4 liegt unter den Heartbeats von 150ms
+		{Leadership{Priority: 3}, false},
+		{Leadership{Priority: 1500}, false},
+		{Leadership{ElectionTimeoutMin: 5 * time.Second, ElectionTimeoutMax: 10 * time.Second, Priority: 9}, true},
+		{Leadership{Priority: -1}, false},
+		{Leadership{ElectionTimeoutMin: time.Second, ElectionTimeoutMax: time.Second}, false},
+		{Leadership{ElectionTimeoutMin: 100 * time.Millisecond, ElectionTimeoutMax: time.Second}, false},
+		{Leadership{HeartbeatMin: 50 * time.Millisecond, HeartbeatMax: 80 * time.Millisecond}, true},
+		{Leadership{HeartbeatMin: 80 * time.Millisecond}, false},
+	}
+
+	for _, test := range tests {
+		err := test.L.Validate()
+		if (err == nil) != test.OK {
+			t.Fatal("Expect valid", test.OK, "for", test.L, "was", err)
+		}
+	}
+}
+
+func Test_DecideElection(t *testing.T) {
+	m := newTestMetrics()
+	ctx := NewContext()
+	defer ctx.Done()
+	ctx.Metrics = m
+
+	nodeCtx := NodeContext{
+		AppContext:      ctx,
+		SuicideChan:     make(chan struct{}, 1),
+		IsDictatorAlive: true,
+		electionDecided: make(chan time.Time),
+	}
+	nodeCtx.decideElection()
+	if m.won != 1 || nodeCtx.electionDecided != nil {
+		t.Fatal("Expect an uncontested election to be won was", m.won)
+	}
+
+	// Ein Rivale übernimmt bevor die Wahl entschieden ist
+	nodeCtx.electionDecided = make(chan time.Time)
+	nodeCtx.stepDown()
+	nodeCtx.decideElection()
+	if m.won != 1 || nodeCtx.electionDecided != nil {
+		t.Fatal("Expect a contested election not to count was", m.won)
+	}
+}
+
+func Test_Outranks_OK(t *testing.T) {
+	if !Outranks(2, 1) {
+		t.Fatal("Expect higher priority to win")
+	}
+
+	if Outranks(1, 2) {
+		t.Fatal("Expect lower priority to lose")
+	}
+
+	if Outranks(1, 1) {
+		t.Fatal("Expect to step down on a tie")
+	}
+}
+
+func Test_ReadHeartbeat_OK(t *testing.T) {
+	packet, err := NewHeartbeatPacket("1", HeartbeatBlob{Priority: 3})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	payload := readTestPayload(t, packet)
+
+	if !IsHeartbeat(payload) {
+		t.Fatal("Expect to be a heartbeat")
+	}
+
+	if ReadHeartbeat(payload).Priority != 3 {
+		t.Fatal("Expect", 3, "was", ReadHeartbeat(payload).Priority)
+	}
+
+	// Heartbeat ohne Blob
+	if ReadHeartbeat(DictatorPayload{Type: 1}).Priority != 0 {
+		t.Fatal("Expect priority 0")
+	}
+}
+
+// Eine Node die nicht Diktator werden darf startet keine Wahl
+func Test_HandleHeartbeat_Ineligible(t *testing.T) {
+	nodeCtx := NodeContext{
+		NodeID:         "2",
+		AppContext:     NewContext(),
+		BecomeDictator: time.NewTimer(1 * time.Hour),
+		Mission: MissionSpecs{
+			Leadership: Leadership{Ineligible: true},
+		},
+	}
+
+	packet, err := NewAbdicationPacket("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-nodeCtx.BecomeDictator.C:
+		t.Fatal("Expect not to become dictator")
+	case <-time.After(100 * time.Millisecond):
+	}
+}
+
+// Eine Node mit höherer Priorität übernimmt vom Diktator
+func Test_HandleHeartbeat_TakeOver(t *testing.T) {
+	nodeCtx := NodeContext{
+		NodeID:         "2",
+		AppContext:     NewContext(),
+		BecomeDictator: time.NewTimer(1 * time.Hour),
+		Mission: MissionSpecs{
+			Leadership: Leadership{Priority: 1},
+		},
+	}
+
+	packet, err := NewHeartbeatPacket("1", HeartbeatBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-nodeCtx.BecomeDictator.C:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Expect to take over")
+	}
+}
+
+// Ein Diktator mit höherer Priorität bleibt im Amt
+func Test_HandleHeartbeat_DictatorStays(t *testing.T) {
+	suicide := make(chan struct{}, 1)
+	nodeCtx := NodeContext{
+		NodeID:          "2",
+		AppContext:      NewContext(),
+		BecomeDictator:  time.NewTimer(1 * time.Hour),
+		SuicideChan:     suicide,
+		IsDictatorAlive: true,
+		Mission: MissionSpecs{
+			Leadership: Leadership{Priority: 1},
+		},
+	}
+
+	packet, err := NewHeartbeatPacket("1", HeartbeatBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suicide) != 0 || !nodeCtx.IsDictatorAlive {
+		t.Fatal("Expect dictator to stay alive")
+	}
+
+	// Ein höherer Diktator übernimmt
+	packet, err = NewHeartbeatPacket("1", HeartbeatBlob{Priority: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(suicide) != 1 || nodeCtx.IsDictatorAlive {
+		t.Fatal("Expect dictator to die")
+	}
+}
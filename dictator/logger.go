@@ -1,21 +1,18 @@
 package dictator
 
 import (
-	"io"
-	"log"
+	"log/slog"
+
+	"github.com/rrawrriw/ite/logging"
 )
 
-type Logger struct {
-	Error *log.Logger
-	Debug *log.Logger
+// Ohne Log im Context wird slog.Default verwendet
+func (c Context) log() *slog.Logger {
+	return logging.Or(c.Log)
 }
 
-func NewLogger(errWriter, debugWriter io.Writer) Logger {
-
-	l := Logger{
-		Error: log.New(errWriter, "Error: ", log.LstdFlags|log.Lshortfile),
-		Debug: log.New(debugWriter, "Debug: ", log.LstdFlags|log.Lshortfile),
-	}
-
-	return l
+// Der Logger des AppContext ergänzt um die aktuelle Amtszeit. Die Node ID
+// setzt bereits Node.
+func (nodeCtx NodeContext) log() *slog.Logger {
+	return nodeCtx.AppContext.log().With(logging.KeyTerm, nodeCtx.Handle.Term())
 }
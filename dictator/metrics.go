@@ -0,0 +1,51 @@
+package dictator
+
+import "time"
+
+type (
+	// Wird von der Node bei allen wichtigen Ereignissen aufgerufen. Die
+	// Implementierung muss von mehreren goroutines nutzbar sein.
+	Metrics interface {
+		// Die Node wird Kandidat und ernennt sich zum Diktator
+		ElectionStarted()
+		// Die Node ist eine Wahl lang ohne Rivalen Diktator geblieben
+		ElectionWon()
+		// Zeit die eine Node am Stück Diktator war
+		DictatorTime(d time.Duration)
+		HeartbeatSent()
+		// interval ist der Abstand zum letzten Heartbeat, jitter die
+		// Abweichung vom vorherigen Abstand
+		HeartbeatReceived(interval, jitter time.Duration)
+		// Der Diktator hat sich nicht mehr gemeldet
+		HeartbeatMissed()
+		CommandSent(name string)
+		CommandAcked(name string)
+		CommandFailed(name string)
+		HandlerLatency(name string, d time.Duration)
+		// Pakete die keine DictatorPayload enthalten
+		PacketDropped()
+	}
+
+	// Verwirft alle Werte
+	NoopMetrics struct{}
+)
+
+func (NoopMetrics) ElectionStarted()                                 {}
+func (NoopMetrics) ElectionWon()                                     {}
+func (NoopMetrics) DictatorTime(d time.Duration)                     {}
+func (NoopMetrics) HeartbeatSent()                                   {}
+func (NoopMetrics) HeartbeatReceived(interval, jitter time.Duration) {}
+func (NoopMetrics) HeartbeatMissed()                                 {}
+func (NoopMetrics) CommandSent(name string)                          {}
+func (NoopMetrics) CommandAcked(name string)                         {}
+func (NoopMetrics) CommandFailed(name string)                        {}
+func (NoopMetrics) HandlerLatency(name string, d time.Duration)      {}
+func (NoopMetrics) PacketDropped()                                   {}
+
+func (c Context) metrics() Metrics {
+	if c.Metrics == nil {
+		return NoopMetrics{}
+	}
+
+	return c.Metrics
+}
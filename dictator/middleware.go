@@ -0,0 +1,161 @@
+package dictator
+
+import (
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+)
+
+// Ein RateLimit muss mindestens einen Aufruf in einer Zeitspanne erlauben
+var InvalidRateLimitError = errors.New("Invalid rate limit")
+
+type (
+	// Entscheidet ob eine Node den Befehl ausführen darf
+	AuthorizeFunc func(NodeContext, DictatorPayload) bool
+
+	// Erlaubt Count Aufrufe eines Befehls innerhalb von Per
+	RateLimit struct {
+		Count int
+		Per   time.Duration
+	}
+
+	tokenBucket struct {
+		tokens float64
+		last   time.Time
+	}
+)
+
+// Fängt eine panic im Handler ab, damit die Node weiterläuft. Der Diktator
+// erhält eine Antwort mit dem Status StatusHandlerError.
+func RecoverMiddleware() Middleware {
+	return func(name string, next CommandHandler) CommandHandler {
+		return func(nCtx NodeContext, payload DictatorPayload) (err error) {
+			defer func() {
+				r := recover()
+				if r == nil {
+					return
+				}
+
+				errMsg := fmt.Sprintf("CommandHandler %v panics: %v", name, r)
+				nCtx.log().Error(errMsg, "stack", string(debug.Stack()))
+				err = NewCommandError(StatusHandlerError, errMsg)
+			}()
+
+			return next(nCtx, payload)
+		}
+	}
+}
+
+// Loggt Name, Dauer und Ergebnis jedes Befehls
+func LoggingMiddleware() Middleware {
+	return func(name string, next CommandHandler) CommandHandler {
+		return func(nCtx NodeContext, payload DictatorPayload) error {
+			start := time.Now()
+
+			err := next(nCtx, payload)
+
+			l := nCtx.log().With(
+				logging.KeyDictator, payload.DictatorID,
+				"duration", time.Since(start),
+			)
+			if err != nil {
+				l.Error("Command failed", logging.Err(err))
+				return err
+			}
+
+			l.Debug("Command done")
+			return nil
+		}
+	}
+}
+
+// Prüft vor jedem Befehl die passende Regel aus rules. Befehle ohne Regel
+// sind erlaubt. Wird ein Befehl abgelehnt erhält der Diktator eine Antwort
+// mit dem Status StatusRejected.
+func AuthorizeMiddleware(rules map[string]AuthorizeFunc) Middleware {
+	return func(name string, next CommandHandler) CommandHandler {
+		return func(nCtx NodeContext, payload DictatorPayload) error {
+			allow, ok := rules[name]
+			if ok && !allow(nCtx, payload) {
+				errMsg := fmt.Sprintf("Dictator %v is not allowed to run %v", payload.DictatorID, name)
+				return NewCommandError(StatusRejected, errMsg)
+			}
+
+			return next(nCtx, payload)
+		}
+	}
+}
+
+// Erlaubt einen Befehl nur den angegebenen Diktatoren
+func AllowDictators(ids ...string) AuthorizeFunc {
+	return func(nCtx NodeContext, payload DictatorPayload) bool {
+		for _, id := range ids {
+			if id == payload.DictatorID {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// Begrenzt wie oft ein Befehl ausgeführt wird. Befehle ohne Limit werden
+// nicht begrenzt. Wird das Limit überschritten erhält der Diktator eine
+// Antwort mit dem Status StatusRejected. Ein Limit mit Count oder Per
+// kleiner gleich 0 ergibt InvalidRateLimitError.
+func RateLimitMiddleware(limits map[string]RateLimit) (Middleware, error) {
+	for name, limit := range limits {
+		if limit.Count <= 0 || limit.Per <= 0 {
+			return nil, fmt.Errorf("%w: %v allows %v calls per %v", InvalidRateLimitError, name, limit.Count, limit.Per)
+		}
+	}
+
+	mutex := sync.Mutex{}
+	buckets := map[string]*tokenBucket{}
+
+	take := func(name string, limit RateLimit) bool {
+		mutex.Lock()
+		defer mutex.Unlock()
+
+		now := time.Now()
+		b, ok := buckets[name]
+		if !ok {
+			b = &tokenBucket{
+				tokens: float64(limit.Count),
+				last:   now,
+			}
+			buckets[name] = b
+		}
+
+		// Füllt den Eimer entsprechend der vergangenen Zeit wieder auf
+		refill := float64(limit.Count) * float64(now.Sub(b.last)) / float64(limit.Per)
+		b.tokens = b.tokens + refill
+		if b.tokens > float64(limit.Count) {
+			b.tokens = float64(limit.Count)
+		}
+		b.last = now
+
+		if b.tokens < 1 {
+			return false
+		}
+
+		b.tokens = b.tokens - 1
+		return true
+	}
+
+	return func(name string, next CommandHandler) CommandHandler {
+		return func(nCtx NodeContext, payload DictatorPayload) error {
+			limit, ok := limits[name]
+			if ok && !take(name, limit) {
+				errMsg := fmt.Sprintf("Rate limit for %v exceeded", name)
+				return NewCommandError(StatusRejected, errMsg)
+			}
+
+			return next(nCtx, payload)
+		}
+	}, nil
+}
@@ -0,0 +1,168 @@
+package dictator
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func Test_Use_Order(t *testing.T) {
+	calls := []string{}
+	mw := func(id string) Middleware {
+		return func(name string, next CommandHandler) CommandHandler {
+			return func(nCtx NodeContext, p DictatorPayload) error {
+				calls = append(calls, id)
+				return next(nCtx, p)
+			}
+		}
+	}
+
+	router := CommandRouter{}
+	router.Use(mw("1"), mw("2"))
+	router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+		calls = append(calls, "handler")
+		return nil
+	})
+
+	err := router.Dispatch(NodeContext{}, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := "[1 2 handler]"
+	if s := fmt.Sprint(calls); s != expect {
+		t.Fatal("Expect", expect, "was", s)
+	}
+}
+
+func Test_RecoverMiddleware_OK(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+	}
+
+	router := CommandRouter{}
+	router.Use(RecoverMiddleware())
+	router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+		panic("boom")
+	})
+
+	err := router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+	if err == nil {
+		t.Fatal("Expect Dispatch to return a error")
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusHandlerError {
+		t.Fatal("Expect", StatusHandlerError, "was", resp.Status)
+	}
+}
+
+func Test_LoggingMiddleware_OK(t *testing.T) {
+	router := CommandRouter{}
+	router.Use(LoggingMiddleware())
+	router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+		return nil
+	})
+
+	nodeCtx := NodeContext{
+		AppContext: NewContext(),
+	}
+	err := router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_AuthorizeMiddleware_Rejected(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID: "2",
+		UDPOut: udpOut,
+	}
+
+	router := CommandRouter{}
+	router.Use(AuthorizeMiddleware(map[string]AuthorizeFunc{
+		"test": AllowDictators("1"),
+	}))
+	called := 0
+	router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+		called++
+		return nil
+	})
+
+	err := router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "3", "test", nil)))
+	if err == nil {
+		t.Fatal("Expect Dispatch to return a error")
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusRejected {
+		t.Fatal("Expect", StatusRejected, "was", resp.Status)
+	}
+
+	if called != 1 {
+		t.Fatal("Expect", 1, "was", called)
+	}
+}
+
+func Test_RateLimitMiddleware_Rejected(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID: "2",
+		UDPOut: udpOut,
+	}
+
+	mw, err := RateLimitMiddleware(map[string]RateLimit{
+		"test": RateLimit{Count: 2, Per: time.Hour},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	router := CommandRouter{}
+	router.Use(mw)
+	router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+		return nil
+	})
+	router.AddHandler("free", func(NodeContext, DictatorPayload) error {
+		return nil
+	})
+
+	for x := 0; x < 2; x++ {
+		err := router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "free", nil)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = router.Dispatch(nodeCtx, readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil)))
+	if err == nil {
+		t.Fatal("Expect Dispatch to return a error")
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusRejected {
+		t.Fatal("Expect", StatusRejected, "was", resp.Status)
+	}
+}
+
+func Test_RateLimitMiddleware_Invalid(t *testing.T) {
+	for _, limit := range []RateLimit{{Count: 1}, {Per: time.Second}, {Count: -1, Per: time.Second}} {
+		_, err := RateLimitMiddleware(map[string]RateLimit{"test": limit})
+		if !errors.Is(err, InvalidRateLimitError) {
+			t.Fatal("Expect", InvalidRateLimitError, "was", err)
+		}
+	}
+}
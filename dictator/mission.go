@@ -1,6 +1,32 @@
 package dictator
 
-import "gopkg.in/mgo.v2/bson"
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Status Codes einer CommandResponse
+const (
+	StatusOK = iota + 1
+	// Die Node kennt keinen Handler für den Befehl
+	StatusUnknownCommand
+	// Der Wert des Befehls konnte nicht gelesen werden
+	StatusBadPayload
+	// Der Handler hat einen Fehler zurückgegeben
+	StatusHandlerError
+	// Der Handler wurde nicht rechtzeitig fertig
+	StatusTimeout
+	// Die Node verweigert die Ausführung des Befehls
+	StatusRejected
+	// Zwischenergebnis eines noch laufenden Befehls
+	StatusProgress
+)
 
 type (
 	MissionSpecs struct {
@@ -13,36 +39,108 @@ type (
 		// An diesen Channel werden alle CommandResponse Paket weitergeleitet
 		// Wird im allgemeien in der Mission Funktionen verwendet.
 		ResponseChan ResponseChan
+		// Wählt beim Abdanken den Nachfolger des Diktators. Ohne Funktion
+		// oder bei einer leeren ID wählen die Nodes sofort neu.
+		Successor func(NodeContext) string
+		// Priorität der Node bei der Wahl des Diktators
+		Leadership Leadership
+		// ID und Name der Node
+		Identity Identity
 	}
 
 	Mission func(NodeContext)
 
 	CommandHandler func(NodeContext, DictatorPayload) error
 
-	CommandRouter map[string]CommandHandler
+	// Verwaltet die CommandHandler und die Codecs der einzelnen Befehle.
+	// Der Nullwert ist sofort verwendbar.
+	CommandRouter struct {
+		handlers   map[string]CommandHandler
+		codecs     map[string]Codec
+		middleware []Middleware
+	}
+
+	// Eine Middleware umschließt den Handler des Befehls name. Sie wird
+	// bei jedem Aufruf von Dispatch angewendet.
+	Middleware func(name string, next CommandHandler) CommandHandler
 
 	ResponseChan chan DictatorPayload
 
 	// Gibt vor welchen Befehl die Nodes ausfürhen sollen
 	CommandBlob struct {
+		ID    string
 		Name  string
 		Value interface{}
+		// Ist Target gesetzt führt nur diese Node den Befehl aus
+		Target string `bson:",omitempty"`
 	}
 
 	// Gibt zurück ob Befehl erfolgreich ausgführt wurde
 	CommandResponseBlob struct {
-		NodeID string
+		CommandID string
+		NodeID    string
+		NodeName  string `bson:",omitempty"`
+		Status    int
+		Result    interface{}
+		// Fehlermeldung falls Status nicht StatusOK ist
+		Error string
+	}
+
+	// Bricht einen laufenden Befehl ab
+	CancelBlob struct {
+		CommandID string
+	}
+
+	// Laufzeit Informationen des gerade ausgeführten Befehls
+	CommandContext struct {
+		ID   string
+		Name string
+		// Wird geschlossen wenn der Diktator den Befehl abbricht, die
+		// Zeit abgelaufen ist oder die Node herunterfährt
+		Ctx context.Context
+		// Sendet ein Zwischenergebnis mit dem Status StatusProgress an
+		// den Diktator
+		Progress func(result interface{}) error
+
+		// Die Ausführung des Befehls auf dieser Node
+		span Span
+	}
+
+	// Kann von einem CommandHandler zurückgegeben werden um dem Diktator
+	// einen bestimmten Status zu melden. Alle anderen Fehler werden mit
+	// StatusHandlerError beantwortet.
+	CommandError struct {
 		Status int
-		Result interface{}
+		Msg    string
 	}
 )
 
-func (r CommandRouter) AddHandler(name string, fun CommandHandler) {
-	r[name] = fun
+func NewCommandError(status int, msg string) CommandError {
+	return CommandError{
+		Status: status,
+		Msg:    msg,
+	}
+}
+
+func (e CommandError) Error() string {
+	return fmt.Sprintf("Command failed with status %v: %v", e.Status, e.Msg)
+}
+
+func (r *CommandRouter) AddHandler(name string, fun CommandHandler) {
+	if r.handlers == nil {
+		r.handlers = map[string]CommandHandler{}
+	}
+	r.handlers[name] = fun
+}
+
+// Fügt Middleware hinzu. Die zuerst hinzugefügte Middleware ist die
+// äußerste und wird als erstes aufgerufen.
+func (r *CommandRouter) Use(mw ...Middleware) {
+	r.middleware = append(r.middleware, mw...)
 }
 
 func (r CommandRouter) FindHandler(name string) (CommandHandler, bool) {
-	fun, ok := r[name]
+	fun, ok := r.handlers[name]
 	if !ok {
 		return *new(CommandHandler), ok
 	}
@@ -50,26 +148,216 @@ func (r CommandRouter) FindHandler(name string) (CommandHandler, bool) {
 	return fun, true
 }
 
+// Führt den passenden Handler für den Befehl aus. Fehlt der Handler oder
+// schlägt er fehl wird dem Diktator eine CommandResponse mit dem
+// entsprechenden Status gesendet und der Fehler zurückgegeben.
+func (r CommandRouter) Dispatch(nCtx NodeContext, payload DictatorPayload) (err error) {
+	blob := CommandBlob{}
+	err = bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return SendCommandError(nCtx, payload, NewCommandError(StatusBadPayload, err.Error()))
+	}
+
+	if !blob.isFor(nCtx.NodeID) {
+		return nil
+	}
+
+	// Alle Logs des Handlers enthalten den Befehl
+	nCtx.AppContext.Log = nCtx.AppContext.log().With(
+		logging.KeyCommand, blob.Name,
+		logging.KeyCommandID, blob.ID,
+	)
+
+	if nCtx.Cmd.Ctx == nil {
+		nCtx.Cmd = NewCommandContext(context.Background(), nCtx, payload, blob)
+	}
+	defer func() {
+		nCtx.AppContext.exportSpan(nCtx.Cmd.span, err)
+	}()
+
+	fun, ok := r.FindHandler(blob.Name)
+	if !ok {
+		errMsg := fmt.Sprintf("Cannot find CommandHandler %v", blob.Name)
+		return SendCommandError(nCtx, payload, NewCommandError(StatusUnknownCommand, errMsg))
+	}
+
+	for i := len(r.middleware) - 1; i >= 0; i-- {
+		fun = r.middleware[i](blob.Name, fun)
+	}
+
+	start := time.Now()
+	err = fun(nCtx, payload)
+	nCtx.AppContext.metrics().HandlerLatency(blob.Name, time.Since(start))
+	if err != nil {
+		ctxErr := nCtx.Cmd.Ctx.Err()
+		cmdErr := CommandError{}
+		if ctxErr != nil && !errors.As(err, &cmdErr) {
+			err = commandErrorFromContext(ctxErr)
+		}
+		return SendCommandError(nCtx, payload, err)
+	}
+
+	return nil
+}
+
+func StatusText(status int) string {
+	switch status {
+	case StatusOK:
+		return "ok"
+	case StatusUnknownCommand:
+		return "unknown command"
+	case StatusBadPayload:
+		return "bad payload"
+	case StatusHandlerError:
+		return "handler error"
+	case StatusTimeout:
+		return "timeout"
+	case StatusRejected:
+		return "rejected"
+	case StatusProgress:
+		return "progress"
+	}
+
+	return "unknown"
+}
+
+func (b CommandBlob) isFor(nodeID string) bool {
+	return b.Target == "" || b.Target == nodeID
+}
+
+func NewCommandContext(ctx context.Context, nCtx NodeContext, payload DictatorPayload, blob CommandBlob) CommandContext {
+	span := StartSpan(payload.Trace, "handle "+blob.Name, nCtx.NodeID)
+	span = commandSpanAttributes(span, blob.Name, blob.ID)
+
+	progress := func(result interface{}) error {
+		packet, err := newCommandResponsePacket(payload.DictatorID, span.Context(), CommandResponseBlob{
+			CommandID: blob.ID,
+			NodeID:    nCtx.NodeID,
+			NodeName:  nCtx.Mission.Identity.Name,
+			Status:    StatusProgress,
+			Result:    result,
+		})
+		if err != nil {
+			return err
+		}
+
+		select {
+		case nCtx.UDPOut <- packet:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	return CommandContext{
+		ID:       blob.ID,
+		Name:     blob.Name,
+		Ctx:      ctx,
+		Progress: progress,
+		span:     span,
+	}
+}
+
+// Der TraceContext der Ausführung. Antworten an den Diktator werden diesem
+// zugeordnet.
+func (c CommandContext) Trace() TraceContext {
+	return c.span.Context()
+}
+
+// Antworten gehören zur Ausführung des Befehls. Konnte der Befehl nicht
+// gelesen werden direkt zu dessen Versand.
+func responseTrace(nCtx NodeContext, payload DictatorPayload) TraceContext {
+	if nCtx.Cmd.Trace().IsValid() {
+		return nCtx.Cmd.Trace()
+	}
+
+	return payload.Trace
+}
+
+func commandErrorFromContext(err error) CommandError {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return NewCommandError(StatusTimeout, err.Error())
+	}
+
+	return NewCommandError(StatusRejected, err.Error())
+}
+
+func NewCommandID() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", buf), nil
+}
+
+// Meldet dem Diktator den Fehler und gibt diesen wieder zurück, damit er
+// auf der Node geloggt werden kann.
+func SendCommandError(nCtx NodeContext, payload DictatorPayload, cmdErr error) error {
+	status := StatusHandlerError
+	e := CommandError{}
+	if errors.As(cmdErr, &e) {
+		status = e.Status
+	}
+
+	packet, err := newCommandResponsePacket(payload.DictatorID, responseTrace(nCtx, payload), CommandResponseBlob{
+		CommandID: nCtx.Cmd.ID,
+		NodeID:    nCtx.NodeID,
+		NodeName:  nCtx.Mission.Identity.Name,
+		Status:    status,
+		Error:     cmdErr.Error(),
+	})
+	if err != nil {
+		return err
+	}
+
+	select {
+	case nCtx.UDPOut <- packet:
+	case <-nCtx.AppContext.DoneChan:
+	}
+
+	return errors.New(StatusMsg(nCtx.NodeID, cmdErr))
+}
+
 func NewCommandPacket(dictatorID string, cmdName string, cmdValue interface{}) (UDPPacket, error) {
+	cmdID, err := NewCommandID()
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
 	commandBlob := CommandBlob{
+		ID:    cmdID,
 		Name:  cmdName,
 		Value: cmdValue,
 	}
 
+	// Ohne Dispatcher gibt es keinen Span für den Versand, die Nodes
+	// sollen trotzdem einen gemeinsamen Trace verwenden
+	trace := TraceContext{
+		TraceID: NewTraceID(),
+		SpanID:  NewSpanID(),
+	}
+
+	return newCommandPacket(dictatorID, trace, commandBlob)
+}
+
+func newCommandPacket(dictatorID string, trace TraceContext, commandBlob CommandBlob) (UDPPacket, error) {
 	dictatorPayloadBlob, err := bson.Marshal(commandBlob)
 	if err != nil {
-		return UDPPacket{}, nil
+		return UDPPacket{}, err
 	}
 
 	dictatorPayload := DictatorPayload{
 		Type:       2,
 		DictatorID: dictatorID,
 		Blob:       dictatorPayloadBlob,
+		Trace:      trace,
 	}
 
 	udpPayload, err := bson.Marshal(dictatorPayload)
 	if err != nil {
-		return UDPPacket{}, nil
+		return UDPPacket{}, err
 	}
 
 	packet := UDPPacket{
@@ -86,19 +374,54 @@ func NewCommandResponsePacket(dictatorID, nodeID string, respStatus int, respRes
 		Result: respResult,
 		NodeID: nodeID,
 	}
+
+	return newCommandResponsePacket(dictatorID, TraceContext{}, commandResponseBlob)
+}
+
+func NewCommandErrorResponsePacket(dictatorID, nodeID string, respStatus int, errMsg string) (UDPPacket, error) {
+	commandResponseBlob := CommandResponseBlob{
+		Status: respStatus,
+		NodeID: nodeID,
+		Error:  errMsg,
+	}
+
+	return newCommandResponsePacket(dictatorID, TraceContext{}, commandResponseBlob)
+}
+
+func NewCancelPacket(dictatorID, cmdID string) (UDPPacket, error) {
+	cancelBlob, err := bson.Marshal(CancelBlob{CommandID: cmdID})
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	dictatorPayload := DictatorPayload{
+		Type:       4,
+		DictatorID: dictatorID,
+		Blob:       cancelBlob,
+	}
+	udpPayload, err := bson.Marshal(dictatorPayload)
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	return UDPPacket{Payload: udpPayload}, nil
+}
+
+func newCommandResponsePacket(dictatorID string, trace TraceContext, commandResponseBlob CommandResponseBlob) (UDPPacket, error) {
 	commandBlob, err := bson.Marshal(commandResponseBlob)
 	if err != nil {
-		return UDPPacket{}, nil
+		return UDPPacket{}, err
 	}
 
 	dictatorPayload := DictatorPayload{
 		Type:       3,
 		Blob:       commandBlob,
 		DictatorID: dictatorID,
+		Trace:      trace,
 	}
 	udpPayload, err := bson.Marshal(dictatorPayload)
 	if err != nil {
-		return UDPPacket{}, nil
+		return UDPPacket{}, err
 	}
 
 	udpPacket := UDPPacket{
@@ -1,6 +1,8 @@
 package dictator
 
 import (
+	"errors"
+	"fmt"
 	"testing"
 
 	"gopkg.in/mgo.v2/bson"
@@ -105,3 +107,118 @@ func Test_NewCommandResponsePacket_OK(t *testing.T) {
 	}
 
 }
+
+func Test_Dispatch_UnknownCommand(t *testing.T) {
+	udpOut := make(chan UDPPacket, 1)
+	nodeCtx := NodeContext{
+		NodeID: "2",
+		UDPOut: udpOut,
+	}
+
+	payload := readTestPayload(t, makeTestCommandPacket(t, "1", "unknown", nil))
+
+	router := CommandRouter{}
+	err := router.Dispatch(nodeCtx, payload)
+	if err == nil {
+		t.Fatal("Expect Dispatch to return a error")
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusUnknownCommand {
+		t.Fatal("Expect", StatusUnknownCommand, "was", resp.Status)
+	}
+
+	if resp.Error == "" {
+		t.Fatal("Expect a error message")
+	}
+}
+
+func Test_Dispatch_HandlerError(t *testing.T) {
+	tests := []struct {
+		Err    error
+		Status int
+	}{
+		{errors.New("boom"), StatusHandlerError},
+		{NewCommandError(StatusRejected, "not now"), StatusRejected},
+		{fmt.Errorf("wrapped: %w", NewCommandError(StatusTimeout, "slow")), StatusTimeout},
+	}
+
+	for _, test := range tests {
+		udpOut := make(chan UDPPacket, 1)
+		nodeCtx := NodeContext{
+			NodeID: "2",
+			UDPOut: udpOut,
+		}
+
+		handlerErr := test.Err
+		router := CommandRouter{}
+		router.AddHandler("test", func(NodeContext, DictatorPayload) error {
+			return handlerErr
+		})
+
+		payload := readTestPayload(t, makeTestCommandPacket(t, "1", "test", nil))
+
+		err := router.Dispatch(nodeCtx, payload)
+		if err == nil {
+			t.Fatal("Expect Dispatch to return a error")
+		}
+
+		resp := readTestCommandResponse(t, <-udpOut)
+		if resp.Status != test.Status {
+			t.Fatal("Expect", test.Status, "was", resp.Status)
+		}
+
+		if resp.NodeID != "2" {
+			t.Fatal("Expect", "2", "was", resp.NodeID)
+		}
+
+		if resp.Error != handlerErr.Error() {
+			t.Fatal("Expect", handlerErr.Error(), "was", resp.Error)
+		}
+	}
+}
+
+// Nach dem Beenden wartet die Fehlermeldung nicht mehr auf den UDP Sender
+func Test_SendCommandError_Done(t *testing.T) {
+	nodeCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     make(chan UDPPacket),
+	}
+	nodeCtx.AppContext.Done()
+
+	err := SendCommandError(nodeCtx, DictatorPayload{DictatorID: "1"}, errors.New("boom"))
+	if err == nil {
+		t.Fatal("Expect SendCommandError to return the error")
+	}
+}
+
+func Test_Dispatch_Target(t *testing.T) {
+	called := []string{}
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		called = append(called, nCtx.NodeID)
+		return nil
+	})
+
+	packet, err := newCommandPacket("1", TraceContext{}, CommandBlob{
+		ID:     "a",
+		Name:   "test",
+		Target: "3",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	payload := readTestPayload(t, packet)
+
+	for _, id := range []string{"2", "3"} {
+		err = router.Dispatch(NodeContext{NodeID: id}, payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if len(called) != 1 || called[0] != "3" {
+		t.Fatal("Expect only node 3 to run the command was", called)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"math/big"
 	"time"
 
+	"github.com/rrawrriw/ite/logging"
 	"gopkg.in/mgo.v2/bson"
 )
 
@@ -16,6 +17,8 @@ type (
 		Type       int
 		Blob       []byte
 		DictatorID string
+		// Nur bei Befehlen und deren Antworten gesetzt
+		Trace TraceContext `bson:",omitempty"`
 	}
 
 	NodeContext struct {
@@ -27,6 +30,21 @@ type (
 		UDPOut          chan UDPPacket
 		Mission         MissionSpecs
 		IsDictatorAlive bool
+		// Führt die Befehle des Diktators nebenläufig aus. Ist kein Pool
+		// gesetzt werden die Befehle direkt in HandlePacket ausgeführt.
+		Workers *CommandPool
+		// Wird für jeden Befehl gesetzt bevor dessen Handler aufgerufen wird
+		Cmd CommandContext
+		// Macht den Zustand der Node von außen sichtbar
+		Handle *Handle
+		// Verschickt die Befehle des Diktators
+		Dispatcher *Dispatcher
+
+		dictatorSince     time.Time
+		lastHeartbeat     time.Time
+		heartbeatInterval time.Duration
+		// Läuft ab sobald die Wahl als gewonnen zählt, nil ohne offene Wahl
+		electionDecided <-chan time.Time
 	}
 )
 
@@ -71,7 +89,7 @@ func IsDictatorPayload(packet UDPPacket) bool {
 		return false
 	}
 
-	if 1 > pd.Type || pd.Type > 4 {
+	if 1 > pd.Type || pd.Type > 5 {
 		return false
 	}
 
@@ -102,6 +120,22 @@ func IsCommandResponse(payload DictatorPayload) bool {
 	return false
 }
 
+func IsCancel(payload DictatorPayload) bool {
+	if payload.Type == 4 {
+		return true
+	}
+
+	return false
+}
+
+func IsAbdication(payload DictatorPayload) bool {
+	if payload.Type == 5 {
+		return true
+	}
+
+	return false
+}
+
 func IsHeartbeat(payload DictatorPayload) bool {
 	if payload.Type == 1 {
 		return true
@@ -114,8 +148,11 @@ func StatusMsg(nodeID string, msg interface{}) string {
 	return fmt.Sprintf("%v - %v", nodeID, msg)
 }
 
-func (nodeCtx NodeContext) HandlePacket(packet UDPPacket) error {
-	l := nodeCtx.AppContext.Log
+func (nodeCtx *NodeContext) HandlePacket(packet UDPPacket) error {
+	if !IsDictatorPayload(packet) {
+		nodeCtx.AppContext.metrics().PacketDropped()
+	}
+
 	if IsDictatorPayload(packet) {
 		payload, err := ReadDictatorPayload(packet)
 		if err != nil {
@@ -134,29 +171,42 @@ func (nodeCtx NodeContext) HandlePacket(packet UDPPacket) error {
 			// When a other dictator take over we have to die
 			// and become a slave
 			if nodeCtx.IsDictatorAlive {
-				nodeCtx.SuicideChan <- struct{}{}
+				nodeCtx.stepDown()
+			}
+			nodeCtx.Handle.seen(payload.DictatorID, "", true)
+			nodeCtx.Handle.follow(payload.DictatorID, 0)
+
+			if nodeCtx.Workers != nil {
+				return nodeCtx.Workers.Submit(*nodeCtx, payload)
 			}
+			return nodeCtx.Mission.CommandRouter.Dispatch(*nodeCtx, payload)
+		}
 
-			r := nodeCtx.Mission.CommandRouter
-			blob := CommandBlob{}
+		// The dictator don't need the result of a command any longer
+		if IsCancel(payload) {
+			blob := CancelBlob{}
 			err := bson.Unmarshal(payload.Blob, &blob)
 			if err != nil {
 				return err
 			}
 
-			fun, ok := r.FindHandler(blob.Name)
-			if !ok {
-				errMsg := StatusMsg(nodeCtx.NodeID, "Cannot find CommandHandler")
-				return errors.New(errMsg)
+			if nodeCtx.Workers != nil {
+				nodeCtx.Workers.Cancel(blob.CommandID)
 			}
-			return fun(nodeCtx, payload)
+			return nil
 		}
 
 		// Just care about CommandResponse of my commands
 		if IsCommandResponse(payload) {
+			blob := CommandResponseBlob{}
+			err := bson.Unmarshal(payload.Blob, &blob)
+			if err == nil {
+				nodeCtx.Handle.seen(blob.NodeID, blob.NodeName, false)
+			}
+
 			if IsThatMe(nodeCtx.NodeID, payload) {
-				debugMsg := StatusMsg(nodeCtx.NodeID, "Receive command response")
-				l.Debug.Println(debugMsg)
+				nodeCtx.log().Debug("Receive command response")
+				nodeCtx.Dispatcher.Response(*nodeCtx, payload)
 				nodeCtx.Mission.ResponseChan <- payload
 				return nil
 			}
@@ -165,19 +215,58 @@ func (nodeCtx NodeContext) HandlePacket(packet UDPPacket) error {
 			return errors.New(errMsg)
 		}
 
+		// The dictator leaves, don't wait for the heartbeat timeout
+		if IsAbdication(payload) {
+			blob := AbdicationBlob{}
+			err := bson.Unmarshal(payload.Blob, &blob)
+			if err != nil {
+				return err
+			}
+
+			nodeCtx.log().Debug("Dictator abdicates", logging.KeyDictator, payload.DictatorID)
+			nodeCtx.Handle.seen(payload.DictatorID, "", false)
+			nodeCtx.Handle.campaign()
+
+			timeout, err := SuccessionTimeout(nodeCtx.NodeID, nodeCtx.Mission.Leadership, blob)
+			if err != nil {
+				return err
+			}
+			nodeCtx.ResetElection(timeout)
+			return nil
+		}
+
 		// Reset heartbeat timeout
 		if IsHeartbeat(payload) {
-			// When a other dictator take over we have to die
-			// and become a slave
+			l := nodeCtx.Mission.Leadership
+			heartbeat := ReadHeartbeat(payload)
+			nodeCtx.Handle.seen(payload.DictatorID, heartbeat.Name, true)
+			// When a other dictator with a higher rank take over we
+			// have to die and become a slave
 			if nodeCtx.IsDictatorAlive {
-				nodeCtx.SuicideChan <- struct{}{}
+				if Outranks(l.Priority, heartbeat.Priority) {
+					return nil
+				}
+				nodeCtx.stepDown()
+			}
+			nodeCtx.Handle.follow(payload.DictatorID, heartbeat.Term)
+			nodeCtx.countHeartbeat()
+
+			// Take over from a dictator with a lower priority. The
+			// timeout must be shorter than the heartbeat interval.
+			if !l.Ineligible && l.Priority > heartbeat.Priority {
+				timeout, err := NewRandomTimeout(10, 50)
+				if err != nil {
+					return err
+				}
+				nodeCtx.ResetElection(timeout)
+				return nil
 			}
 
-			timeout, err := NewRandomTimeout(500, 1500)
+			timeout, err := ElectionTimeout(l)
 			if err != nil {
 				return err
 			}
-			nodeCtx.BecomeDictator.Reset(timeout)
+			nodeCtx.ResetElection(timeout)
 			return nil
 		}
 
@@ -187,50 +276,105 @@ func (nodeCtx NodeContext) HandlePacket(packet UDPPacket) error {
 }
 
 func (nodeCtx NodeContext) LoopNode() {
-	l := nodeCtx.AppContext.Log
 	var err error
 	var dictatorIsDead <-chan struct{}
+	defer nodeCtx.Handle.close()
 
 	for {
 		select {
 		case <-nodeCtx.AppContext.DoneChan:
-			debugMsg := StatusMsg(nodeCtx.NodeID, "Goodbye")
-			l.Debug.Println(debugMsg)
-			nodeCtx.SuicideChan <- struct{}{}
+			// The heartbeat goroutine of the dictator listen to
+			// the DoneChan too
+			nodeCtx.Handle.shutdown()
+			nodeCtx.log().Debug("Goodbye")
+			return
+		case <-nodeCtx.AppContext.ShutdownChan:
+			nodeCtx.Shutdown(dictatorIsDead)
 			return
 		case packet := <-nodeCtx.UDPIn:
-			//l.Debug.Println("Receive UDP packet", nodeCtx.NodeID)
 			err = nodeCtx.HandlePacket(packet)
 			if err != nil {
-				errMsg := StatusMsg(nodeCtx.NodeID, err)
-				l.Error.Println(errMsg)
+				nodeCtx.log().Error("Handle packet", logging.Err(err))
 			}
 		case <-nodeCtx.BecomeDictator.C:
 			nodeCtx.BecomeDictator.Stop()
+			m := nodeCtx.AppContext.metrics()
+			if nodeCtx.Handle != nil && nodeCtx.Handle.State() == StateFollower {
+				m.HeartbeatMissed()
+			}
+			m.ElectionStarted()
+			nodeCtx.Handle.rule()
 			dictatorIsDead, err = nodeCtx.AwakeDictator()
 			nodeCtx.IsDictatorAlive = true
 			if err != nil {
-				errMsg := StatusMsg(nodeCtx.NodeID, err)
-				l.Error.Println(errMsg)
+				nodeCtx.log().Error("Awake dictator", logging.Err(err))
 				return
 			}
+			nodeCtx.dictatorSince = time.Now()
+			nodeCtx.lastHeartbeat = time.Time{}
+			// Ein Rivale dessen Timer ebenfalls abgelaufen ist meldet sich
+			// spätestens bis zum nächsten möglichen Timeout
+			eMin, _ := nodeCtx.Mission.Leadership.electionRange()
+			nodeCtx.electionDecided = time.After(eMin)
+		case <-nodeCtx.electionDecided:
+			nodeCtx.decideElection()
 		case <-dictatorIsDead:
 			nodeCtx.IsDictatorAlive = false
+		case req := <-nodeCtx.Handle.requestC():
+			req.errC <- req.fun(&nodeCtx)
 
 		}
 	}
 }
 
+// Die Wahl gilt als gewonnen wenn die Node bis jetzt ohne Rivalen
+// Diktator geblieben ist
+func (nodeCtx *NodeContext) decideElection() {
+	nodeCtx.electionDecided = nil
+	if nodeCtx.IsDictatorAlive {
+		nodeCtx.AppContext.metrics().ElectionWon()
+	}
+}
+
+// Stops the heartbeats due to a other dictator takes over
+func (nodeCtx *NodeContext) stepDown() {
+	nodeCtx.SuicideChan <- struct{}{}
+	nodeCtx.IsDictatorAlive = false
+	nodeCtx.electionDecided = nil
+	if !nodeCtx.dictatorSince.IsZero() {
+		nodeCtx.AppContext.metrics().DictatorTime(time.Since(nodeCtx.dictatorSince))
+		nodeCtx.dictatorSince = time.Time{}
+	}
+}
+
+func (nodeCtx *NodeContext) countHeartbeat() {
+	now := time.Now()
+	if !nodeCtx.lastHeartbeat.IsZero() {
+		interval := now.Sub(nodeCtx.lastHeartbeat)
+		jitter := interval - nodeCtx.heartbeatInterval
+		if jitter < 0 {
+			jitter = -jitter
+		}
+		// Without a previous interval there is no jitter
+		if nodeCtx.heartbeatInterval == 0 {
+			jitter = 0
+		}
+		nodeCtx.AppContext.metrics().HeartbeatReceived(interval, jitter)
+		nodeCtx.heartbeatInterval = interval
+	}
+	nodeCtx.lastHeartbeat = now
+}
+
 func (nodeCtx NodeContext) AwakeDictator() (<-chan struct{}, error) {
-	l := nodeCtx.AppContext.Log
-	debugMsg := StatusMsg(nodeCtx.NodeID, "Time to enslave some people")
-	l.Debug.Println(debugMsg)
+	l := nodeCtx.log()
+	l.Info("Time to enslave some people")
 
 	nodeID := nodeCtx.NodeID
 
-	dictatorIsDead := make(chan struct{})
+	// Buffered due to LoopNode may be busy with the shutdown
+	dictatorIsDead := make(chan struct{}, 1)
 
-	timeout, err := NewRandomTimeout(100, 150)
+	timeout, err := HeartbeatInterval(nodeCtx.Mission.Leadership)
 	if err != nil {
 		return nil, err
 	}
@@ -243,32 +387,33 @@ func (nodeCtx NodeContext) AwakeDictator() (<-chan struct{}, error) {
 		for {
 			select {
 			case <-nodeCtx.AppContext.DoneChan:
-				errMsg := StatusMsg(nodeID, "The world shutdown")
-				l.Debug.Println(errMsg)
+				l.Debug("The world shutdown")
 				dictatorHeartbeat.Stop()
 				return
+			case <-nodeCtx.AppContext.ShutdownChan:
+				l.Debug("Dictator abdicates")
+				dictatorHeartbeat.Stop()
+				dictatorIsDead <- struct{}{}
+				return
 			case <-nodeCtx.SuicideChan:
-				errMsg := StatusMsg(nodeID, "Dictator must die")
-				l.Debug.Println(errMsg)
+				l.Info("Dictator must die")
 				dictatorHeartbeat.Stop()
 				dictatorIsDead <- struct{}{}
 				return
 			case <-dictatorHeartbeat.C:
 				// It's time to say hello to the people
 				// due to they don't forget us
-				heartbeatPacket := DictatorPayload{
-					Type:       1,
-					DictatorID: nodeID,
-					Blob:       []byte{},
-				}
-				p, err := bson.Marshal(heartbeatPacket)
+				p, err := NewHeartbeatPacket(nodeID, HeartbeatBlob{
+					Priority: nodeCtx.Mission.Leadership.Priority,
+					Term:     nodeCtx.Handle.Term(),
+					Name:     nodeCtx.Mission.Identity.Name,
+				})
 				if err != nil {
-					l.Error.Println(err.Error())
+					l.Error("Create heartbeat", logging.Err(err))
 					continue
 				}
-				nodeCtx.UDPOut <- UDPPacket{
-					Payload: p,
-				}
+				nodeCtx.UDPOut <- p
+				nodeCtx.AppContext.metrics().HeartbeatSent()
 			}
 		}
 	}()
@@ -277,19 +422,29 @@ func (nodeCtx NodeContext) AwakeDictator() (<-chan struct{}, error) {
 
 }
 
-func Node(ctx Context, udpIn, udpOut chan UDPPacket, missionSpecs MissionSpecs) error {
+// Startet eine Node. Über das zurückgegebene Handle lässt sich deren
+// Zustand beobachten.
+func Node(ctx Context, udpIn, udpOut chan UDPPacket, missionSpecs MissionSpecs) (*Handle, error) {
 
-	nodeID, err := NewNodeID()
-	if err != nil {
-		return err
+	nodeID := missionSpecs.Identity.ID
+	if nodeID == "" {
+		var err error
+		nodeID, err = NewNodeID()
+		if err != nil {
+			return nil, err
+		}
 	}
+	handle := NewHandle(nodeID)
+	handle.name = missionSpecs.Identity.Name
+	ctx.Log = ctx.log().With(logging.KeyNode, nodeID)
 
 	go func() {
 
 		// First wait if there already a dictator
-		timeout, err := NewRandomTimeout(500, 1500)
+		timeout, err := ElectionTimeout(missionSpecs.Leadership)
 		if err != nil {
-			ctx.Log.Error.Println(err.Error())
+			ctx.Log.Error("Election timeout", logging.Err(err))
+			handle.close()
 			return
 		}
 
@@ -302,11 +457,15 @@ func Node(ctx Context, udpIn, udpOut chan UDPPacket, missionSpecs MissionSpecs)
 			AppContext:      ctx,
 			Mission:         missionSpecs,
 			IsDictatorAlive: false,
+			Workers:         NewCommandPool(ctx, DefaultCommandWorkers, DefaultCommandQueueSize, DefaultCommandTimeout),
+			Handle:          handle,
+			Dispatcher:      NewDispatcher(DefaultCommandTimeout),
 		}
+		nodeCtx.ResetElection(timeout)
 
 		nodeCtx.LoopNode()
 
 	}()
 
-	return nil
+	return handle, nil
 }
@@ -3,25 +3,18 @@ package dictator
 import (
 	"errors"
 	"fmt"
-	"log"
+	"log/slog"
 	"net"
 	"os"
 	"testing"
 	"time"
 
+	"github.com/rrawrriw/ite/logging"
 	"gopkg.in/mgo.v2/bson"
 )
 
-func MakeTestLogger() Logger {
-	errorWriter := os.Stderr
-	debugWriter := os.Stdout
-
-	l := Logger{
-		Error: log.New(errorWriter, "Error: ", log.LstdFlags|log.Lshortfile),
-		Debug: log.New(debugWriter, "Debug: ", log.LstdFlags|log.Lshortfile),
-	}
-
-	return l
+func MakeTestLogger() *slog.Logger {
+	return slog.New(logging.NewHandler(os.Stderr, slog.LevelDebug, false))
 }
 
 func existsID(ids []string, id string) bool {
@@ -533,7 +526,7 @@ func Test_IsDictatorPayload_Fail(t *testing.T) {
 func Test_IsDictatorPayload_Fail2(t *testing.T) {
 	payload, err := bson.Marshal(
 		DictatorPayload{
-			Type: 5,
+			Type: 6,
 		},
 	)
 	if err != nil {
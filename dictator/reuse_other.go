@@ -0,0 +1,10 @@
+//go:build !unix
+
+package dictator
+
+import "syscall"
+
+// Ohne SO_REUSEADDR kann nur ein Prozess den Port nutzen
+func reuseAddr(network, address string, c syscall.RawConn) error {
+	return nil
+}
@@ -0,0 +1,25 @@
+//go:build unix
+
+package dictator
+
+import (
+	"net"
+	"testing"
+)
+
+func Test_ListenUDP_Reuse(t *testing.T) {
+	first, err := ListenUDP(&net.UDPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 0,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer first.Close()
+
+	second, err := ListenUDP(first.LocalAddr().(*net.UDPAddr))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second.Close()
+}
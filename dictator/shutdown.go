@@ -0,0 +1,131 @@
+package dictator
+
+import (
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Wie lange beim Herunterfahren höchstens auf laufende Befehle und den
+// Versand der Abdankung gewartet wird
+const ShutdownTimeout = 5 * time.Second
+
+// Teilt den Nodes mit das der Diktator abdankt. Ist Successor leer wird
+// sofort ein neuer Diktator gewählt.
+type AbdicationBlob struct {
+	Successor string
+}
+
+func NewAbdicationPacket(dictatorID, successor string) (UDPPacket, error) {
+	blob, err := bson.Marshal(AbdicationBlob{Successor: successor})
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	dictatorPayload := DictatorPayload{
+		Type:       5,
+		DictatorID: dictatorID,
+		Blob:       blob,
+	}
+	udpPayload, err := bson.Marshal(dictatorPayload)
+	if err != nil {
+		return UDPPacket{}, err
+	}
+
+	return UDPPacket{Payload: udpPayload}, nil
+}
+
+// Gibt zurück wann die Node nach einer Abdankung zum Diktator wird. Der
+// Nachfolger übernimmt sofort. Bei einer freien Wahl kommen keine
+// Heartbeats mehr, daher entfällt das Minimum von ElectionTimeout und
+// es bleibt nur dessen zufälliger Bereich, mit höherer Priorität kürzer,
+// aber mindestens 1ms. Alle anderen geben dem Nachfolger die normale Zeit.
+func SuccessionTimeout(nodeID string, l Leadership, blob AbdicationBlob) (time.Duration, error) {
+	if blob.Successor == nodeID {
+		return time.Duration(0), nil
+	}
+
+	if blob.Successor == "" {
+		min, max := l.priorityElectionRange()
+		spread := int((max - min).Milliseconds())
+		if spread < 1 {
+			spread = 1
+		}
+		return NewRandomTimeout(1, 1+spread)
+	}
+
+	return ElectionTimeout(l)
+}
+
+// Wählt als Nachfolger die Node welche zuletzt gesehen wurde. Die
+// Priorität der Followers kennt der Diktator nicht, eine Node mit höherer
+// Priorität übernimmt danach ohnehin vom Nachfolger. Wurde keine Node
+// innerhalb des maximalen Election Timeouts gesehen, wird frei gewählt.
+// Ist der Nachfolger nicht wählbar, wählen die übrigen Nodes nach dem
+// normalen Timeout.
+func RecentSuccessor(nodeCtx NodeContext) string {
+	if nodeCtx.Handle == nil {
+		return ""
+	}
+	_, max := nodeCtx.Mission.Leadership.electionRange()
+
+	successor := Member{}
+	for _, m := range nodeCtx.Handle.Members() {
+		if time.Since(m.LastSeen) > max || m.LastSeen.Before(successor.LastSeen) {
+			continue
+		}
+		successor = m
+	}
+
+	return successor.ID
+}
+
+// Fährt die Node geordnet herunter. Ein Diktator hört auf Heartbeats zu
+// senden und dankt ab. Danach wird auf die laufenden Befehle gewartet und
+// zum Schluss der AppContext beendet.
+func (nodeCtx NodeContext) Shutdown(dictatorIsDead <-chan struct{}) {
+	l := nodeCtx.log()
+	defer nodeCtx.AppContext.Done()
+	nodeCtx.Handle.shutdown()
+
+	if nodeCtx.IsDictatorAlive {
+		// The heartbeat goroutine stops on the ShutdownChan too
+		select {
+		case <-dictatorIsDead:
+		case <-time.After(ShutdownTimeout):
+		}
+		if !nodeCtx.dictatorSince.IsZero() {
+			nodeCtx.AppContext.metrics().DictatorTime(time.Since(nodeCtx.dictatorSince))
+		}
+
+		successor := ""
+		if nodeCtx.Mission.Successor != nil {
+			successor = nodeCtx.Mission.Successor(nodeCtx)
+		}
+
+		l.Info("Abdicate", "successor", successor)
+
+		packet, err := NewAbdicationPacket(nodeCtx.NodeID, successor)
+		if err != nil {
+			l.Error("Create abdication", logging.Err(err))
+		} else {
+			// Send twice, UDP may lose a packet and the second send
+			// only returns after the first one was written
+			for x := 0; x < 2; x++ {
+				select {
+				case nodeCtx.UDPOut <- packet:
+				case <-time.After(ShutdownTimeout):
+				}
+			}
+		}
+	}
+
+	if nodeCtx.Workers != nil {
+		if !nodeCtx.Workers.WaitTimeout(ShutdownTimeout) {
+			l.Warn("Cancel running commands")
+		}
+	}
+
+	l.Debug("Goodbye")
+}
@@ -0,0 +1,173 @@
+package dictator
+
+import (
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func Test_SuccessionTimeout_OK(t *testing.T) {
+	timeout, err := SuccessionTimeout("1", Leadership{}, AbdicationBlob{Successor: "1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != 0 {
+		t.Fatal("Expect", 0, "was", timeout)
+	}
+
+	timeout, err = SuccessionTimeout("1", Leadership{}, AbdicationBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout < time.Millisecond || timeout > DefaultElectionTimeoutMax-DefaultElectionTimeoutMin {
+		t.Fatal("Expect a timeout without the election minimum was", timeout)
+	}
+
+	l := Leadership{
+		ElectionTimeoutMin: 200 * time.Millisecond,
+		ElectionTimeoutMax: 300 * time.Millisecond,
+		HeartbeatMin:       50 * time.Millisecond,
+		HeartbeatMax:       100 * time.Millisecond,
+	}
+	timeout, err = SuccessionTimeout("1", l, AbdicationBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout < time.Millisecond || timeout > 100*time.Millisecond {
+		t.Fatal("Expect 1-100ms was", timeout)
+	}
+
+	timeout, err = SuccessionTimeout("1", Leadership{Priority: 1000}, AbdicationBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout != time.Millisecond {
+		t.Fatal("Expect 1ms was", timeout)
+	}
+
+	timeout, err = SuccessionTimeout("1", Leadership{}, AbdicationBlob{Successor: "2"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if timeout < 500*time.Millisecond {
+		t.Fatal("Expect a normal timeout was", timeout)
+	}
+}
+
+func Test_RecentSuccessor_OK(t *testing.T) {
+	h := NewHandle("1")
+	nodeCtx := NodeContext{NodeID: "1", Handle: h}
+	if id := RecentSuccessor(nodeCtx); id != "" {
+		t.Fatal("Expect no successor was", id)
+	}
+
+	h.seen("2", "", false)
+	h.seen("3", "", false)
+	h.seen("4", "", false)
+	h.mutex.Lock()
+	m := h.members["3"]
+	m.LastSeen = time.Now().Add(time.Second)
+	h.members["3"] = m
+	m = h.members["4"]
+	m.LastSeen = time.Now().Add(-DefaultElectionTimeoutMax - time.Second)
+	h.members["4"] = m
+	h.mutex.Unlock()
+
+	if id := RecentSuccessor(nodeCtx); id != "3" {
+		t.Fatal("Expect 3 was", id)
+	}
+
+	// Zu lange nicht gesehene Nodes kommen nicht in Frage
+	h.mutex.Lock()
+	delete(h.members, "2")
+	delete(h.members, "3")
+	h.mutex.Unlock()
+	if id := RecentSuccessor(nodeCtx); id != "" {
+		t.Fatal("Expect no successor was", id)
+	}
+}
+
+// Ein Nachfolger muss sofort zum Diktator werden
+func Test_HandleAbdication_Successor(t *testing.T) {
+	nodeCtx := NodeContext{
+		NodeID:         "2",
+		AppContext:     NewContext(),
+		BecomeDictator: time.NewTimer(1 * time.Hour),
+	}
+
+	packet, err := NewAbdicationPacket("1", "2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-nodeCtx.BecomeDictator.C:
+	case <-time.After(100 * time.Millisecond):
+		t.Fatal("Expect to become dictator immediately")
+	}
+}
+
+func Test_Shutdown_Dictator(t *testing.T) {
+	ctx := NewContext()
+	udpIn := make(chan UDPPacket)
+	udpOut := make(chan UDPPacket)
+
+	specs := MissionSpecs{
+		Mission: func(NodeContext) {},
+		Successor: func(NodeContext) string {
+			return "2"
+		},
+	}
+
+	_, err := Node(ctx, udpIn, udpOut, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Warte bis die Node Diktator ist
+	timeout := time.After(3 * time.Second)
+	select {
+	case <-udpOut:
+	case <-timeout:
+		t.Fatal("Expect node to become dictator")
+	}
+
+	ctx.Shutdown()
+
+	for {
+		select {
+		case packet := <-udpOut:
+			payload := readTestPayload(t, packet)
+			if !IsAbdication(payload) {
+				continue
+			}
+
+			blob := AbdicationBlob{}
+			err = bson.Unmarshal(payload.Blob, &blob)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if blob.Successor != "2" {
+				t.Fatal("Expect", "2", "was", blob.Successor)
+			}
+
+			// Zweite Abdankung
+			<-udpOut
+
+			select {
+			case <-ctx.DoneChan:
+			case <-time.After(1 * time.Second):
+				t.Fatal("Expect context to be done")
+			}
+			return
+		case <-timeout:
+			t.Fatal("Expect a abdication")
+		}
+	}
+}
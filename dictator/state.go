@@ -0,0 +1,232 @@
+package dictator
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// Die Node folgt einem bekannten Diktator
+	StateFollower NodeState = iota
+	// Die Node kennt keinen Diktator und wartet auf die Wahl
+	StateCandidate
+	// Die Node ist selbst Diktator
+	StateDictator
+	// Die Node fährt herunter
+	StateShuttingDown
+)
+
+// Größe des Channels eines Abonnenten. Ist dieser voll werden weitere
+// Übergänge für ihn verworfen damit die Node nicht blockiert.
+const SubscriptionBufferSize = 16
+
+type (
+	NodeState int
+
+	// Beschreibt einen Zustandswechsel der Node oder einen Wechsel des
+	// Diktators
+	Transition struct {
+		From     NodeState
+		To       NodeState
+		Dictator string
+		Term     int
+		Time     time.Time
+	}
+
+	// Wird von Node zurückgegeben und erlaubt es den Zustand einer
+	// laufenden Node abzufragen und Änderungen zu abonnieren.
+	Handle struct {
+		nodeID      string
+		name        string
+		mutex       *sync.Mutex
+		state       NodeState
+		dictator    string
+		term        int
+		subscribers []chan Transition
+		closed      bool
+		// Anfragen an die laufende Node, siehe control.go
+		requests chan nodeRequest
+		done     chan struct{}
+		members  map[string]Member
+	}
+)
+
+func (s NodeState) String() string {
+	switch s {
+	case StateFollower:
+		return "follower"
+	case StateCandidate:
+		return "candidate"
+	case StateDictator:
+		return "dictator"
+	case StateShuttingDown:
+		return "shutting down"
+	}
+
+	return "unknown"
+}
+
+func NewHandle(nodeID string) *Handle {
+	return &Handle{
+		nodeID:   nodeID,
+		mutex:    &sync.Mutex{},
+		state:    StateCandidate,
+		requests: make(chan nodeRequest),
+		done:     make(chan struct{}),
+		members:  map[string]Member{},
+	}
+}
+
+func (h *Handle) NodeID() string {
+	return h.nodeID
+}
+
+func (h *Handle) State() NodeState {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.state
+}
+
+// ID des aktuellen Diktators, leer wenn keiner bekannt ist
+func (h *Handle) CurrentDictator() string {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.dictator
+}
+
+// Die Amtszeit wird mit jedem neuen Diktator erhöht
+func (h *Handle) Term() int {
+	if h == nil {
+		return 0
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	return h.term
+}
+
+// Gibt einen Channel zurück welcher alle folgenden Übergänge erhält. Der
+// Channel wird geschlossen wenn die Node beendet ist.
+func (h *Handle) Subscribe() <-chan Transition {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	c := make(chan Transition, SubscriptionBufferSize)
+	if h.closed {
+		close(c)
+		return c
+	}
+	h.subscribers = append(h.subscribers, c)
+
+	return c
+}
+
+// Entfernt ein Abonnement und schließt dessen Channel
+func (h *Handle) Unsubscribe(c <-chan Transition) {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	for i, s := range h.subscribers {
+		if s == c {
+			close(s)
+			h.subscribers = append(h.subscribers[:i], h.subscribers[i+1:]...)
+			return
+		}
+	}
+}
+
+// Setzt den Zustand und benachrichtigt die Abonnenten falls sich Zustand,
+// Diktator oder Amtszeit geändert haben.
+func (h *Handle) transition(state NodeState, dictator string, term int) {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	// Nach dem Herunterfahren gibt es keinen Weg zurück
+	if h.state == StateShuttingDown {
+		return
+	}
+
+	if term < h.term {
+		term = h.term
+	}
+
+	if h.state == state && h.dictator == dictator && h.term == term {
+		return
+	}
+
+	t := Transition{
+		From:     h.state,
+		To:       state,
+		Dictator: dictator,
+		Term:     term,
+		Time:     time.Now(),
+	}
+	h.state = state
+	h.dictator = dictator
+	h.term = term
+
+	for _, s := range h.subscribers {
+		select {
+		case s <- t:
+		default:
+		}
+	}
+}
+
+// Die Node folgt dem Diktator id
+func (h *Handle) follow(id string, term int) {
+	h.transition(StateFollower, id, term)
+}
+
+// Die Node kennt keinen Diktator mehr
+func (h *Handle) campaign() {
+	if h == nil {
+		return
+	}
+
+	h.transition(StateCandidate, "", h.Term())
+}
+
+// Die Node wird selbst Diktator und beginnt eine neue Amtszeit
+func (h *Handle) rule() {
+	if h == nil {
+		return
+	}
+
+	h.transition(StateDictator, h.nodeID, h.Term()+1)
+}
+
+func (h *Handle) shutdown() {
+	if h == nil {
+		return
+	}
+
+	h.transition(StateShuttingDown, "", h.Term())
+}
+
+// Schließt die Channel aller Abonnenten
+func (h *Handle) close() {
+	if h == nil {
+		return
+	}
+
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+
+	h.state = StateShuttingDown
+	if !h.closed {
+		close(h.done)
+	}
+	h.closed = true
+	for _, s := range h.subscribers {
+		close(s)
+	}
+	h.subscribers = nil
+}
@@ -0,0 +1,93 @@
+package dictator
+
+import (
+	"testing"
+	"time"
+)
+
+func Test_Handle_Transitions(t *testing.T) {
+	h := NewHandle("1")
+	c := h.Subscribe()
+
+	if h.State() != StateCandidate {
+		t.Fatal("Expect", StateCandidate, "was", h.State())
+	}
+
+	h.follow("2", 3)
+	tr := <-c
+	if tr.From != StateCandidate || tr.To != StateFollower {
+		t.Fatal("Expect candidate -> follower was", tr.From, "->", tr.To)
+	}
+	if h.CurrentDictator() != "2" || h.Term() != 3 {
+		t.Fatal("Expect dictator 2 in term 3 was", h.CurrentDictator(), h.Term())
+	}
+
+	// Keine Änderung, kein Übergang
+	h.follow("2", 3)
+	if len(c) != 0 {
+		t.Fatal("Expect no transition")
+	}
+
+	h.rule()
+	tr = <-c
+	if tr.To != StateDictator || tr.Dictator != "1" || tr.Term != 4 {
+		t.Fatal("Expect dictator 1 in term 4 was", tr)
+	}
+
+	h.shutdown()
+	tr = <-c
+	if tr.To != StateShuttingDown {
+		t.Fatal("Expect", StateShuttingDown, "was", tr.To)
+	}
+
+	h.close()
+	if _, ok := <-c; ok {
+		t.Fatal("Expect channel to be closed")
+	}
+
+	if _, ok := <-h.Subscribe(); ok {
+		t.Fatal("Expect channel of a closed handle to be closed")
+	}
+}
+
+func Test_Handle_Unsubscribe(t *testing.T) {
+	h := NewHandle("1")
+	c := h.Subscribe()
+	h.Unsubscribe(c)
+
+	h.rule()
+	if _, ok := <-c; ok {
+		t.Fatal("Expect channel to be closed")
+	}
+}
+
+func Test_Node_BecomeDictatorState(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	udpOut := make(chan UDPPacket, 100)
+	specs := MissionSpecs{
+		Mission: func(NodeContext) {},
+	}
+
+	node, err := Node(ctx, make(chan UDPPacket), udpOut, specs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := node.Subscribe()
+
+	select {
+	case tr := <-c:
+		if tr.To != StateDictator {
+			t.Fatal("Expect", StateDictator, "was", tr.To)
+		}
+		if node.CurrentDictator() != node.NodeID() {
+			t.Fatal("Expect", node.NodeID(), "was", node.CurrentDictator())
+		}
+		if node.Term() != 1 {
+			t.Fatal("Expect", 1, "was", node.Term())
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Expect node to become dictator")
+	}
+}
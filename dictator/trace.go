@@ -0,0 +1,138 @@
+package dictator
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+)
+
+type (
+	// Wird mit jedem Befehl und jeder Antwort in der DictatorPayload
+	// übertragen, damit Versand, Ausführung und Antworten eines Befehls
+	// einen gemeinsamen Trace bilden.
+	TraceContext struct {
+		TraceID string `bson:",omitempty"`
+		SpanID  string `bson:",omitempty"`
+	}
+
+	// Ein abgeschlossener Abschnitt eines Trace
+	Span struct {
+		TraceID string
+		SpanID  string
+		// Leer wenn der Span einen neuen Trace beginnt
+		ParentID   string
+		Name       string
+		NodeID     string
+		Start      time.Time
+		End        time.Time
+		Attributes map[string]string
+		// Fehlermeldung falls der Abschnitt fehlgeschlagen ist
+		Err string
+	}
+
+	// Erhält alle abgeschlossenen Spans einer Node. Die Implementierung
+	// muss von mehreren goroutines nutzbar sein.
+	SpanExporter interface {
+		ExportSpan(Span)
+	}
+
+	// Sammelt alle Spans im Speicher, gedacht für Tests
+	MemoryExporter struct {
+		mutex *sync.Mutex
+		spans []Span
+	}
+)
+
+func NewTraceID() string {
+	return fmt.Sprintf("%016x%016x", rand.Uint64(), rand.Uint64())
+}
+
+func NewSpanID() string {
+	return fmt.Sprintf("%016x", rand.Uint64())
+}
+
+func (t TraceContext) IsValid() bool {
+	return t.TraceID != "" && t.SpanID != ""
+}
+
+// Beginnt einen Span als Kind von parent. Ist parent ungültig beginnt ein
+// neuer Trace.
+func StartSpan(parent TraceContext, name, nodeID string) Span {
+	s := Span{
+		TraceID:    parent.TraceID,
+		SpanID:     NewSpanID(),
+		ParentID:   parent.SpanID,
+		Name:       name,
+		NodeID:     nodeID,
+		Start:      time.Now(),
+		Attributes: map[string]string{},
+	}
+	if !parent.IsValid() {
+		s.TraceID = NewTraceID()
+		s.ParentID = ""
+	}
+
+	return s
+}
+
+func (s Span) Context() TraceContext {
+	return TraceContext{
+		TraceID: s.TraceID,
+		SpanID:  s.SpanID,
+	}
+}
+
+// Beendet den Span und übergibt ihn dem Exporter des Context. Ohne
+// Exporter wird der Span verworfen.
+func (c Context) exportSpan(s Span, err error) {
+	if c.Exporter == nil || s.SpanID == "" {
+		return
+	}
+
+	s.End = time.Now()
+	if err != nil {
+		s.Err = err.Error()
+	}
+
+	c.Exporter.ExportSpan(s)
+}
+
+func commandSpanAttributes(s Span, name, id string) Span {
+	s.Attributes[logging.KeyCommand] = name
+	s.Attributes[logging.KeyCommandID] = id
+	return s
+}
+
+func NewMemoryExporter() *MemoryExporter {
+	return &MemoryExporter{
+		mutex: &sync.Mutex{},
+	}
+}
+
+func (e *MemoryExporter) ExportSpan(s Span) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = append(e.spans, s)
+}
+
+// Alle bisher exportierten Spans in der Reihenfolge ihres Abschlusses
+func (e *MemoryExporter) Spans() []Span {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	spans := make([]Span, len(e.spans))
+	copy(spans, e.spans)
+
+	return spans
+}
+
+func (e *MemoryExporter) Reset() {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+
+	e.spans = nil
+}
@@ -0,0 +1,127 @@
+package dictator
+
+import (
+	"testing"
+)
+
+func Test_Trace_CommandRoundTrip(t *testing.T) {
+	dictatorSpans := NewMemoryExporter()
+	dictatorCtx := NewContext()
+	defer dictatorCtx.Done()
+	dictatorCtx.Exporter = dictatorSpans
+
+	dictatorOut := make(chan UDPPacket, 1)
+	dictator := NodeContext{
+		NodeID:     "1",
+		AppContext: dictatorCtx,
+		UDPOut:     dictatorOut,
+	}
+	d := NewDispatcher(DefaultCommandTimeout)
+
+	cmdID, err := d.Send(dictator, "test", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmdPayload := readTestPayload(t, <-dictatorOut)
+
+	followerSpans := NewMemoryExporter()
+	followerCtx := NewContext()
+	defer followerCtx.Done()
+	followerCtx.Exporter = followerSpans
+
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		return SendCommandResponse(nCtx, p, StatusOK, nil)
+	})
+	followerOut := make(chan UDPPacket, 1)
+	follower := NodeContext{
+		NodeID:     "2",
+		AppContext: followerCtx,
+		UDPOut:     followerOut,
+		Mission: MissionSpecs{
+			CommandRouter: router,
+		},
+	}
+
+	err = router.Dispatch(follower, cmdPayload)
+	if err != nil {
+		t.Fatal(err)
+	}
+	respPayload := readTestPayload(t, <-followerOut)
+
+	_, ok := d.Response(dictator, respPayload)
+	if !ok {
+		t.Fatal("Expect response to", cmdID)
+	}
+
+	sent := dictatorSpans.Spans()
+	handled := followerSpans.Spans()
+	if len(sent) != 2 || len(handled) != 1 {
+		t.Fatal("Expect 2 dictator and 1 follower span was", sent, handled)
+	}
+
+	send, response, handle := sent[0], sent[1], handled[0]
+	if send.ParentID != "" || send.Name != "send test" {
+		t.Fatal("Expect root span send test was", send)
+	}
+	if handle.TraceID != send.TraceID || handle.ParentID != send.SpanID {
+		t.Fatal("Expect handle span to be a child of", send, "was", handle)
+	}
+	if response.TraceID != send.TraceID || response.ParentID != handle.SpanID {
+		t.Fatal("Expect response span to be a child of", handle, "was", response)
+	}
+	if response.Attributes["node"] != "2" || response.Err != "" {
+		t.Fatal("Expect successful response of node 2 was", response)
+	}
+}
+
+func Test_Trace_HandlerError(t *testing.T) {
+	spans := NewMemoryExporter()
+	ctx := NewContext()
+	defer ctx.Done()
+	ctx.Exporter = spans
+
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		return NewCommandError(StatusRejected, "no")
+	})
+	udpOut := make(chan UDPPacket, 1)
+	nCtx := NodeContext{
+		NodeID:     "2",
+		AppContext: ctx,
+		UDPOut:     udpOut,
+	}
+
+	packet := makeTestCommandPacket(t, "1", "test", nil)
+	cmdPayload := readTestPayload(t, packet)
+
+	err := router.Dispatch(nCtx, cmdPayload)
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+
+	respPayload := readTestPayload(t, <-udpOut)
+
+	s := spans.Spans()
+	if len(s) != 1 || s[0].Err == "" {
+		t.Fatal("Expect 1 failed span was", s)
+	}
+	if s[0].TraceID != cmdPayload.Trace.TraceID {
+		t.Fatal("Expect trace", cmdPayload.Trace.TraceID, "was", s[0].TraceID)
+	}
+	if respPayload.Trace != s[0].Context() {
+		t.Fatal("Expect response trace", s[0].Context(), "was", respPayload.Trace)
+	}
+}
+
+func Test_StartSpan_NewTrace(t *testing.T) {
+	s := StartSpan(TraceContext{}, "test", "1")
+	if !s.Context().IsValid() || s.ParentID != "" {
+		t.Fatal("Expect a new trace was", s)
+	}
+
+	c := StartSpan(s.Context(), "child", "1")
+	if c.TraceID != s.TraceID || c.ParentID != s.SpanID {
+		t.Fatal("Expect a child of", s, "was", c)
+	}
+}
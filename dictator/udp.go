@@ -1,9 +1,49 @@
 package dictator
 
-import "net"
+import (
+	"context"
+	"net"
+
+	"github.com/rrawrriw/ite/logging"
+)
 
 const MaxUDPPacketSize = 1024
 
+// Wie net.ListenUDP, setzt aber wenn möglich SO_REUSEADDR. Damit können
+// mehrere Prozesse auf einem Host die Broadcasts des Clusters empfangen,
+// z.B. eine Node und itectl watch.
+func ListenUDP(addr *net.UDPAddr) (*net.UDPConn, error) {
+	lc := net.ListenConfig{
+		Control: reuseAddr,
+	}
+	conn, err := lc.ListenPacket(context.Background(), "udp", addr.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return conn.(*net.UDPConn), nil
+}
+
+// Lauscht auf die Broadcasts oder die Multicast Gruppe des Clusters. Bei
+// einer Multicast Adresse wird der Gruppe auf dem Interface ifName
+// beigetreten, ein leerer Name überlässt die Wahl dem System.
+func ListenCluster(addr *net.UDPAddr, ifName string) (*net.UDPConn, error) {
+	if !addr.IP.IsMulticast() {
+		return ListenUDP(addr)
+	}
+
+	var iface *net.Interface
+	if ifName != "" {
+		var err error
+		iface, err = net.InterfaceByName(ifName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return net.ListenMulticastUDP("udp", iface, addr)
+}
+
 type UDPPacket struct {
 	RemoteAddr *net.UDPAddr
 	Payload    []byte
@@ -12,8 +52,9 @@ type UDPPacket struct {
 
 func UDPInbox(ctx Context, conn *net.UDPConn) (chan UDPPacket, error) {
 	udpIn := make(chan UDPPacket)
+	l := ctx.log()
 	go func() {
-		ctx.Log.Debug.Println("UDPInbox start")
+		l.Debug("UDPInbox start")
 		for {
 			payload := make([]byte, MaxUDPPacketSize)
 
@@ -22,14 +63,14 @@ func UDPInbox(ctx Context, conn *net.UDPConn) (chan UDPPacket, error) {
 				// Check if the done channel closed then shutdown goroutine
 				select {
 				case <-ctx.DoneChan:
-					ctx.Log.Debug.Println("UDPInbox shutdown")
+					l.Debug("UDPInbox shutdown")
 					close(udpIn)
 					return
 				default:
 					// Need default case otherwise the select statment would block
 				}
 
-				ctx.Log.Error.Println(err.Error())
+				l.Error("Read UDP packet", logging.Err(err))
 				continue
 			}
 
@@ -47,17 +88,18 @@ func UDPInbox(ctx Context, conn *net.UDPConn) (chan UDPPacket, error) {
 
 func UDPOutbox(ctx Context, conn *net.UDPConn) (chan UDPPacket, error) {
 	udpOut := make(chan UDPPacket)
+	l := ctx.log()
 	go func() {
-		ctx.Log.Debug.Println("UDPOutbox start")
+		l.Debug("UDPOutbox start")
 		for {
 			select {
 			case <-ctx.DoneChan:
-				ctx.Log.Debug.Println("UDPOutbox shutdown")
+				l.Debug("UDPOutbox shutdown")
 				return
 			case packet := <-udpOut:
 				_, err := conn.Write(packet.Payload)
 				if err != nil {
-					ctx.Log.Error.Println(err.Error())
+					l.Error("Write UDP packet", logging.Err(err))
 					continue
 				}
 			}
@@ -127,3 +127,24 @@ func Test_RunUDPOutbox(t *testing.T) {
 	time.Sleep(500 * time.Millisecond)
 
 }
+
+func Test_ListenCluster_Unknown(t *testing.T) {
+	_, err := ListenCluster(&net.UDPAddr{
+		IP:   net.ParseIP("239.1.2.3"),
+		Port: 0,
+	}, "no-such-interface")
+	if err == nil {
+		t.Fatal("Expect an error for an unknown interface")
+	}
+}
+
+func Test_ListenCluster_Unicast(t *testing.T) {
+	conn, err := ListenCluster(&net.UDPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 0,
+	}, "no-such-interface")
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn.Close()
+}
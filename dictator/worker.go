@@ -0,0 +1,218 @@
+package dictator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/ite/logging"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DefaultCommandWorkers   = 4
+	DefaultCommandQueueSize = 16
+	DefaultCommandTimeout   = 30 * time.Second
+)
+
+type (
+	// Führt Befehle auf einer festen Anzahl von goroutines aus, damit ein
+	// langsamer Handler nicht die Heartbeats in LoopNode blockiert.
+	CommandPool struct {
+		ctx     context.Context
+		queue   chan commandJob
+		timeout time.Duration
+		mutex   *sync.Mutex
+		running map[string]context.CancelFunc
+		wg      *sync.WaitGroup
+	}
+
+	commandJob struct {
+		nCtx    NodeContext
+		payload DictatorPayload
+		blob    CommandBlob
+		ctx     context.Context
+	}
+)
+
+// Startet workers goroutines welche bis zum Schließen des AppContext
+// laufen. timeout begrenzt die Laufzeit jedes Befehls, 0 bedeutet ohne
+// Begrenzung.
+func NewCommandPool(appCtx Context, workers, queueSize int, timeout time.Duration) *CommandPool {
+	ctx := appCtx.Ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	p := &CommandPool{
+		ctx:     ctx,
+		queue:   make(chan commandJob, queueSize),
+		timeout: timeout,
+		mutex:   &sync.Mutex{},
+		running: map[string]context.CancelFunc{},
+		wg:      &sync.WaitGroup{},
+	}
+
+	for x := 0; x < workers; x++ {
+		go p.work()
+	}
+
+	return p
+}
+
+// Reiht den Befehl in die Warteschlange ein. Ist diese voll erhält der
+// Diktator eine Antwort mit dem Status StatusRejected.
+func (p *CommandPool) Submit(nCtx NodeContext, payload DictatorPayload) error {
+	blob := CommandBlob{}
+	err := bson.Unmarshal(payload.Blob, &blob)
+	if err != nil {
+		return SendCommandError(nCtx, payload, NewCommandError(StatusBadPayload, err.Error()))
+	}
+
+	if !blob.isFor(nCtx.NodeID) {
+		return nil
+	}
+
+	p.mutex.Lock()
+	_, exists := p.running[blob.ID]
+	p.mutex.Unlock()
+	if exists {
+		errMsg := fmt.Sprintf("Command %v is already running", blob.ID)
+		return SendCommandError(nCtx, payload, NewCommandError(StatusRejected, errMsg))
+	}
+
+	// Ältere Diktatoren senden Befehle ohne ID
+	if blob.ID == "" {
+		blob.ID, err = NewCommandID()
+		if err != nil {
+			return err
+		}
+	}
+
+	var ctx context.Context
+	var cancel context.CancelFunc
+	if p.timeout > 0 {
+		ctx, cancel = context.WithTimeout(p.ctx, p.timeout)
+	} else {
+		ctx, cancel = context.WithCancel(p.ctx)
+	}
+
+	p.mutex.Lock()
+	p.running[blob.ID] = cancel
+	p.mutex.Unlock()
+	p.wg.Add(1)
+
+	job := commandJob{
+		nCtx:    nCtx,
+		payload: payload,
+		blob:    blob,
+		ctx:     ctx,
+	}
+
+	select {
+	case p.queue <- job:
+		return nil
+	default:
+		p.finish(blob.ID)
+		nCtx.Cmd = NewCommandContext(ctx, nCtx, payload, blob)
+		return SendCommandError(nCtx, payload, NewCommandError(StatusRejected, "Command queue is full"))
+	}
+}
+
+// Bricht den Befehl mit der ID id ab. Gibt false zurück wenn kein solcher
+// Befehl läuft oder wartet.
+func (p *CommandPool) Cancel(id string) bool {
+	p.mutex.Lock()
+	cancel, ok := p.running[id]
+	p.mutex.Unlock()
+	if !ok {
+		return false
+	}
+
+	cancel()
+	return true
+}
+
+// IDs aller wartenden und laufenden Befehle
+func (p *CommandPool) Running() []string {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	ids := []string{}
+	for id := range p.running {
+		ids = append(ids, id)
+	}
+
+	return ids
+}
+
+// Wartet bis alle angenommenen Befehle beendet sind
+func (p *CommandPool) Wait() {
+	p.wg.Wait()
+}
+
+// Wie Wait, gibt aber false zurück wenn nach timeout noch Befehle laufen
+func (p *CommandPool) WaitTimeout(timeout time.Duration) bool {
+	done := make(chan struct{})
+	go func() {
+		p.wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-time.After(timeout):
+		return false
+	}
+}
+
+func (p *CommandPool) work() {
+	for {
+		select {
+		case <-p.ctx.Done():
+			// Befehle die noch in der Warteschlange stehen werden
+			// nicht mehr ausgeführt
+			for {
+				select {
+				case job := <-p.queue:
+					p.finish(job.blob.ID)
+				default:
+					return
+				}
+			}
+		case job := <-p.queue:
+			p.run(job)
+		}
+	}
+}
+
+func (p *CommandPool) run(job commandJob) {
+	defer p.finish(job.blob.ID)
+
+	nCtx := job.nCtx
+	nCtx.Cmd = NewCommandContext(job.ctx, nCtx, job.payload, job.blob)
+
+	err := nCtx.Mission.CommandRouter.Dispatch(nCtx, job.payload)
+	if err != nil {
+		nCtx.log().Error(
+			"Dispatch command",
+			logging.KeyCommand, job.blob.Name,
+			logging.KeyCommandID, job.blob.ID,
+			logging.Err(err),
+		)
+	}
+}
+
+func (p *CommandPool) finish(id string) {
+	p.mutex.Lock()
+	cancel, ok := p.running[id]
+	delete(p.running, id)
+	p.mutex.Unlock()
+
+	if ok {
+		cancel()
+		p.wg.Done()
+	}
+}
@@ -0,0 +1,178 @@
+package dictator
+
+import (
+	"testing"
+	"time"
+)
+
+func makeTestPoolNode(pool *CommandPool, router CommandRouter, udpOut chan UDPPacket) NodeContext {
+	return NodeContext{
+		NodeID:     "2",
+		AppContext: NewContext(),
+		UDPOut:     udpOut,
+		Workers:    pool,
+		Mission: MissionSpecs{
+			CommandRouter: router,
+		},
+	}
+}
+
+func Test_CommandPool_Progress(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	release := make(chan struct{})
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		err := nCtx.Cmd.Progress(50)
+		if err != nil {
+			return err
+		}
+		<-release
+		return SendCommandResponse(nCtx, p, StatusOK, 100)
+	})
+
+	udpOut := make(chan UDPPacket, 2)
+	pool := NewCommandPool(ctx, 1, 1, 0)
+	nodeCtx := makeTestPoolNode(pool, router, udpOut)
+
+	packet := makeTestCommandPacket(t, "1", "test", nil)
+	// HandlePacket darf nicht auf den Handler warten
+	err := nodeCtx.HandlePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	progress := readTestCommandResponse(t, <-udpOut)
+	if progress.Status != StatusProgress {
+		t.Fatal("Expect", StatusProgress, "was", progress.Status)
+	}
+	if progress.CommandID == "" {
+		t.Fatal("Expect a command id")
+	}
+
+	if len(pool.Running()) != 1 {
+		t.Fatal("Expect 1 running command was", len(pool.Running()))
+	}
+
+	close(release)
+
+	final := readTestCommandResponse(t, <-udpOut)
+	if final.Status != StatusOK {
+		t.Fatal("Expect", StatusOK, "was", final.Status)
+	}
+	if final.CommandID != progress.CommandID {
+		t.Fatal("Expect", progress.CommandID, "was", final.CommandID)
+	}
+
+	pool.Wait()
+	if len(pool.Running()) != 0 {
+		t.Fatal("Expect no running command was", len(pool.Running()))
+	}
+}
+
+func Test_CommandPool_Cancel(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	started := make(chan string)
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		started <- nCtx.Cmd.ID
+		<-nCtx.Cmd.Ctx.Done()
+		return nCtx.Cmd.Ctx.Err()
+	})
+
+	udpOut := make(chan UDPPacket, 1)
+	pool := NewCommandPool(ctx, 1, 1, 0)
+	nodeCtx := makeTestPoolNode(pool, router, udpOut)
+
+	err := nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cmdID := <-started
+	cancel, err := NewCancelPacket("1", cmdID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nodeCtx.HandlePacket(cancel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusRejected {
+		t.Fatal("Expect", StatusRejected, "was", resp.Status)
+	}
+	if resp.CommandID != cmdID {
+		t.Fatal("Expect", cmdID, "was", resp.CommandID)
+	}
+}
+
+func Test_CommandPool_Timeout(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		<-nCtx.Cmd.Ctx.Done()
+		return nCtx.Cmd.Ctx.Err()
+	})
+
+	udpOut := make(chan UDPPacket, 1)
+	pool := NewCommandPool(ctx, 1, 1, 50*time.Millisecond)
+	nodeCtx := makeTestPoolNode(pool, router, udpOut)
+
+	err := nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusTimeout {
+		t.Fatal("Expect", StatusTimeout, "was", resp.Status)
+	}
+}
+
+func Test_CommandPool_QueueFull(t *testing.T) {
+	ctx := NewContext()
+	defer ctx.Done()
+
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	router := CommandRouter{}
+	router.AddHandler("test", func(nCtx NodeContext, p DictatorPayload) error {
+		started <- struct{}{}
+		<-release
+		return nil
+	})
+
+	udpOut := make(chan UDPPacket, 1)
+	pool := NewCommandPool(ctx, 1, 1, 0)
+	nodeCtx := makeTestPoolNode(pool, router, udpOut)
+
+	// Erster Befehl läuft, zweiter wartet, dritter wird abgelehnt
+	err := nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	<-started
+	err = nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", nil))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = nodeCtx.HandlePacket(makeTestCommandPacket(t, "1", "test", nil))
+	if err == nil {
+		t.Fatal("Expect HandlePacket to return a error")
+	}
+
+	resp := readTestCommandResponse(t, <-udpOut)
+	if resp.Status != StatusRejected {
+		t.Fatal("Expect", StatusRejected, "was", resp.Status)
+	}
+
+	close(release)
+	pool.Wait()
+}
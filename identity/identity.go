@@ -0,0 +1,160 @@
+// Bestimmt die ID einer Node so, dass der Cluster diese nach einem
+// Neustart wiedererkennt
+package identity
+
+import (
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/rrawrriw/ite/dictator"
+)
+
+const (
+	// Bei jedem Start eine neue zufällige ID
+	SourceRandom = "random"
+	// Beim ersten Start zufällig erzeugt und in einer Datei gespeichert
+	SourceFile = "file"
+	// Aus der machine-id des Systems abgeleitet
+	SourceMachineID = "machine-id"
+	// Aus der MAC Adresse des Interface abgeleitet
+	SourceMAC = "mac"
+)
+
+var (
+	UnknownSourceError = errors.New("Unknown identity source")
+	NoMACError         = errors.New("Interface has no MAC address")
+
+	// Pfad der machine-id, siehe machine-id(5)
+	MachineIDPath = "/etc/machine-id"
+
+	validID = regexp.MustCompile(`^[0-9A-Za-z._-]{1,64}$`)
+)
+
+// Alle bekannten Quellen
+func Sources() []string {
+	return []string{SourceRandom, SourceFile, SourceMachineID, SourceMAC}
+}
+
+// Bestimmt die ID aus source. stateFile wird nur von SourceFile, iface nur
+// von SourceMAC verwendet.
+func Load(source, stateFile, iface string) (string, error) {
+	switch source {
+	case SourceRandom:
+		return dictator.NewNodeID()
+	case SourceFile:
+		return FromFile(stateFile)
+	case SourceMachineID:
+		return FromMachineID(MachineIDPath)
+	case SourceMAC:
+		return FromMAC(iface)
+	}
+
+	return "", fmt.Errorf("%w %q", UnknownSourceError, source)
+}
+
+// Liest die ID aus path. Gibt es die Datei noch nicht, wird eine zufällige
+// ID erzeugt und gespeichert.
+func FromFile(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err == nil {
+		id := strings.TrimSpace(string(b))
+		if !ValidID(id) {
+			return "", fmt.Errorf("Invalid node ID %q in %v", id, path)
+		}
+		return id, nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return "", err
+	}
+
+	id, err := dictator.NewNodeID()
+	if err != nil {
+		return "", err
+	}
+
+	err = writeFile(path, id+"\n")
+	if err != nil {
+		return "", fmt.Errorf("Cannot store node ID: %w", err)
+	}
+
+	return id, nil
+}
+
+// Leitet die ID aus der machine-id in path ab. Die machine-id selbst wird
+// nicht verschickt.
+func FromMachineID(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+
+	machineID := strings.TrimSpace(string(b))
+	if machineID == "" {
+		return "", fmt.Errorf("Empty machine-id in %v", path)
+	}
+
+	return derive("machine-id", machineID), nil
+}
+
+// Leitet die ID aus der MAC Adresse von iface ab
+func FromMAC(iface string) (string, error) {
+	i, err := net.InterfaceByName(iface)
+	if err != nil {
+		return "", err
+	}
+	if len(i.HardwareAddr) == 0 {
+		return "", fmt.Errorf("%w: %v", NoMACError, iface)
+	}
+
+	return derive("mac", i.HardwareAddr.String()), nil
+}
+
+// Prüft ob id als Node ID taugt. Gespeicherte IDs dürfen auch von Hand
+// vergeben werden.
+func ValidID(id string) bool {
+	return validID.MatchString(id)
+}
+
+// Gleiches Format wie dictator.NewNodeID
+func derive(kind, value string) string {
+	return fmt.Sprintf("%x", sha1.Sum([]byte("ite:"+kind+":"+value)))
+}
+
+// Schreibt erst in eine temporäre Datei, damit ein Absturz keine halbe ID
+// hinterlässt
+func writeFile(path, content string) error {
+	dir := filepath.Dir(path)
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.CreateTemp(dir, ".node-id-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+
+	_, err = f.WriteString(content)
+	if err == nil {
+		err = f.Sync()
+	}
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Chmod(f.Name(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(f.Name(), path)
+}
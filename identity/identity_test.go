@@ -0,0 +1,146 @@
+package identity
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func Test_FromFile_Create(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "state", "node-id")
+
+	id, err := FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ValidID(id) || len(id) != 40 {
+		t.Fatal("Expect 40 hex chars was", id)
+	}
+
+	again, err := FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again != id {
+		t.Fatal("Expect", id, "was", again)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Fatal("Expect", os.FileMode(0644), "was", info.Mode().Perm())
+	}
+}
+
+func Test_FromFile_Existing(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node-id")
+	err := os.WriteFile(path, []byte("gateway-1\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := FromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id != "gateway-1" {
+		t.Fatal("Expect gateway-1 was", id)
+	}
+}
+
+func Test_FromFile_Invalid(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "node-id")
+	err := os.WriteFile(path, []byte("two words\n"), 0644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = FromFile(path)
+	if err == nil {
+		t.Fatal("Expect error was nil")
+	}
+}
+
+func Test_FromMachineID(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "machine-id")
+	err := os.WriteFile(path, []byte("b08dfa6083e7567a1921a715000001fb\n"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id1, err := FromMachineID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := FromMachineID(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 {
+		t.Fatal("Expect", id1, "was", id2)
+	}
+	if id1 == "b08dfa6083e7567a1921a715000001fb" {
+		t.Fatal("Expect derived ID was the machine-id")
+	}
+
+	empty := filepath.Join(dir, "empty")
+	err = os.WriteFile(empty, []byte("\n"), 0444)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = FromMachineID(empty)
+	if err == nil {
+		t.Fatal("Expect error was nil")
+	}
+}
+
+func Test_FromMAC(t *testing.T) {
+	ifaces, err := net.Interfaces()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, i := range ifaces {
+		if len(i.HardwareAddr) == 0 {
+			_, err := FromMAC(i.Name)
+			if !errors.Is(err, NoMACError) {
+				t.Fatal("Expect", NoMACError, "was", err)
+			}
+			continue
+		}
+
+		id, err := FromMAC(i.Name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if id != derive("mac", i.HardwareAddr.String()) {
+			t.Fatal("Expect ID derived from", i.HardwareAddr, "was", id)
+		}
+	}
+}
+
+func Test_Load_UnknownSource(t *testing.T) {
+	_, err := Load("hostname", "", "")
+	if !errors.Is(err, UnknownSourceError) {
+		t.Fatal("Expect", UnknownSourceError, "was", err)
+	}
+}
+
+func Test_Load_Random(t *testing.T) {
+	id1, err := Load(SourceRandom, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := Load(SourceRandom, "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 == id2 {
+		t.Fatal("Expect different IDs was", id1)
+	}
+}
@@ -0,0 +1,155 @@
+// Setzt Adressen, Routen und DNS Server eines Interfaces. Netlink ändert
+// das Interface über rtnetlink, Recorder zeichnet die Änderungen nur auf.
+package ifconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+)
+
+const DefaultResolvConf = "/etc/resolv.conf"
+
+var (
+	InvalidSettingsError = errors.New("Invalid interface settings")
+	UnsupportedError     = errors.New("Interface configuration is only supported on Linux")
+)
+
+type (
+	// Eine Route über iface. Ohne Dst ist es die Default Route, ohne
+	// Gateway ist das Ziel direkt am Link erreichbar.
+	Route struct {
+		Dst     *net.IPNet
+		Gateway net.IP
+	}
+
+	// Alles was Apply auf einem Interface setzt
+	Settings struct {
+		// Die Adresse mit der Maske des Netzes, z.B. 10.0.0.5/24
+		Address *net.IPNet
+		Routes  []Route
+		// Leer lässt die resolv.conf unverändert
+		DNS []net.IP
+	}
+
+	Configurator interface {
+		// Die IPv4 Adressen von iface
+		Addresses(iface string) ([]*net.IPNet, error)
+		// Fügt addr hinzu oder ersetzt sie falls sie bereits existiert
+		AddAddress(iface string, addr *net.IPNet) error
+		RemoveAddress(iface string, addr *net.IPNet) error
+		LinkUp(iface string) error
+		// Fügt r hinzu oder ersetzt die Route zum selben Ziel
+		ReplaceRoute(iface string, r Route) error
+		WriteResolvConf(dns []net.IP) error
+	}
+)
+
+func (r Route) String() string {
+	dst := "default"
+	if r.Dst != nil {
+		dst = r.Dst.String()
+	}
+	if r.Gateway == nil {
+		return dst
+	}
+
+	return dst + " via " + r.Gateway.String()
+}
+
+func (s Settings) Validate() error {
+	if s.Address == nil || s.Address.IP.To4() == nil {
+		return fmt.Errorf("%w: no IPv4 address", InvalidSettingsError)
+	}
+	if ones, bits := s.Address.Mask.Size(); bits != 32 || ones == 0 {
+		return fmt.Errorf("%w: %v has no IPv4 network mask", InvalidSettingsError, s.Address)
+	}
+	for _, r := range s.Routes {
+		if r.Gateway != nil && r.Gateway.To4() == nil {
+			return fmt.Errorf("%w: gateway of route %v is not an IPv4 address", InvalidSettingsError, r)
+		}
+	}
+
+	return nil
+}
+
+// Das Netz der Adresse, z.B. 10.0.0.0/24
+func (s Settings) Network() *net.IPNet {
+	return &net.IPNet{
+		IP:   s.Address.IP.Mask(s.Address.Mask),
+		Mask: s.Address.Mask,
+	}
+}
+
+// Aktiviert iface und setzt die Adresse, die Routen und die DNS Server
+// aus s. Andere Adressen aus dem selben Netz, z.B. von einem früheren
+// Diktator, werden vorher entfernt.
+func Apply(c Configurator, iface string, s Settings) error {
+	err := s.Validate()
+	if err != nil {
+		return err
+	}
+
+	err = c.LinkUp(iface)
+	if err != nil {
+		return err
+	}
+
+	current, err := c.Addresses(iface)
+	if err != nil {
+		return err
+	}
+	network := s.Network()
+	for _, addr := range current {
+		if addr.IP.Equal(s.Address.IP) || !(network.Contains(addr.IP) || addr.Contains(s.Address.IP)) {
+			continue
+		}
+		err = c.RemoveAddress(iface, addr)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = c.AddAddress(iface, s.Address)
+	if err != nil {
+		return err
+	}
+	for _, r := range s.Routes {
+		err = c.ReplaceRoute(iface, r)
+		if err != nil {
+			return fmt.Errorf("route %v: %w", r, err)
+		}
+	}
+	if len(s.DNS) == 0 {
+		return nil
+	}
+
+	return c.WriteResolvConf(s.DNS)
+}
+
+// Ersetzt die Datei path atomar durch eine resolv.conf mit den Servern dns
+func WriteResolvConf(path string, dns []net.IP) error {
+	buf := bytes.Buffer{}
+	buf.WriteString("# Written by ite\n")
+	for _, s := range dns {
+		fmt.Fprintf(&buf, "nameserver %v\n", s)
+	}
+
+	tmp := path + ".tmp"
+	err := os.WriteFile(tmp, buf.Bytes(), 0644)
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, path)
+}
+
+func resolvConf(path string) string {
+	if path == "" {
+		return DefaultResolvConf
+	}
+
+	return path
+}
@@ -0,0 +1,110 @@
+package ifconfig
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func parseTestCIDR(t *testing.T, cidr string) *net.IPNet {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	network.IP = ip.To4()
+
+	return network
+}
+
+func Test_Apply(t *testing.T) {
+	r := NewRecorder(nil)
+	s := Settings{
+		Address: parseTestCIDR(t, "10.0.0.5/24"),
+		Routes: []Route{
+			{Gateway: net.ParseIP("10.0.0.1")},
+			{Dst: parseTestCIDR(t, "172.16.0.0/16"), Gateway: net.ParseIP("10.0.0.2")},
+			{Dst: parseTestCIDR(t, "10.1.0.0/16")},
+		},
+		DNS: []net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("1.1.1.1")},
+	}
+
+	err := Apply(r, "eth0", s)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expect := []string{
+		"link set dev eth0 up",
+		"addr replace 10.0.0.5/24 dev eth0",
+		"route replace default via 10.0.0.1 dev eth0",
+		"route replace 172.16.0.0/16 via 10.0.0.2 dev eth0",
+		"route replace 10.1.0.0/16 dev eth0",
+		"resolv.conf nameserver 10.0.0.1 1.1.1.1",
+	}
+	if !reflect.DeepEqual(r.Ops(), expect) {
+		t.Fatal("Expect", expect, "was", r.Ops())
+	}
+}
+
+// Eine Adresse aus dem selben Netz wird ersetzt, andere bleiben
+func Test_Apply_ReplacesAddress(t *testing.T) {
+	r := NewRecorder(nil)
+	r.AddAddress("eth0", parseTestCIDR(t, "10.0.0.5/24"))
+	r.AddAddress("eth0", parseTestCIDR(t, "192.168.1.2/24"))
+
+	err := Apply(r, "eth0", Settings{Address: parseTestCIDR(t, "10.0.0.6/24")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	addrs, _ := r.Addresses("eth0")
+	if len(addrs) != 2 || addrs[0].String() != "192.168.1.2/24" || addrs[1].String() != "10.0.0.6/24" {
+		t.Fatal("Expect 192.168.1.2/24 and 10.0.0.6/24 was", addrs)
+	}
+
+	// Die selbe Adresse erneut zu setzen entfernt nichts
+	err = Apply(r, "eth0", Settings{Address: parseTestCIDR(t, "10.0.0.6/24")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ops := r.Ops()
+	if ops[len(ops)-1] != "addr replace 10.0.0.6/24 dev eth0" || ops[len(ops)-2] != "link set dev eth0 up" {
+		t.Fatal("Expect only link up and addr replace was", ops)
+	}
+}
+
+func Test_Apply_Invalid(t *testing.T) {
+	invalid := []Settings{
+		{},
+		{Address: parseTestCIDR(t, "fd00::1/64")},
+		{Address: &net.IPNet{IP: net.ParseIP("10.0.0.5").To4()}},
+		{Address: parseTestCIDR(t, "10.0.0.5/24"), Routes: []Route{{Gateway: net.ParseIP("fd00::1")}}},
+	}
+
+	for _, s := range invalid {
+		r := NewRecorder(nil)
+		err := Apply(r, "eth0", s)
+		if err == nil || len(r.Ops()) != 0 {
+			t.Fatal("Expect", InvalidSettingsError, "for", s, "was", err, r.Ops())
+		}
+	}
+}
+
+func Test_WriteResolvConf(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "resolv.conf")
+	err := Netlink{ResolvConf: path}.WriteResolvConf([]net.IP{net.ParseIP("10.0.0.1"), net.ParseIP("fd00::53")})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := "# Written by ite\nnameserver 10.0.0.1\nnameserver fd00::53\n"
+	if string(data) != expect {
+		t.Fatal("Expect", expect, "was", string(data))
+	}
+}
@@ -0,0 +1,91 @@
+//go:build linux
+
+package ifconfig
+
+import (
+	"errors"
+	"net"
+
+	"github.com/vishvananda/netlink"
+)
+
+// Ändert die Interfaces über rtnetlink im Network Namespace des
+// aufrufenden Threads. Benötigt CAP_NET_ADMIN.
+type Netlink struct {
+	// Ohne wird DefaultResolvConf geschrieben
+	ResolvConf string
+}
+
+func (Netlink) Addresses(iface string) ([]*net.IPNet, error) {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return nil, err
+	}
+
+	// Bei einem unterbrochenen Dump ist die Liste trotzdem brauchbar,
+	// Apply entfernt damit höchstens eine Adresse zu wenig
+	addrs, err := netlink.AddrList(link, netlink.FAMILY_V4)
+	if err != nil && !errors.Is(err, netlink.ErrDumpInterrupted) {
+		return nil, err
+	}
+
+	nets := make([]*net.IPNet, len(addrs))
+	for i, a := range addrs {
+		nets[i] = a.IPNet
+	}
+
+	return nets, nil
+}
+
+func (Netlink) AddAddress(iface string, addr *net.IPNet) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+
+	return netlink.AddrReplace(link, &netlink.Addr{IPNet: addr})
+}
+
+func (Netlink) RemoveAddress(iface string, addr *net.IPNet) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+
+	return netlink.AddrDel(link, &netlink.Addr{IPNet: addr})
+}
+
+func (Netlink) LinkUp(iface string) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+
+	return netlink.LinkSetUp(link)
+}
+
+func (Netlink) ReplaceRoute(iface string, r Route) error {
+	link, err := netlink.LinkByName(iface)
+	if err != nil {
+		return err
+	}
+
+	dst := r.Dst
+	if dst == nil {
+		dst = &net.IPNet{IP: net.IPv4zero.To4(), Mask: net.CIDRMask(0, 32)}
+	}
+	route := netlink.Route{
+		LinkIndex: link.Attrs().Index,
+		Dst:       dst,
+		Gw:        r.Gateway,
+	}
+	if r.Gateway == nil {
+		route.Scope = netlink.SCOPE_LINK
+	}
+
+	return netlink.RouteReplace(&route)
+}
+
+func (n Netlink) WriteResolvConf(dns []net.IP) error {
+	return WriteResolvConf(resolvConf(n.ResolvConf), dns)
+}
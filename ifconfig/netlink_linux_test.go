@@ -0,0 +1,129 @@
+//go:build linux
+
+package ifconfig
+
+import (
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/vishvananda/netlink"
+	"github.com/vishvananda/netns"
+)
+
+// Führt den Test in einem eigenen Network Namespace mit einem veth Paar
+// ite0/ite1 aus. Benötigt root.
+func withTestNetns(t *testing.T, test func()) {
+	if os.Geteuid() != 0 {
+		t.Skip("Needs root to create a network namespace")
+	}
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	orig, err := netns.Get()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer orig.Close()
+	ns, err := netns.New()
+	if err != nil {
+		t.Skip("Create network namespace:", err)
+	}
+	defer ns.Close()
+	defer netns.Set(orig)
+
+	err = netlink.LinkAdd(&netlink.Veth{
+		LinkAttrs: netlink.LinkAttrs{Name: "ite0"},
+		PeerName:  "ite1",
+	})
+	if err != nil {
+		t.Skip("Create veth pair:", err)
+	}
+
+	test()
+}
+
+func Test_Netlink_Apply(t *testing.T) {
+	withTestNetns(t, func() {
+		c := Netlink{ResolvConf: filepath.Join(t.TempDir(), "resolv.conf")}
+		s := Settings{
+			Address: parseTestCIDR(t, "10.0.0.5/24"),
+			Routes: []Route{
+				{Gateway: net.ParseIP("10.0.0.1")},
+				{Dst: parseTestCIDR(t, "172.16.0.0/16"), Gateway: net.ParseIP("10.0.0.2")},
+				{Dst: parseTestCIDR(t, "10.1.0.0/16")},
+			},
+			DNS: []net.IP{net.ParseIP("10.0.0.1")},
+		}
+
+		err := Apply(c, "ite0", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		link, err := netlink.LinkByName("ite0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if link.Attrs().Flags&net.FlagUp == 0 {
+			t.Fatal("Expect ite0 to be up")
+		}
+
+		addrs, err := c.Addresses("ite0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0].String() != "10.0.0.5/24" {
+			t.Fatal("Expect 10.0.0.5/24 was", addrs)
+		}
+
+		routes, err := netlink.RouteList(link, netlink.FAMILY_V4)
+		if err != nil {
+			t.Fatal(err)
+		}
+		found := map[string]bool{}
+		for _, r := range routes {
+			found[Route{Dst: r.Dst, Gateway: r.Gw}.String()] = true
+		}
+		for _, r := range s.Routes {
+			if !found[r.String()] && !(r.Dst == nil && found["0.0.0.0/0 via 10.0.0.1"]) {
+				t.Fatal("Expect route", r, "was", routes)
+			}
+		}
+
+		// Eine neue Adresse im selben Netz ersetzt die alte
+		s.Address = parseTestCIDR(t, "10.0.0.6/24")
+		err = Apply(c, "ite0", s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, err = c.Addresses("ite0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(addrs) != 1 || addrs[0].String() != "10.0.0.6/24" {
+			t.Fatal("Expect 10.0.0.6/24 was", addrs)
+		}
+
+		err = c.RemoveAddress("ite0", s.Address)
+		if err != nil {
+			t.Fatal(err)
+		}
+		addrs, _ = c.Addresses("ite0")
+		if len(addrs) != 0 {
+			t.Fatal("Expect no address was", addrs)
+		}
+	})
+}
+
+func Test_Netlink_UnknownInterface(t *testing.T) {
+	withTestNetns(t, func() {
+		err := Apply(Netlink{}, "nope0", Settings{Address: parseTestCIDR(t, "10.0.0.5/24")})
+		if err == nil {
+			t.Fatal("Expect an error for an unknown interface")
+		}
+	})
+}
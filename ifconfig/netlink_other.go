@@ -0,0 +1,34 @@
+//go:build !linux
+
+package ifconfig
+
+import "net"
+
+// rtnetlink gibt es nur unter Linux, alle Änderungen schlagen fehl
+type Netlink struct {
+	ResolvConf string
+}
+
+func (Netlink) Addresses(iface string) ([]*net.IPNet, error) {
+	return nil, UnsupportedError
+}
+
+func (Netlink) AddAddress(iface string, addr *net.IPNet) error {
+	return UnsupportedError
+}
+
+func (Netlink) RemoveAddress(iface string, addr *net.IPNet) error {
+	return UnsupportedError
+}
+
+func (Netlink) LinkUp(iface string) error {
+	return UnsupportedError
+}
+
+func (Netlink) ReplaceRoute(iface string, r Route) error {
+	return UnsupportedError
+}
+
+func (n Netlink) WriteResolvConf(dns []net.IP) error {
+	return WriteResolvConf(resolvConf(n.ResolvConf), dns)
+}
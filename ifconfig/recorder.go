@@ -0,0 +1,112 @@
+package ifconfig
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+)
+
+// Ändert nichts am System sondern merkt sich die Adressen und zeichnet
+// jede Änderung in der Schreibweise von iproute2 auf. Für Tests und als
+// Trockenlauf ohne root.
+type Recorder struct {
+	// Optional, jede Änderung wird zusätzlich geloggt
+	Log   *slog.Logger
+	mutex *sync.Mutex
+	ops   []string
+	addrs map[string][]*net.IPNet
+}
+
+func NewRecorder(log *slog.Logger) *Recorder {
+	return &Recorder{
+		Log:   log,
+		mutex: &sync.Mutex{},
+		addrs: map[string][]*net.IPNet{},
+	}
+}
+
+func (r *Recorder) record(format string, args ...interface{}) {
+	op := fmt.Sprintf(format, args...)
+	r.ops = append(r.ops, op)
+	if r.Log != nil {
+		r.Log.Info("Dry run", "op", op)
+	}
+}
+
+// Alle bisherigen Änderungen in ihrer Reihenfolge
+func (r *Recorder) Ops() []string {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]string{}, r.ops...)
+}
+
+func (r *Recorder) Addresses(iface string) ([]*net.IPNet, error) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	return append([]*net.IPNet{}, r.addrs[iface]...), nil
+}
+
+func (r *Recorder) AddAddress(iface string, addr *net.IPNet) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.record("addr replace %v dev %v", addr, iface)
+	for i, a := range r.addrs[iface] {
+		if a.IP.Equal(addr.IP) {
+			r.addrs[iface][i] = addr
+			return nil
+		}
+	}
+	r.addrs[iface] = append(r.addrs[iface], addr)
+
+	return nil
+}
+
+func (r *Recorder) RemoveAddress(iface string, addr *net.IPNet) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.record("addr del %v dev %v", addr, iface)
+	addrs := r.addrs[iface]
+	for i, a := range addrs {
+		if a.IP.Equal(addr.IP) {
+			r.addrs[iface] = append(addrs[:i], addrs[i+1:]...)
+			break
+		}
+	}
+
+	return nil
+}
+
+func (r *Recorder) LinkUp(iface string) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.record("link set dev %v up", iface)
+	return nil
+}
+
+func (r *Recorder) ReplaceRoute(iface string, route Route) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	r.record("route replace %v dev %v", route, iface)
+	return nil
+}
+
+func (r *Recorder) WriteResolvConf(dns []net.IP) error {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	servers := make([]string, len(dns))
+	for i, s := range dns {
+		servers[i] = s.String()
+	}
+	r.record("resolv.conf nameserver %v", strings.Join(servers, " "))
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"log/slog"
+	"net"
+	"time"
+
+	"github.com/rrawrriw/ite/assign"
+	"github.com/rrawrriw/ite/dictator"
+	"github.com/rrawrriw/ite/ifconfig"
+	"github.com/rrawrriw/ite/logging"
+)
+
+const (
+	// Abstand in welchem der Diktator die Adressen der Nodes abfragt
+	assignInterval = 1 * time.Second
+	// So lange wartet ein Angebot auf die Bestätigung der Node, danach
+	// wird es erneut gesendet
+	assignTimeout = 5 * time.Second
+	// Antworten der Followers welche auf den Diktator warten können
+	assignResponseBuffer = 64
+	// Antwortet eine Node so lange auf keine Abfrage, wird ihre Adresse
+	// wieder frei
+	assignExpire = 30 * time.Second
+)
+
+// Verteilt als Diktator die Adressen aus pool. Eine Abfrage ohne Adresse
+// geht an alle Nodes, jede Node ohne gültige Adresse erhält danach ein
+// gezieltes AssignIP.
+type assigner struct {
+	pool *assign.Pool
+	// Sendet AssignIP an target, leer an alle Nodes
+	send func(target string, a assign.Assignment) (string, error)
+	log  *slog.Logger
+	// Offene Abfragen und Zuweisungen nach Command ID
+	queries map[string]time.Time
+	pending map[string]pendingAssignment
+}
+
+type pendingAssignment struct {
+	NodeID string
+	Sent   time.Time
+}
+
+func newAssigner(pool *assign.Pool, send func(string, assign.Assignment) (string, error), log *slog.Logger) *assigner {
+	return &assigner{
+		pool:    pool,
+		send:    send,
+		log:     log,
+		queries: map[string]time.Time{},
+		pending: map[string]pendingAssignment{},
+	}
+}
+
+// Fragt alle Nodes nach ihrer Adresse, vergisst Befehle auf welche keine
+// Antwort mehr kommt und gibt die Adressen verschwundener Nodes frei
+func (a *assigner) query() error {
+	for _, h := range a.pool.Expire(assignExpire) {
+		a.log.Info("Release address of silent node", logging.KeyNode, h.NodeID, "ip", h.Assignment.Address)
+	}
+	for id, sent := range a.queries {
+		if time.Since(sent) > dictator.DefaultCommandTimeout {
+			delete(a.queries, id)
+		}
+	}
+	for id, p := range a.pending {
+		if time.Since(p.Sent) > dictator.DefaultCommandTimeout {
+			delete(a.pending, id)
+		}
+	}
+
+	id, err := a.send("", assign.Assignment{})
+	if err != nil {
+		return err
+	}
+	a.queries[id] = time.Now()
+
+	return nil
+}
+
+// Verarbeitet die Antwort einer Node auf AssignIP
+func (a *assigner) handle(payload dictator.DictatorPayload) {
+	result := assign.Result{}
+	resp, err := dictator.ReadCommandResult(payload, &result)
+	if err != nil {
+		a.log.Warn("Read AssignIP response", logging.Err(err))
+		return
+	}
+	if resp.Status == dictator.StatusProgress {
+		return
+	}
+	log := a.log.With(logging.KeyNode, resp.NodeID)
+
+	p, ok := a.pending[resp.CommandID]
+	if ok {
+		delete(a.pending, resp.CommandID)
+		if resp.Status != dictator.StatusOK {
+			log.Warn("Node rejected address", "status", dictator.StatusText(resp.Status), "error", resp.Error)
+			a.pool.Release(p.NodeID)
+			return
+		}
+
+		err := a.pool.Confirm(p.NodeID, result.Address)
+		if err != nil {
+			log.Warn("Confirm address", logging.Err(err))
+			return
+		}
+		log.Info("Address assigned", "ip", result.Address)
+		return
+	}
+
+	if _, ok := a.queries[resp.CommandID]; !ok || resp.Status != dictator.StatusOK {
+		return
+	}
+	a.pool.Seen(resp.NodeID)
+
+	h, ok := a.pool.Holder(resp.NodeID)
+	switch {
+	case ok && h.State == assign.StateConfirmed && h.Assignment.Address == result.Address:
+		return
+	case ok && h.State == assign.StateOffered && time.Since(h.Since) < assignTimeout:
+		return
+	case !ok && result.Address != "" && a.pool.Adopt(resp.NodeID, result.Address):
+		log.Info("Node keeps its address", "ip", result.Address)
+		return
+	}
+
+	offer, err := a.pool.Offer(resp.NodeID)
+	if err != nil {
+		log.Error("Offer address", logging.Err(err))
+		return
+	}
+	id, err := a.send(resp.NodeID, offer)
+	if err != nil {
+		log.Error("Send AssignIP", logging.Err(err))
+		a.pool.Release(resp.NodeID)
+		return
+	}
+	a.pending[id] = pendingAssignment{
+		NodeID: resp.NodeID,
+		Sent:   time.Now(),
+	}
+	log.Debug("Offer address", "assignment", offer.String())
+}
+
+// Fragt alle assignInterval ab und verarbeitet die Antworten bis stop
+// geschlossen wird
+func (a *assigner) run(responses <-chan dictator.DictatorPayload, stop <-chan struct{}) {
+	ticker := time.NewTicker(assignInterval)
+	defer ticker.Stop()
+
+	for {
+		err := a.query()
+		if err != nil {
+			a.log.Error("Send AssignIP", logging.Err(err))
+		}
+
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+		case payload := <-responses:
+			a.handle(payload)
+			for len(responses) > 0 {
+				a.handle(<-responses)
+			}
+			select {
+			case <-stop:
+				return
+			case <-ticker.C:
+			}
+		}
+	}
+}
+
+// Die Einstellungen für das Interface aus einer gültigen Assignment
+func assignmentSettings(a assign.Assignment) ifconfig.Settings {
+	s := ifconfig.Settings{
+		Address: &net.IPNet{
+			IP:   net.ParseIP(a.Address).To4(),
+			Mask: net.CIDRMask(a.Prefix, 32),
+		},
+	}
+	if a.Gateway != "" {
+		s.Routes = []ifconfig.Route{{Gateway: net.ParseIP(a.Gateway)}}
+	}
+	for _, dns := range a.DNS {
+		s.DNS = append(s.DNS, net.ParseIP(dns))
+	}
+
+	return s
+}
+
+// Führt AssignIP auf einem Follower aus. Eine Abfrage beantwortet die
+// Node mit ihrer aktuellen Adresse, eine Zuweisung setzt sie über c auf
+// iface und bestätigt sie mit der neuen Adresse.
+func newAssignIPHandler(iface string, c ifconfig.Configurator, lease *leaseTracker) dictator.TypedCommandHandler[assign.Assignment, assign.Result] {
+	return func(nCtx dictator.NodeContext, payload dictator.DictatorPayload, a assign.Assignment) (assign.Result, error) {
+		log := nCtx.AppContext.Log
+		if a.IsQuery() {
+			ip := lease.IP()
+			if ip == nil {
+				return assign.Result{}, nil
+			}
+			return assign.Result{Address: ip.String()}, nil
+		}
+
+		err := a.Validate()
+		if err != nil {
+			return assign.Result{}, dictator.NewCommandError(dictator.StatusBadPayload, err.Error())
+		}
+		settings := assignmentSettings(a)
+		err = ifconfig.Apply(c, iface, settings)
+		if err != nil {
+			return assign.Result{}, err
+		}
+		lease.SetAddress(settings.Address, 0)
+		log.Info("Address assigned", "assignment", a.String(), logging.KeyDictator, payload.DictatorID)
+
+		return assign.Result{Address: a.Address}, nil
+	}
+}
@@ -0,0 +1,207 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"testing"
+
+	"github.com/rrawrriw/ite/assign"
+	"github.com/rrawrriw/ite/dictator"
+	"github.com/rrawrriw/ite/ifconfig"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type testSent struct {
+	Target     string
+	Assignment assign.Assignment
+}
+
+// Ein assigner welcher die gesendeten Befehle aufzeichnet
+func newTestAssigner(t *testing.T) (*assigner, *[]testSent) {
+	pool, err := assign.NewPool("10.0.0.0/29", "10.0.0.1", []string{"10.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sent := []testSent{}
+	send := func(target string, a assign.Assignment) (string, error) {
+		sent = append(sent, testSent{target, a})
+		return fmt.Sprintf("cmd%v", len(sent)), nil
+	}
+
+	return newAssigner(pool, send, slog.New(slog.NewTextHandler(io.Discard, nil))), &sent
+}
+
+func makeTestResponse(t *testing.T, cmdID, nodeID string, status int, address string) dictator.DictatorPayload {
+	blob, err := bson.Marshal(dictator.CommandResponseBlob{
+		CommandID: cmdID,
+		NodeID:    nodeID,
+		Status:    status,
+		Result:    assign.Result{Address: address},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return dictator.DictatorPayload{
+		Type: 3,
+		Blob: blob,
+	}
+}
+
+func Test_Assigner_AssignAndConfirm(t *testing.T) {
+	a, sent := newTestAssigner(t)
+
+	err := a.query()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(*sent) != 1 || (*sent)[0].Target != "" || !(*sent)[0].Assignment.IsQuery() {
+		t.Fatal("Expect a broadcast query was", *sent)
+	}
+
+	a.handle(makeTestResponse(t, "cmd1", "node1", dictator.StatusOK, ""))
+	if len(*sent) != 2 {
+		t.Fatal("Expect an AssignIP to node1 was", *sent)
+	}
+	offer := (*sent)[1]
+	if offer.Target != "node1" || offer.Assignment.Address != "10.0.0.2" || offer.Assignment.Prefix != 29 || offer.Assignment.Gateway != "10.0.0.1" {
+		t.Fatal("Expect 10.0.0.2/29 via 10.0.0.1 for node1 was", offer)
+	}
+
+	// Eine weitere Antwort auf die Abfrage löst kein zweites Angebot aus
+	a.handle(makeTestResponse(t, "cmd1", "node1", dictator.StatusOK, ""))
+	if len(*sent) != 2 {
+		t.Fatal("Expect no second offer was", *sent)
+	}
+
+	a.handle(makeTestResponse(t, "cmd2", "node1", dictator.StatusOK, "10.0.0.2"))
+	h, ok := a.pool.Holder("node1")
+	if !ok || h.State != assign.StateConfirmed || h.Assignment.Address != "10.0.0.2" {
+		t.Fatal("Expect node1 to hold 10.0.0.2 was", h)
+	}
+
+	// Nach der Bestätigung bleibt die Adresse bei der Node
+	a.query()
+	a.handle(makeTestResponse(t, "cmd3", "node1", dictator.StatusOK, "10.0.0.2"))
+	if len(*sent) != 3 {
+		t.Fatal("Expect only the query was", *sent)
+	}
+}
+
+func Test_Assigner_Rejected(t *testing.T) {
+	a, sent := newTestAssigner(t)
+	a.query()
+	a.handle(makeTestResponse(t, "cmd1", "node1", dictator.StatusOK, ""))
+	a.handle(makeTestResponse(t, "cmd2", "node1", dictator.StatusHandlerError, ""))
+
+	if _, ok := a.pool.Holder("node1"); ok {
+		t.Fatal("Expect the address to be released")
+	}
+
+	// Die nächste Abfrage bietet erneut eine Adresse an
+	a.query()
+	a.handle(makeTestResponse(t, "cmd3", "node1", dictator.StatusOK, ""))
+	if len(*sent) != 4 || (*sent)[3].Target != "node1" {
+		t.Fatal("Expect a new offer for node1 was", *sent)
+	}
+}
+
+// Eine Node behält die Adresse eines früheren Diktators
+func Test_Assigner_Adopt(t *testing.T) {
+	a, sent := newTestAssigner(t)
+	a.query()
+	a.handle(makeTestResponse(t, "cmd1", "node1", dictator.StatusOK, "10.0.0.5"))
+	a.handle(makeTestResponse(t, "cmd1", "node2", dictator.StatusOK, "10.0.0.5"))
+
+	h, ok := a.pool.Holder("node1")
+	if !ok || h.Assignment.Address != "10.0.0.5" || h.State != assign.StateConfirmed {
+		t.Fatal("Expect node1 to keep 10.0.0.5 was", h)
+	}
+	if len(*sent) != 2 || (*sent)[1].Target != "node2" || (*sent)[1].Assignment.Address != "10.0.0.2" {
+		t.Fatal("Expect node2 to get 10.0.0.2 was", *sent)
+	}
+}
+
+func Test_Assigner_IgnoresUnknownCommands(t *testing.T) {
+	a, sent := newTestAssigner(t)
+	a.handle(makeTestResponse(t, "other", "node1", dictator.StatusOK, ""))
+	a.handle(dictator.DictatorPayload{Type: 3, Blob: []byte("nope")})
+
+	if len(*sent) != 0 || len(a.pool.Holders()) != 0 {
+		t.Fatal("Expect nothing to happen was", *sent, a.pool.Holders())
+	}
+}
+
+// Schlägt beim Setzen der Adresse fehl
+type failingConfigurator struct {
+	*ifconfig.Recorder
+	Err error
+}
+
+func (c failingConfigurator) AddAddress(iface string, addr *net.IPNet) error {
+	return c.Err
+}
+
+func Test_AssignIPHandler(t *testing.T) {
+	nCtx := dictator.NodeContext{
+		NodeID:     "node1",
+		AppContext: dictator.NewContext(),
+	}
+	c := ifconfig.NewRecorder(nil)
+	lease := newLeaseTracker()
+	handler := newAssignIPHandler("eth1", c, lease)
+
+	res, err := handler(nCtx, dictator.DictatorPayload{}, assign.Assignment{})
+	if err != nil || res.Address != "" || len(c.Ops()) != 0 {
+		t.Fatal("Expect no address was", res, err, c.Ops())
+	}
+
+	a := assign.Assignment{Address: "10.0.0.2", Prefix: 24, Gateway: "10.0.0.1", DNS: []string{"10.0.0.1"}}
+	res, err = handler(nCtx, dictator.DictatorPayload{}, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expect := []string{
+		"link set dev eth1 up",
+		"addr replace 10.0.0.2/24 dev eth1",
+		"route replace default via 10.0.0.1 dev eth1",
+		"resolv.conf nameserver 10.0.0.1",
+	}
+	if res.Address != "10.0.0.2" || !reflect.DeepEqual(c.Ops(), expect) {
+		t.Fatal("Expect", expect, "was", res, c.Ops())
+	}
+	if lease.Address().String() != "10.0.0.2/24" {
+		t.Fatal("Expect 10.0.0.2/24 was", lease.Address())
+	}
+
+	res, err = handler(nCtx, dictator.DictatorPayload{}, assign.Assignment{})
+	if err != nil || res.Address != "10.0.0.2" {
+		t.Fatal("Expect the query to return 10.0.0.2 was", res, err)
+	}
+}
+
+func Test_AssignIPHandler_Fail(t *testing.T) {
+	nCtx := dictator.NodeContext{
+		NodeID:     "node1",
+		AppContext: dictator.NewContext(),
+	}
+	c := failingConfigurator{ifconfig.NewRecorder(nil), errors.New("no such device")}
+	lease := newLeaseTracker()
+	handler := newAssignIPHandler("eth1", c, lease)
+
+	_, err := handler(nCtx, dictator.DictatorPayload{}, assign.Assignment{Address: "10.0.0.2"})
+	cmdErr := dictator.CommandError{}
+	if !errors.As(err, &cmdErr) || cmdErr.Status != dictator.StatusBadPayload || len(c.Ops()) != 0 {
+		t.Fatal("Expect", dictator.StatusBadPayload, "was", err)
+	}
+
+	_, err = handler(nCtx, dictator.DictatorPayload{}, assign.Assignment{Address: "10.0.0.2", Prefix: 24})
+	if err != c.Err || lease.IP() != nil {
+		t.Fatal("Expect", c.Err, "was", err, lease.IP())
+	}
+}
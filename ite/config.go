@@ -0,0 +1,541 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/rrawrriw/ite/assign"
+	"github.com/rrawrriw/ite/dictator"
+	"github.com/rrawrriw/ite/identity"
+	"github.com/rrawrriw/ite/ifconfig"
+	"github.com/rrawrriw/ite/logging"
+	"gopkg.in/yaml.v3"
+)
+
+type (
+	// Alle Einstellungen von ite. Werte werden in dieser Reihenfolge
+	// überschrieben: Standardwerte, Konfigurationsdatei, Umgebung, Flags.
+	Config struct {
+		// Interface über welches die DHCP Anfragen gehen und auf welchem
+		// die erhaltene Adresse gesetzt wird
+		Interface string `yaml:"interface" toml:"interface"`
+		// Ohne wird DefaultResolvConf von ifconfig geschrieben
+		ResolvConf string `yaml:"resolv_conf" toml:"resolv_conf"`
+		// Loggt die Änderungen am Interface nur statt sie auszuführen
+		DryRun   bool           `yaml:"dry_run" toml:"dry_run"`
+		Identity IdentityConfig `yaml:"identity" toml:"identity"`
+		Cluster  ClusterConfig  `yaml:"cluster" toml:"cluster"`
+		DHCP     DHCPConfig     `yaml:"dhcp" toml:"dhcp"`
+		Assign   AssignConfig   `yaml:"assign" toml:"assign"`
+		Election ElectionConfig `yaml:"election" toml:"election"`
+		Keys     KeysConfig     `yaml:"keys" toml:"keys"`
+		Log      LogConfig      `yaml:"log" toml:"log"`
+		// Adressen der optionalen HTTP Server, leer schaltet sie ab
+		MetricsAddr string `yaml:"metrics_addr" toml:"metrics_addr"`
+		// Die Admin API muss auf einer Loopback Adresse lauschen
+		AdminAddr string `yaml:"admin_addr" toml:"admin_addr"`
+	}
+
+	IdentityConfig struct {
+		// Woher die Node ID kommt, siehe identity.Sources
+		Source string `yaml:"source" toml:"source"`
+		// Speichert die ID bei Source file
+		StateFile string `yaml:"state_file" toml:"state_file"`
+		// Optionaler lesbarer Name der Node
+		Name string `yaml:"name" toml:"name"`
+	}
+
+	ClusterConfig struct {
+		// Broadcast Adresse oder Multicast Gruppe der Nodes
+		Group string `yaml:"group" toml:"group"`
+		Port  int    `yaml:"port" toml:"port"`
+	}
+
+	DHCPConfig struct {
+		ClientPort int      `yaml:"client_port" toml:"client_port"`
+		ServerPort int      `yaml:"server_port" toml:"server_port"`
+		Timeout    Duration `yaml:"timeout" toml:"timeout"`
+	}
+
+	// Die Adressen welche der Diktator an die Followers vergibt
+	AssignConfig struct {
+		// Netz wie 10.0.0.0/24, leer verwendet das Netz der per DHCP
+		// erhaltenen Adresse
+		Pool    string   `yaml:"pool" toml:"pool"`
+		Gateway string   `yaml:"gateway" toml:"gateway"`
+		DNS     []string `yaml:"dns" toml:"dns"`
+	}
+
+	ElectionConfig struct {
+		Priority   int      `yaml:"priority" toml:"priority"`
+		Ineligible bool     `yaml:"ineligible" toml:"ineligible"`
+		TimeoutMin Duration `yaml:"timeout_min" toml:"timeout_min"`
+		TimeoutMax Duration `yaml:"timeout_max" toml:"timeout_max"`
+		// Abstand der Heartbeats solange die Node Diktator ist
+		HeartbeatMin Duration `yaml:"heartbeat_min" toml:"heartbeat_min"`
+		HeartbeatMax Duration `yaml:"heartbeat_max" toml:"heartbeat_max"`
+	}
+
+	KeysConfig struct {
+		// IDs der Diktatoren deren Befehle ausgeführt werden, leer
+		// erlaubt alle
+		AllowedDictators []string `yaml:"allowed_dictators" toml:"allowed_dictators"`
+	}
+
+	LogConfig struct {
+		Level string `yaml:"level" toml:"level"`
+		JSON  bool   `yaml:"json" toml:"json"`
+	}
+
+	// Liest Werte wie 10s oder 1m30s
+	Duration struct {
+		time.Duration
+	}
+
+	// Ein Wert welcher per Umgebung oder Flag gesetzt werden kann
+	option struct {
+		flag   string
+		usage  string
+		isBool bool
+		apply  func(c *Config, v string) error
+	}
+
+	// Merkt sich den Wert eines Flags bis die Datei gelesen wurde
+	flagValue struct {
+		value  string
+		isBool bool
+	}
+)
+
+func DefaultConfig() Config {
+	return Config{
+		Interface: "eth0",
+		Identity: IdentityConfig{
+			Source:    identity.SourceFile,
+			StateFile: "/var/lib/ite/node-id",
+		},
+		Cluster: ClusterConfig{
+			Group: "255.255.255.255",
+			Port:  43001,
+		},
+		DHCP: DHCPConfig{
+			ClientPort: 68,
+			ServerPort: 67,
+			Timeout:    Duration{10 * time.Second},
+		},
+		Election: ElectionConfig{
+			TimeoutMin:   Duration{dictator.DefaultElectionTimeoutMin},
+			TimeoutMax:   Duration{dictator.DefaultElectionTimeoutMax},
+			HeartbeatMin: Duration{dictator.DefaultHeartbeatMin},
+			HeartbeatMax: Duration{dictator.DefaultHeartbeatMax},
+		},
+		Log: LogConfig{
+			Level: "info",
+		},
+	}
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	d.Duration = v
+
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+// Alle Optionen. Der Name der Umgebungsvariable ergibt sich aus dem Flag,
+// aus -dhcp-timeout wird ITE_DHCP_TIMEOUT.
+var options = []option{
+	{"interface", "Interface for DHCP requests and the assigned address", false, func(c *Config, v string) error {
+		c.Interface = v
+		return nil
+	}},
+	{"resolv-conf", "File which receives the DNS servers", false, func(c *Config, v string) error {
+		c.ResolvConf = v
+		return nil
+	}},
+	{"dry-run", "Log interface changes instead of applying them", true, func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.DryRun = b
+		return err
+	}},
+	{"id-source", "Source of the node ID: random, file, machine-id or mac", false, func(c *Config, v string) error {
+		c.Identity.Source = v
+		return nil
+	}},
+	{"state-file", "File which stores the node ID", false, func(c *Config, v string) error {
+		c.Identity.StateFile = v
+		return nil
+	}},
+	{"name", "Human readable name of the node", false, func(c *Config, v string) error {
+		c.Identity.Name = v
+		return nil
+	}},
+	{"group", "Broadcast address or multicast group of the cluster", false, func(c *Config, v string) error {
+		c.Cluster.Group = v
+		return nil
+	}},
+	{"port", "UDP port of the cluster", false, intOption(func(c *Config) *int { return &c.Cluster.Port })},
+	{"dhcp-client-port", "DHCP client port", false, intOption(func(c *Config) *int { return &c.DHCP.ClientPort })},
+	{"dhcp-server-port", "DHCP server port", false, intOption(func(c *Config) *int { return &c.DHCP.ServerPort })},
+	{"dhcp-timeout", "How long to wait for a DHCP server", false, durationOption(func(c *Config) *Duration { return &c.DHCP.Timeout })},
+	{"assign-pool", "Network whose addresses the dictator assigns, e.g. 10.0.0.0/24", false, func(c *Config, v string) error {
+		c.Assign.Pool = v
+		return nil
+	}},
+	{"assign-gateway", "Gateway sent with every assigned address", false, func(c *Config, v string) error {
+		c.Assign.Gateway = v
+		return nil
+	}},
+	{"assign-dns", "Comma separated DNS servers sent with every assigned address", false, func(c *Config, v string) error {
+		c.Assign.DNS = splitList(v)
+		return nil
+	}},
+	{"priority", "Election priority, higher wins", false, intOption(func(c *Config) *int { return &c.Election.Priority })},
+	{"ineligible", "Never become dictator", true, func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Election.Ineligible = b
+		return err
+	}},
+	{"election-timeout-min", "Minimum time without heartbeat before an election", false, durationOption(func(c *Config) *Duration { return &c.Election.TimeoutMin })},
+	{"election-timeout-max", "Maximum time without heartbeat before an election", false, durationOption(func(c *Config) *Duration { return &c.Election.TimeoutMax })},
+	{"heartbeat-min", "Minimum interval of the dictator heartbeats", false, durationOption(func(c *Config) *Duration { return &c.Election.HeartbeatMin })},
+	{"heartbeat-max", "Maximum interval of the dictator heartbeats", false, durationOption(func(c *Config) *Duration { return &c.Election.HeartbeatMax })},
+	{"allowed-dictators", "Comma separated IDs of dictators whose commands are executed", false, func(c *Config, v string) error {
+		c.Keys.AllowedDictators = splitList(v)
+		return nil
+	}},
+	{"log-level", "One of debug, info, warn or error", false, func(c *Config, v string) error {
+		c.Log.Level = v
+		return nil
+	}},
+	{"log-json", "Write the logs as JSON", true, func(c *Config, v string) error {
+		b, err := strconv.ParseBool(v)
+		c.Log.JSON = b
+		return err
+	}},
+	{"metrics", "Serve Prometheus metrics on this address, e.g. :9100", false, func(c *Config, v string) error {
+		c.MetricsAddr = v
+		return nil
+	}},
+	{"admin", "Serve the admin API on this loopback address, e.g. 127.0.0.1:7070", false, func(c *Config, v string) error {
+		c.AdminAddr = v
+		return nil
+	}},
+}
+
+// Die Admin API hat keine Authentifizierung, sie darf deshalb nur auf einer
+// Loopback Adresse lauschen. Ein leerer Host wie bei ":7070" lauscht auf
+// allen Interfaces.
+func isLoopbackAddr(addr string) bool {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return false
+	}
+	if host == "localhost" {
+		return true
+	}
+
+	ip := net.ParseIP(host)
+	return ip != nil && ip.IsLoopback()
+}
+
+// Eine komma getrennte Liste ohne leere Einträge
+func splitList(v string) []string {
+	list := []string{}
+	for _, s := range strings.Split(v, ",") {
+		s = strings.TrimSpace(s)
+		if s != "" {
+			list = append(list, s)
+		}
+	}
+
+	return list
+}
+
+func intOption(field func(*Config) *int) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		i, err := strconv.Atoi(v)
+		if err != nil {
+			return err
+		}
+		*field(c) = i
+		return nil
+	}
+}
+
+func durationOption(field func(*Config) *Duration) func(*Config, string) error {
+	return func(c *Config, v string) error {
+		return field(c).UnmarshalText([]byte(v))
+	}
+}
+
+func envName(flagName string) string {
+	return "ITE_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+func (f *flagValue) String() string {
+	if f == nil {
+		return ""
+	}
+	return f.value
+}
+
+func (f *flagValue) Set(v string) error {
+	f.value = v
+	return nil
+}
+
+func (f *flagValue) IsBoolFlag() bool {
+	return f.isBool
+}
+
+// Liest die Konfiguration aus Datei, Umgebung und den Argumenten args.
+// getenv ist für Tests austauschbar.
+func LoadConfig(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	fs := flag.NewFlagSet("ite", flag.ContinueOnError)
+	fs.SetOutput(output)
+	path := fs.String("config", getenv("ITE_CONFIG"), "YAML or TOML configuration file")
+
+	values := map[string]*flagValue{}
+	for _, o := range options {
+		v := &flagValue{isBool: o.isBool}
+		values[o.flag] = v
+		usage := fmt.Sprintf("%v (env %v)", o.usage, envName(o.flag))
+		fs.Var(v, o.flag, usage)
+	}
+
+	err := fs.Parse(args)
+	if err != nil {
+		return Config{}, err
+	}
+
+	c := DefaultConfig()
+	if *path != "" {
+		err = readConfigFile(*path, &c)
+		if err != nil {
+			return Config{}, err
+		}
+	}
+
+	for _, o := range options {
+		v := getenv(envName(o.flag))
+		if v == "" {
+			continue
+		}
+		err := o.apply(&c, v)
+		if err != nil {
+			return Config{}, fmt.Errorf("%v: %w", envName(o.flag), err)
+		}
+	}
+
+	var flagErr error
+	fs.Visit(func(f *flag.Flag) {
+		v, ok := values[f.Name]
+		if !ok || flagErr != nil {
+			return
+		}
+		for _, o := range options {
+			if o.flag == f.Name {
+				err := o.apply(&c, v.value)
+				if err != nil {
+					flagErr = fmt.Errorf("-%v: %w", f.Name, err)
+				}
+			}
+		}
+	})
+	if flagErr != nil {
+		return Config{}, flagErr
+	}
+
+	return c, c.Validate()
+}
+
+func readConfigFile(path string, c *Config) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		_, err = toml.Decode(string(data), c)
+	default:
+		return fmt.Errorf("%v: unknown config format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return fmt.Errorf("%v: %w", path, err)
+	}
+
+	return nil
+}
+
+// Prüft alle Werte und gibt alle Fehler auf einmal zurück
+func (c Config) Validate() error {
+	errs := []error{}
+	add := func(field string, format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf("%v: %v", field, fmt.Sprintf(format, args...)))
+	}
+
+	if c.Interface == "" {
+		add("interface", "must not be empty")
+	}
+
+	if !slices.Contains(identity.Sources(), c.Identity.Source) {
+		add("identity.source", "must be one of %v, was %q", strings.Join(identity.Sources(), ", "), c.Identity.Source)
+	}
+	if c.Identity.Source == identity.SourceFile && c.Identity.StateFile == "" {
+		add("identity.state_file", "must not be empty")
+	}
+	if len(c.Identity.Name) > dictator.MaxNodeNameLength {
+		add("identity.name", "must not be longer than %v bytes", dictator.MaxNodeNameLength)
+	}
+
+	ip := net.ParseIP(c.Cluster.Group)
+	if ip == nil || ip.To4() == nil {
+		add("cluster.group", "must be an IPv4 broadcast or multicast address, was %q", c.Cluster.Group)
+	}
+
+	ports := []struct {
+		Name string
+		Port int
+	}{
+		{"cluster.port", c.Cluster.Port},
+		{"dhcp.client_port", c.DHCP.ClientPort},
+		{"dhcp.server_port", c.DHCP.ServerPort},
+	}
+	for _, p := range ports {
+		if p.Port < 1 || p.Port > 65535 {
+			add(p.Name, "must be between 1 and 65535, was %v", p.Port)
+		}
+	}
+
+	if c.DHCP.Timeout.Duration <= 0 {
+		add("dhcp.timeout", "must be greater than 0, was %v", c.DHCP.Timeout)
+	}
+
+	if c.Assign.Pool != "" {
+		_, err := assign.NewPool(c.Assign.Pool, c.Assign.Gateway, c.Assign.DNS)
+		if err != nil {
+			add("assign.pool", "%v", err)
+		}
+	} else if c.Assign.Gateway != "" && net.ParseIP(c.Assign.Gateway).To4() == nil {
+		add("assign.gateway", "must be an IPv4 address, was %q", c.Assign.Gateway)
+	}
+	for _, dns := range c.Assign.DNS {
+		if net.ParseIP(dns) == nil {
+			add("assign.dns", "must contain IP addresses, was %q", dns)
+		}
+	}
+
+	err := c.Leadership().Validate()
+	if err != nil {
+		add("election", "%v", err)
+	}
+
+	for _, id := range c.Keys.AllowedDictators {
+		if id == "" {
+			add("keys.allowed_dictators", "must not contain empty IDs")
+			break
+		}
+	}
+
+	_, err = logging.ParseLevel(c.Log.Level)
+	if err != nil {
+		add("log.level", "%v", err)
+	}
+
+	if c.AdminAddr != "" && !isLoopbackAddr(c.AdminAddr) {
+		add("admin_addr", "must be a loopback address like 127.0.0.1:7070, was %q", c.AdminAddr)
+	}
+
+	return errors.Join(errs...)
+}
+
+func (c Config) Leadership() dictator.Leadership {
+	return dictator.Leadership{
+		Priority:           c.Election.Priority,
+		Ineligible:         c.Election.Ineligible,
+		ElectionTimeoutMin: c.Election.TimeoutMin.Duration,
+		ElectionTimeoutMax: c.Election.TimeoutMax.Duration,
+		HeartbeatMin:       c.Election.HeartbeatMin.Duration,
+		HeartbeatMax:       c.Election.HeartbeatMax.Duration,
+	}
+}
+
+// Bestimmt die ID der Node, bei Source file wird diese beim ersten Start
+// gespeichert
+func (c Config) NodeIdentity() (dictator.Identity, error) {
+	id, err := identity.Load(c.Identity.Source, c.Identity.StateFile, c.Interface)
+	if err != nil {
+		return dictator.Identity{}, err
+	}
+
+	return dictator.Identity{
+		ID:   id,
+		Name: c.Identity.Name,
+	}, nil
+}
+
+// Der Pool des Diktators. Ohne konfigurierten Pool wird das Netz der
+// eigenen Adresse addr mit der Maske der DHCP Lease verwendet, die Adresse
+// selbst wird nicht vergeben.
+func (c Config) AssignPool(addr *net.IPNet) (*assign.Pool, error) {
+	cidr := c.Assign.Pool
+	if cidr == "" {
+		if addr == nil || addr.IP.To4() == nil {
+			return nil, errors.New("assign.pool is empty and there is no DHCP address")
+		}
+		ones, bits := addr.Mask.Size()
+		if bits != 32 {
+			return nil, fmt.Errorf("assign.pool is empty and %v has no IPv4 netmask", addr)
+		}
+		cidr = fmt.Sprintf("%v/%v", addr.IP.Mask(addr.Mask), ones)
+	}
+
+	pool, err := assign.NewPool(cidr, c.Assign.Gateway, c.Assign.DNS)
+	if err != nil {
+		return nil, err
+	}
+	if addr != nil {
+		pool.Reserve(addr.IP)
+	}
+
+	return pool, nil
+}
+
+// Setzt Adressen, Routen und DNS über rtnetlink. Mit DryRun werden die
+// Änderungen nur in log geschrieben.
+func (c Config) IfConfig(log *slog.Logger) ifconfig.Configurator {
+	if c.DryRun {
+		return ifconfig.NewRecorder(log)
+	}
+
+	return ifconfig.Netlink{ResolvConf: c.ResolvConf}
+}
+
+func (c Config) ClusterAddr() net.UDPAddr {
+	return net.UDPAddr{
+		IP:   net.ParseIP(c.Cluster.Group),
+		Port: c.Cluster.Port,
+	}
+}
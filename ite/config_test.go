@@ -0,0 +1,261 @@
+package main
+
+import (
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrawrriw/ite/ifconfig"
+)
+
+func makeTestEnv(env map[string]string) func(string) string {
+	return func(k string) string {
+		return env[k]
+	}
+}
+
+func writeTestConfig(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte(content), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return path
+}
+
+func Test_LoadConfig_Defaults(t *testing.T) {
+	c, err := LoadConfig(nil, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if c.Interface != "eth0" || c.Cluster.Port != 43001 || c.DHCP.Timeout.Duration != 10*time.Second {
+		t.Fatal("Expect the defaults was", c)
+	}
+}
+
+func Test_LoadConfig_ExampleFile(t *testing.T) {
+	c, err := LoadConfig([]string{"-config", "ite.example.yaml"}, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	d := DefaultConfig()
+	d.Keys.AllowedDictators = []string{}
+	if c.Interface != d.Interface || c.Identity != d.Identity || c.Cluster != d.Cluster || c.DHCP != d.DHCP || c.Election != d.Election {
+		t.Fatal("Expect the example to match the defaults was", c)
+	}
+}
+
+func Test_LoadConfig_Precedence(t *testing.T) {
+	yamlPath := writeTestConfig(t, "ite.yaml", `
+interface: eth1
+cluster:
+  port: 44000
+dhcp:
+  timeout: 5s
+election:
+  priority: 2
+`)
+	tomlPath := writeTestConfig(t, "ite.toml", `
+interface = "eth1"
+
+[cluster]
+port = 44000
+
+[dhcp]
+timeout = "5s"
+
+[election]
+priority = 2
+`)
+
+	for _, path := range []string{yamlPath, tomlPath} {
+		env := makeTestEnv(map[string]string{
+			"ITE_CONFIG":            path,
+			"ITE_PORT":              "45000",
+			"ITE_ALLOWED_DICTATORS": "a, b",
+		})
+		c, err := LoadConfig([]string{"-port", "46000", "-ineligible"}, env, io.Discard)
+		if err != nil {
+			t.Fatal(path, err)
+		}
+
+		if c.Interface != "eth1" || c.DHCP.Timeout.Duration != 5*time.Second || c.Election.Priority != 2 {
+			t.Fatal("Expect values of", path, "was", c)
+		}
+		if c.Cluster.Port != 46000 {
+			t.Fatal("Expect flag to win was", c.Cluster.Port)
+		}
+		if !c.Election.Ineligible {
+			t.Fatal("Expect ineligible")
+		}
+		if len(c.Keys.AllowedDictators) != 2 || c.Keys.AllowedDictators[1] != "b" {
+			t.Fatal("Expect allowed dictators a and b was", c.Keys.AllowedDictators)
+		}
+	}
+}
+
+func Test_LoadConfig_Invalid(t *testing.T) {
+	path := writeTestConfig(t, "ite.yaml", `
+identity:
+  source: hostname
+cluster:
+  group: not-an-ip
+  port: 70000
+election:
+  heartbeat_min: 1s
+  heartbeat_max: 2s
+log:
+  level: loud
+`)
+
+	_, err := LoadConfig([]string{"-config", path}, makeTestEnv(nil), io.Discard)
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+
+	for _, field := range []string{"identity.source", "cluster.group", "cluster.port", "election", "log.level"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatal("Expect an error for", field, "in", err)
+		}
+	}
+}
+
+func Test_LoadConfig_BadValues(t *testing.T) {
+	_, err := LoadConfig([]string{"-dhcp-timeout", "soon"}, makeTestEnv(nil), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "-dhcp-timeout") {
+		t.Fatal("Expect an error for -dhcp-timeout was", err)
+	}
+
+	_, err = LoadConfig(nil, makeTestEnv(map[string]string{"ITE_PORT": "x"}), io.Discard)
+	if err == nil || !strings.Contains(err.Error(), "ITE_PORT") {
+		t.Fatal("Expect an error for ITE_PORT was", err)
+	}
+
+	_, err = LoadConfig([]string{"-config", "ite.json"}, makeTestEnv(nil), io.Discard)
+	if err == nil {
+		t.Fatal("Expect an error for an unknown format")
+	}
+}
+
+func Test_Config_NodeIdentity(t *testing.T) {
+	stateFile := filepath.Join(t.TempDir(), "node-id")
+	args := []string{"-state-file", stateFile, "-name", "gateway"}
+
+	c, err := LoadConfig(args, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id1, err := c.NodeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1.ID == "" || id1.Name != "gateway" {
+		t.Fatal("Expect an ID and the name gateway was", id1)
+	}
+
+	// Nach einem Neustart
+	c, err = LoadConfig(args, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id2, err := c.NodeIdentity()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if id1 != id2 {
+		t.Fatal("Expect", id1, "was", id2)
+	}
+}
+
+func Test_Config_AssignPool(t *testing.T) {
+	args := []string{"-assign-pool", "10.0.0.0/29", "-assign-gateway", "10.0.0.1", "-assign-dns", "1.1.1.1, 8.8.8.8"}
+	c, err := LoadConfig(args, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err := c.AssignPool(&net.IPNet{IP: net.ParseIP("10.0.0.2"), Mask: net.CIDRMask(29, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	a, err := pool.Offer("node")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if a.Address != "10.0.0.3" || a.Prefix != 29 || a.Gateway != "10.0.0.1" || len(a.DNS) != 2 {
+		t.Fatal("Expect 10.0.0.3/29 via 10.0.0.1 with 2 DNS servers was", a)
+	}
+
+	// Ohne Pool das Netz der DHCP Lease, nicht das der Adressklasse
+	c, err = LoadConfig(nil, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool, err = c.AssignPool(&net.IPNet{IP: net.ParseIP("10.1.2.10"), Mask: net.CIDRMask(26, 32)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pool.Network().String() != "10.1.2.0/26" {
+		t.Fatal("Expect 10.1.2.0/26 was", pool.Network())
+	}
+	_, err = c.AssignPool(&net.IPNet{IP: net.ParseIP("10.1.2.10")})
+	if err == nil {
+		t.Fatal("Expect an error without netmask")
+	}
+	_, err = c.AssignPool(nil)
+	if err == nil {
+		t.Fatal("Expect an error without pool and address")
+	}
+}
+
+func Test_LoadConfig_InvalidAssign(t *testing.T) {
+	args := []string{"-assign-pool", "10.0.0.0/24", "-assign-gateway", "10.1.0.1", "-assign-dns", "nope"}
+	_, err := LoadConfig(args, makeTestEnv(nil), io.Discard)
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+
+	for _, field := range []string{"assign.pool", "assign.dns"} {
+		if !strings.Contains(err.Error(), field) {
+			t.Fatal("Expect an error for", field, "in", err)
+		}
+	}
+}
+
+func Test_LoadConfig_AdminAddr(t *testing.T) {
+	for _, addr := range []string{"127.0.0.1:7070", "localhost:7070", "[::1]:7070"} {
+		_, err := LoadConfig([]string{"-admin", addr}, makeTestEnv(nil), io.Discard)
+		if err != nil {
+			t.Fatal("Expect no error for", addr, "was", err)
+		}
+	}
+
+	for _, addr := range []string{":7070", "0.0.0.0:7070", "192.168.0.1:7070", "127.0.0.1"} {
+		_, err := LoadConfig([]string{"-admin", addr}, makeTestEnv(nil), io.Discard)
+		if err == nil || !strings.Contains(err.Error(), "admin_addr") {
+			t.Fatal("Expect an error for", addr, "was", err)
+		}
+	}
+}
+
+func Test_Config_IfConfig(t *testing.T) {
+	c, err := LoadConfig([]string{"-dry-run", "-resolv-conf", "/tmp/resolv.conf"}, makeTestEnv(nil), io.Discard)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := c.IfConfig(nil).(*ifconfig.Recorder); !ok {
+		t.Fatal("Expect a recorder with -dry-run was", c.IfConfig(nil))
+	}
+
+	c.DryRun = false
+	n, ok := c.IfConfig(nil).(ifconfig.Netlink)
+	if !ok || n.ResolvConf != "/tmp/resolv.conf" {
+		t.Fatal("Expect netlink with /tmp/resolv.conf was", c.IfConfig(nil))
+	}
+}
@@ -0,0 +1,214 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rrawrriw/ite/admin"
+	"github.com/rrawrriw/ite/dhcp"
+	"github.com/rrawrriw/ite/ifconfig"
+	"github.com/rrawrriw/ite/logging"
+)
+
+// Abstand bis zum nächsten Versuch falls eine Lease nicht verlängert
+// werden konnte
+const leaseRetry = 10 * time.Second
+
+// Merkt sich die aktuelle Adresse der Node für die Admin API und den
+// Pool des Diktators
+type leaseTracker struct {
+	mutex    *sync.Mutex
+	ip       net.IP
+	mask     net.IPMask
+	received time.Time
+	duration time.Duration
+}
+
+func newLeaseTracker() *leaseTracker {
+	return &leaseTracker{
+		mutex: &sync.Mutex{},
+	}
+}
+
+// Merkt sich die Adresse addr mit der Maske ihres Netzes. d ist die
+// Laufzeit der Lease, 0 läuft nie ab.
+func (l *leaseTracker) SetAddress(addr *net.IPNet, d time.Duration) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	l.ip = addr.IP
+	l.mask = addr.Mask
+	l.received = time.Now()
+	l.duration = d
+}
+
+// Setzt die per DHCP erhaltene Lease über c auf iface und merkt sie sich
+func (l *leaseTracker) Apply(c ifconfig.Configurator, iface string, lease dhcp.Lease) error {
+	s := ifconfig.Settings{
+		Address: lease.Address(),
+		DNS:     lease.DNS,
+	}
+	for _, r := range lease.AllRoutes() {
+		s.Routes = append(s.Routes, ifconfig.Route(r))
+	}
+
+	err := ifconfig.Apply(c, iface, s)
+	if err != nil {
+		return err
+	}
+	l.SetAddress(s.Address, lease.Duration)
+
+	return nil
+}
+
+// Die aktuelle Adresse, nil solange die Node keine hat
+func (l *leaseTracker) IP() net.IP {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	return l.ip
+}
+
+// Die aktuelle Adresse mit Maske, nil solange die Node keine hat
+func (l *leaseTracker) Address() *net.IPNet {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.ip == nil {
+		return nil
+	}
+
+	return &net.IPNet{IP: l.ip, Mask: l.mask}
+}
+
+func (l *leaseTracker) Lease() (admin.Lease, bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	if l.ip == nil {
+		return admin.Lease{}, false
+	}
+
+	return admin.Lease{
+		IP:       l.ip,
+		Received: l.received,
+		Duration: l.duration,
+	}, true
+}
+
+// Holt die Lease des Diktators per DHCP und verlängert sie
+type dhcpClient struct {
+	// DISCOVER bis ACK, siehe dhcp.RequestLease
+	request func(ctx context.Context) (dhcp.Lease, error)
+	// REQUEST bis ACK beim Server der Lease, siehe dhcp.RenewLease
+	renew func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error)
+	// REQUEST bis ACK per Broadcast, siehe dhcp.RebindLease
+	rebind func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error)
+	lease  *leaseTracker
+	ifc    ifconfig.Configurator
+	iface  string
+	retry  time.Duration
+	log    *slog.Logger
+}
+
+// Fragt eine Lease an und setzt sie auf das Interface. Gesetzt wird erst
+// nach dem DHCPACK, bei einem DHCPNAK oder ohne Antwort gibt es false.
+func (c dhcpClient) acquire(ctx context.Context) (dhcp.Lease, bool) {
+	l, err := c.request(ctx)
+	if err != nil {
+		c.log.Warn("Request IP address", logging.Err(err))
+		return dhcp.Lease{}, false
+	}
+	err = c.lease.Apply(c.ifc, c.iface, l)
+	if err != nil {
+		c.log.Error("Apply DHCP lease", logging.Err(err))
+		return dhcp.Lease{}, false
+	}
+	c.log.Info("Got IP address", "ip", l.Address().String(), "lease", l.Duration)
+
+	return l, true
+}
+
+// Verlängert l ab T1 beim Server der Lease bis ctx beendet wird oder die
+// Node eine andere Adresse erhält. Antwortet dieser bis T2 nicht, wird per
+// Broadcast verlängert. Lehnt ein Server ab oder läuft die Lease ab, wird
+// eine neue Lease angefragt. Die alte Adresse bleibt bis dahin gesetzt,
+// damit der Diktator weiter Heartbeats senden kann. Nach einem Fehler wird
+// es nach retry erneut versucht.
+func (c dhcpClient) keep(ctx context.Context, l dhcp.Lease) {
+	received := time.Now()
+	wait := l.RenewAfter()
+	for wait > 0 {
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+		if !c.lease.IP().Equal(l.IP) {
+			return
+		}
+
+		elapsed := time.Since(received)
+		if elapsed < l.Duration {
+			extend := c.renew
+			if elapsed >= l.RebindAfter() {
+				extend = c.rebind
+			}
+			next, err := extend(ctx, l)
+			if err == nil {
+				err = c.lease.Apply(c.ifc, c.iface, next)
+			}
+			if err == nil {
+				c.log.Debug("Renewed DHCP lease", "ip", next.Address().String(), "lease", next.Duration)
+				l = next
+				received = time.Now()
+				wait = l.RenewAfter()
+				continue
+			}
+			if !errors.Is(err, dhcp.NakError) {
+				if ctx.Err() != nil {
+					return
+				}
+				c.log.Error("Renew DHCP lease", logging.Err(err))
+				wait = c.retry
+				continue
+			}
+			c.log.Warn("DHCP server declined the renewal", "ip", l.IP.String())
+		} else {
+			c.log.Warn("DHCP lease expired", "ip", l.IP.String())
+		}
+
+		var ok bool
+		l, ok = c.reacquire(ctx, l.IP)
+		if !ok {
+			return
+		}
+		received = time.Now()
+		wait = l.RenewAfter()
+	}
+}
+
+// Fragt nach einem DHCPNAK alle retry eine neue Lease an, bis eine gesetzt
+// ist. Endet ctx oder erhält die Node zwischendurch eine andere Adresse als
+// old gibt es false.
+func (c dhcpClient) reacquire(ctx context.Context, old net.IP) (dhcp.Lease, bool) {
+	for {
+		l, ok := c.acquire(ctx)
+		if ok {
+			return l, true
+		}
+
+		select {
+		case <-ctx.Done():
+			return dhcp.Lease{}, false
+		case <-time.After(c.retry):
+		}
+		if !c.lease.IP().Equal(old) {
+			return dhcp.Lease{}, false
+		}
+	}
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"net"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rrawrriw/ite/dhcp"
+	"github.com/rrawrriw/ite/ifconfig"
+)
+
+func Test_LeaseTracker_Apply(t *testing.T) {
+	_, dst, _ := net.ParseCIDR("172.16.0.0/12")
+	lease := dhcp.Lease{
+		IP:       net.ParseIP("192.168.1.7"),
+		Mask:     net.CIDRMask(24, 32),
+		Routers:  []net.IP{net.ParseIP("192.168.1.1")},
+		DNS:      []net.IP{net.ParseIP("192.168.1.1")},
+		Duration: time.Hour,
+		Routes: []dhcp.Route{
+			{Gateway: net.ParseIP("192.168.1.254")},
+			{Dst: dst, Gateway: net.ParseIP("192.168.1.2")},
+		},
+	}
+	c := ifconfig.NewRecorder(nil)
+	l := newLeaseTracker()
+
+	err := l.Apply(c, "eth0", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Option 121 ersetzt die Router
+	expect := []string{
+		"link set dev eth0 up",
+		"addr replace 192.168.1.7/24 dev eth0",
+		"route replace default via 192.168.1.254 dev eth0",
+		"route replace 172.16.0.0/12 via 192.168.1.2 dev eth0",
+		"resolv.conf nameserver 192.168.1.1",
+	}
+	if !reflect.DeepEqual(c.Ops(), expect) {
+		t.Fatal("Expect", expect, "was", c.Ops())
+	}
+	if l.Address().String() != "192.168.1.7/24" {
+		t.Fatal("Expect 192.168.1.7/24 was", l.Address())
+	}
+	info, ok := l.Lease()
+	if !ok || info.Duration != time.Hour {
+		t.Fatal("Expect a lease of an hour was", info)
+	}
+}
+
+func makeTestDHCPLease(ip string, d time.Duration) dhcp.Lease {
+	return dhcp.Lease{
+		IP:       net.ParseIP(ip),
+		Mask:     net.CIDRMask(24, 32),
+		Duration: d,
+	}
+}
+
+// Eine Lease mit kurzem T1, T2 wird in den Tests nicht erreicht
+func makeTestRenewingLease(ip string) dhcp.Lease {
+	l := makeTestDHCPLease(ip, time.Hour)
+	l.Renewal = 10 * time.Millisecond
+
+	return l
+}
+
+func newTestDHCPClient() dhcpClient {
+	return dhcpClient{
+		lease: newLeaseTracker(),
+		ifc:   ifconfig.NewRecorder(nil),
+		iface: "eth0",
+		retry: time.Millisecond,
+		log:   slog.New(slog.NewTextHandler(io.Discard, nil)),
+	}
+}
+
+// Ohne DHCPACK wird nichts gesetzt
+func Test_DHCPClient_AcquireNak(t *testing.T) {
+	c := newTestDHCPClient()
+	c.request = func(ctx context.Context) (dhcp.Lease, error) {
+		return dhcp.Lease{}, dhcp.NakError
+	}
+
+	_, ok := c.acquire(context.Background())
+	if ok || c.lease.IP() != nil || len(c.ifc.(*ifconfig.Recorder).Ops()) != 0 {
+		t.Fatal("Expect no address was", c.lease.IP())
+	}
+}
+
+// Lehnt der Server die Verlängerung ab wird eine neue Lease angefragt
+func Test_DHCPClient_Keep(t *testing.T) {
+	c := newTestDHCPClient()
+	renewed := 0
+	c.renew = func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+		renewed++
+		if renewed == 1 {
+			return makeTestRenewingLease("10.0.0.5"), nil
+		}
+		return dhcp.Lease{}, dhcp.NakError
+	}
+	requested := 0
+	c.request = func(ctx context.Context) (dhcp.Lease, error) {
+		requested++
+		if requested == 1 {
+			return dhcp.Lease{}, dhcp.TimeoutError
+		}
+		// Ohne Ablauf endet keep
+		return makeTestDHCPLease("10.0.0.9", 0), nil
+	}
+
+	l := makeTestRenewingLease("10.0.0.5")
+	c.lease.SetAddress(l.Address(), l.Duration)
+	done := make(chan struct{})
+	go func() {
+		c.keep(context.Background(), l)
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Expect keep to end with a lease without expiry")
+	}
+	if renewed != 2 || requested != 2 || c.lease.Address().String() != "10.0.0.9/24" {
+		t.Fatal("Expect 10.0.0.9/24 after 2 renewals and 2 requests was", c.lease.Address(), renewed, requested)
+	}
+}
+
+// Erhält die Node eine andere Adresse endet keep
+func Test_DHCPClient_KeepOtherAddress(t *testing.T) {
+	c := newTestDHCPClient()
+	c.renew = func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+		t.Error("Expect no renewal")
+		return l, nil
+	}
+
+	c.lease.SetAddress(makeTestDHCPLease("10.0.0.2", 0).Address(), 0)
+	c.keep(context.Background(), makeTestDHCPLease("10.0.0.5", 2*time.Millisecond))
+}
+
+// Erhält die Node nach einem DHCPNAK eine andere Adresse wird nicht
+// weiter angefragt
+func Test_DHCPClient_ReacquireOtherAddress(t *testing.T) {
+	c := newTestDHCPClient()
+	requested := 0
+	c.request = func(ctx context.Context) (dhcp.Lease, error) {
+		requested++
+		c.lease.SetAddress(makeTestDHCPLease("10.0.0.2", 0).Address(), 0)
+		return dhcp.Lease{}, dhcp.TimeoutError
+	}
+
+	_, ok := c.reacquire(context.Background(), net.ParseIP("10.0.0.5"))
+	if ok || requested != 1 {
+		t.Fatal("Expect to stop after 1 request was", ok, requested)
+	}
+}
+
+// Antwortet der Server der Lease bis T2 nicht wird per Broadcast verlängert
+func Test_DHCPClient_KeepRebind(t *testing.T) {
+	c := newTestDHCPClient()
+	renewed := 0
+	c.renew = func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+		renewed++
+		return dhcp.Lease{}, dhcp.TimeoutError
+	}
+	rebound := 0
+	c.rebind = func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+		rebound++
+		return makeTestDHCPLease("10.0.0.5", 0), nil
+	}
+
+	l := makeTestDHCPLease("10.0.0.5", time.Hour)
+	l.Renewal = time.Millisecond
+	l.Rebinding = 5 * time.Millisecond
+	c.lease.SetAddress(l.Address(), l.Duration)
+	c.keep(context.Background(), l)
+
+	if renewed < 1 || rebound != 1 {
+		t.Fatal("Expect renewals and 1 rebind was", renewed, rebound)
+	}
+}
+
+// Läuft die Lease ab wird eine neue angefragt
+func Test_DHCPClient_KeepExpired(t *testing.T) {
+	c := newTestDHCPClient()
+	c.renew = func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+		return dhcp.Lease{}, dhcp.TimeoutError
+	}
+	c.rebind = c.renew
+	requested := 0
+	c.request = func(ctx context.Context) (dhcp.Lease, error) {
+		requested++
+		return makeTestDHCPLease("10.0.0.9", 0), nil
+	}
+
+	l := makeTestDHCPLease("10.0.0.5", 10*time.Millisecond)
+	c.lease.SetAddress(l.Address(), l.Duration)
+	c.keep(context.Background(), l)
+
+	if requested != 1 || c.lease.Address().String() != "10.0.0.9/24" {
+		t.Fatal("Expect 10.0.0.9/24 after 1 request was", c.lease.Address(), requested)
+	}
+}
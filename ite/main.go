@@ -1,135 +1,183 @@
 package main
 
 import (
+	"context"
+	"errors"
+	"flag"
 	"fmt"
+	"log/slog"
 	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/rrawrriw/ite/admin"
+	"github.com/rrawrriw/ite/assign"
 	"github.com/rrawrriw/ite/dhcp"
 	"github.com/rrawrriw/ite/dictator"
+	"github.com/rrawrriw/ite/ifconfig"
+	"github.com/rrawrriw/ite/logging"
+	"github.com/rrawrriw/ite/metrics"
 )
 
-func NewCluster() (dictator.Mission, dictator.ResponseChan) {
+func NewCluster(cfg Config, lease *leaseTracker, ifc ifconfig.Configurator, m dhcp.Metrics) (dictator.Mission, dictator.ResponseChan) {
 	response := make(dictator.ResponseChan)
 
+	// HandlePacket wartet bis die Antwort abgeholt ist, daher werden die
+	// Antworten gepuffert und bei vollem Puffer verworfen
+	responses := make(chan dictator.DictatorPayload, assignResponseBuffer)
+	go func() {
+		for payload := range response {
+			select {
+			case responses <- payload:
+			default:
+			}
+		}
+	}()
+
 	dhcpInAddr := net.UDPAddr{
 		IP:   net.ParseIP("255.255.255.255"),
-		Port: 68,
+		Port: cfg.DHCP.ClientPort,
 	}
 
 	dhcpOutAddr := net.UDPAddr{
 		IP:   net.ParseIP("255.255.255.255"),
-		Port: 67,
+		Port: cfg.DHCP.ServerPort,
 	}
 
 	mission := func(nCtx dictator.NodeContext) {
 		log := nCtx.AppContext.Log
-		go func() {
-			log.Debug.Println(nCtx.NodeID, "- Start to build new cluster")
+		client := newDHCPClient(cfg, dhcpInAddr, dhcpOutAddr, lease, ifc, m, log)
+		states := nCtx.Handle.Subscribe()
 
-			ips, timeout, err := dhcp.RequestIPAddr(dhcpInAddr, dhcpOutAddr, 10*time.Second, "eth0")
-			if err != nil {
-				log.Error.Println(nCtx.NodeID, "-", err)
-				return
-			}
-
-			// Wait for DHCP Server Response
+		// Die Mission endet sobald die Node nicht mehr Diktator ist
+		stop := make(chan struct{})
+		go func() {
+			defer close(stop)
+			defer nCtx.Handle.Unsubscribe(states)
 			for {
 				select {
-
-				case <-timeout:
-					log.Debug.Println(nCtx.NodeID, "- DHCP IP request run out of time")
-				case ip := <-ips:
-					log.Debug.Println(nCtx.NodeID, "- got", ip)
+				case t, ok := <-states:
+					if !ok || t.To != dictator.StateDictator {
+						return
+					}
 				case <-nCtx.AppContext.DoneChan:
 					return
-				case <-nCtx.SuicideChan:
-					return
 				}
 			}
+		}()
 
-			// Send AssignIP commands until a slave response
-			packet, err := dictator.NewCommandPacket(nCtx.NodeID, "AssignIP", nil)
-			if err != nil {
-				log.Error.Println(err)
-				nCtx.AppContext.Done()
-			}
-			go func() {
-				select {
-				case <-nCtx.AppContext.DoneChan:
-					return
-				case <-nCtx.SuicideChan:
-					return
-				default:
-					nCtx.UDPOut <- packet
-					time.Sleep(1 * time.Second)
+		go func() {
+			log.Info("Start to build new cluster")
+
+			addr := lease.Address()
+			if addr == nil {
+				ctx, cancel := stopContext(stop)
+				l, ok := client.acquire(ctx)
+				cancel()
+				if ok {
+					addr = l.Address()
+					// Läuft weiter solange die Node die Adresse hat,
+					// auch wenn sie nicht mehr Diktator ist
+					go client.keep(nCtx.AppContext.Ctx, l)
 				}
+			}
 
-			}()
+			pool, err := cfg.AssignPool(addr)
+			if err != nil {
+				log.Error("Address pool", logging.Err(err))
+				return
+			}
+			log.Info("Assign addresses", "pool", pool.Network().String())
 
-			// Wait for a slave to response the AssingIP command
-			for {
-				select {
-				case <-response:
-					log.Debug.Println(nCtx.NodeID, "- Command successfully done")
-					log.Debug.Println(nCtx.NodeID, "- Send reboot command")
-					packet, err := dictator.NewCommandPacket(nCtx.NodeID, "Reboot", nil)
-					if err != nil {
-						log.Error.Println(err)
-						nCtx.AppContext.Done()
-					}
-					nCtx.UDPOut <- packet
-					time.Sleep(1 * time.Second)
-					nCtx.AppContext.Done()
-				case <-nCtx.AppContext.DoneChan:
-					return
-				case <-nCtx.SuicideChan:
-					return
+			send := func(target string, a assign.Assignment) (string, error) {
+				if target == "" {
+					return nCtx.Dispatcher.Send(nCtx, assign.Command, a)
 				}
+				return nCtx.Dispatcher.SendTo(nCtx, target, assign.Command, a)
 			}
+			newAssigner(pool, send, log).run(responses, stop)
 		}()
 	}
 
 	return mission, response
 }
 
-func AssignIPHandler(nCtx dictator.NodeContext, payload dictator.DictatorPayload) error {
-	log := nCtx.AppContext.Log
-	log.Debug.Println(nCtx.NodeID, "- Receive command AssignIP from", payload.DictatorID)
-
-	response, err := dictator.NewCommandResponsePacket(payload.DictatorID, nCtx.NodeID, 1, nil)
-	if err != nil {
-		return err
+// Fragt per DHCP über in und out nach der Adresse für cfg.Interface und
+// zählt den Austausch in m
+func newDHCPClient(cfg Config, in, out net.UDPAddr, lease *leaseTracker, ifc ifconfig.Configurator, m dhcp.Metrics, log *slog.Logger) dhcpClient {
+	timeout := cfg.DHCP.Timeout.Duration
+	return dhcpClient{
+		request: func(ctx context.Context) (dhcp.Lease, error) {
+			return dhcp.RequestLease(ctx, in, out, timeout, cfg.Interface, m)
+		},
+		renew: func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+			return dhcp.RenewLease(ctx, in, out, timeout, cfg.Interface, l, m)
+		},
+		rebind: func(ctx context.Context, l dhcp.Lease) (dhcp.Lease, error) {
+			return dhcp.RebindLease(ctx, in, out, timeout, cfg.Interface, l, m)
+		},
+		lease: lease,
+		ifc:   ifc,
+		iface: cfg.Interface,
+		retry: leaseRetry,
+		log:   log,
 	}
+}
 
-	nCtx.UDPOut <- response
+// Ein Context welcher beendet wird sobald stop geschlossen wird
+func stopContext(stop <-chan struct{}) (context.Context, context.CancelFunc) {
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		select {
+		case <-stop:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
 
-	return nil
+	return ctx, cancel
 }
 
 func RebootHandler(nCtx dictator.NodeContext, payload dictator.DictatorPayload) error {
 	log := nCtx.AppContext.Log
-	log.Debug.Println(nCtx.NodeID, "- Receive command Reboot from", payload.DictatorID)
-	nCtx.AppContext.Done()
+	log.Info("Receive command Reboot", logging.KeyDictator, payload.DictatorID)
+	nCtx.AppContext.Shutdown()
 
 	return nil
 }
 
 func main() {
-	inAddr := net.UDPAddr{
-		IP:   net.ParseIP("255.255.255.255"),
-		Port: 43001,
+	cfg, err := LoadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return
 	}
-	connIn, err := net.ListenUDP("udp", &inAddr)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid configuration:")
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+
+	// Wurde bereits von Validate geprüft
+	level, _ := logging.ParseLevel(cfg.Log.Level)
+	slog.SetDefault(slog.New(logging.NewHandler(os.Stderr, level, cfg.Log.JSON)))
+
+	id, err := cfg.NodeIdentity()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Node identity:", err)
+		os.Exit(1)
+	}
+
+	clusterAddr := cfg.ClusterAddr()
+	connIn, err := dictator.ListenCluster(&clusterAddr, cfg.Interface)
 	if err != nil {
 		fmt.Println(err)
 		return
 	}
-	outAddr := net.UDPAddr{
-		IP:   net.ParseIP("255.255.255.255"),
-		Port: 43001,
-	}
-	connOut, err := net.DialUDP("udp", nil, &outAddr)
+	connOut, err := net.DialUDP("udp", nil, &clusterAddr)
 	if err != nil {
 		fmt.Println(err)
 		return
@@ -140,6 +188,37 @@ func main() {
 	}
 	ctx := dictator.NewContextWithConn(conns)
 
+	var dhcpMetrics dhcp.Metrics
+	if cfg.MetricsAddr != "" {
+		reg := prometheus.NewRegistry()
+		m, err := metrics.NewPrometheus(reg)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		ctx.Metrics = m
+		dhcpMetrics = m
+
+		mux := http.NewServeMux()
+		mux.Handle("/metrics", metrics.Handler(reg))
+		go func() {
+			err := http.ListenAndServe(cfg.MetricsAddr, mux)
+			if err != nil {
+				ctx.Log.Error("Serve metrics", logging.Err(err))
+			}
+		}()
+	}
+
+	sigCtx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	go func() {
+		<-sigCtx.Done()
+		ctx.Shutdown()
+		// In case the node doesn't react anymore
+		time.Sleep(2 * dictator.ShutdownTimeout)
+		ctx.Done()
+	}()
+
 	udpIn, err := dictator.UDPInbox(ctx, connIn)
 	if err != nil {
 		fmt.Println(err)
@@ -152,18 +231,61 @@ func main() {
 	}
 
 	cmdRouter := dictator.CommandRouter{}
-	cmdRouter.AddHandler("AssignIP", AssignIPHandler)
+	cmdRouter.Use(
+		dictator.RecoverMiddleware(),
+		dictator.LoggingMiddleware(),
+	)
+	if len(cfg.Keys.AllowedDictators) > 0 {
+		allow := dictator.AllowDictators(cfg.Keys.AllowedDictators...)
+		cmdRouter.Use(dictator.AuthorizeMiddleware(map[string]dictator.AuthorizeFunc{
+			assign.Command: allow,
+			"Reboot":       allow,
+		}))
+	}
+
+	lease := newLeaseTracker()
+
+	ifc := cfg.IfConfig(ctx.Log)
+	dictator.AddTypedHandler(&cmdRouter, assign.Command, newAssignIPHandler(cfg.Interface, ifc, lease))
 	cmdRouter.AddHandler("Reboot", RebootHandler)
 
-	m, response := NewCluster()
+	m, response := NewCluster(cfg, lease, ifc, dhcpMetrics)
 
 	mission := dictator.MissionSpecs{
 		Mission:       m,
 		CommandRouter: cmdRouter,
 		ResponseChan:  response,
+		Successor:     dictator.RecentSuccessor,
+		Leadership:    cfg.Leadership(),
+		Identity:      id,
+	}
+
+	node, err := dictator.Node(ctx, udpIn, udpOut, mission)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if cfg.AdminAddr != "" {
+		go func() {
+			err := http.ListenAndServe(cfg.AdminAddr, admin.NewHandler(node, lease.Lease))
+			if err != nil {
+				ctx.Log.Error("Serve admin API", logging.Err(err))
+			}
+		}()
 	}
 
-	dictator.Node(ctx, udpIn, udpOut, mission)
+	go func() {
+		for t := range node.Subscribe() {
+			ctx.Log.Info(
+				"Node state changed",
+				logging.KeyNode, node.NodeID(),
+				"from", t.From.String(),
+				"to", t.To.String(),
+				logging.KeyDictator, t.Dictator,
+				logging.KeyTerm, t.Term,
+			)
+		}
+	}()
 
 	<-ctx.DoneChan
 }
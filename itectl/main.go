@@ -0,0 +1,251 @@
+// Kommandozeile um einen ite Cluster zu bedienen. Alle Befehle außer watch
+// sprechen mit der Admin API einer Node, siehe ite -admin. watch lauscht
+// passiv auf die Pakete des Clusters.
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/rrawrriw/ite/admin"
+	"github.com/rrawrriw/ite/dictator"
+)
+
+const usage = `Usage: itectl [-addr host:port] <command> [arguments]
+
+Commands:
+  nodes                            List all known nodes and their roles
+  dictator                         Show the current dictator
+  send [-node ID] [-wait D] NAME [JSON]
+                                   Send a command to all nodes or to one
+                                   node and print the responses
+  reboot [-node ID] [-wait D]      Reboot all nodes or one node
+  commands                         List the commands in flight
+  lease                            Show the DHCP lease of the node
+  stepdown                         Let the dictator abdicate
+  elect                            Start an election on the node
+  watch [-listen host:port] [-interface NAME]
+                                   Print the heartbeats of the cluster,
+                                   joins the group of a multicast address
+`
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:7070", "Address of the admin API of a node")
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	c := admin.NewClient(*addr)
+	args := flag.Args()[1:]
+
+	var err error
+	switch flag.Arg(0) {
+	case "nodes":
+		err = nodes(c)
+	case "dictator":
+		err = showDictator(c)
+	case "send":
+		err = send(c, args)
+	case "reboot":
+		err = reboot(c, args)
+	case "commands":
+		err = commands(c)
+	case "lease":
+		err = lease(c)
+	case "stepdown":
+		err = c.StepDown()
+	case "elect":
+		err = c.Elect()
+	case "watch":
+		err = watch(args)
+	default:
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "itectl:", err)
+		os.Exit(1)
+	}
+}
+
+func nodes(c admin.Client) error {
+	s, err := c.Status()
+	if err != nil {
+		return err
+	}
+	members, err := c.Members()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tNAME\tROLE\tLAST SEEN")
+	fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", s.ID, orDash(s.Name), s.Role, "self")
+	for _, m := range members {
+		role := dictator.StateFollower.String()
+		if m.Dictator {
+			role = dictator.StateDictator.String()
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v ago\n", m.ID, orDash(m.Name), role, time.Since(m.LastSeen).Round(time.Second))
+	}
+
+	return w.Flush()
+}
+
+func showDictator(c admin.Client) error {
+	s, err := c.Status()
+	if err != nil {
+		return err
+	}
+
+	if s.Dictator == "" {
+		return errors.New("No dictator known")
+	}
+	fmt.Printf("%v (term %v)\n", s.Dictator, s.Term)
+
+	return nil
+}
+
+func send(c admin.Client, args []string) error {
+	fs := flag.NewFlagSet("send", flag.ExitOnError)
+	node := fs.String("node", "", "Only this node runs the command")
+	wait := fs.Duration("wait", 2*time.Second, "How long to collect responses")
+	fs.Parse(args)
+
+	if fs.NArg() < 1 || fs.NArg() > 2 {
+		return errors.New("send expects NAME [JSON]")
+	}
+
+	var value json.RawMessage
+	if fs.NArg() == 2 {
+		value = json.RawMessage(fs.Arg(1))
+		if !json.Valid(value) {
+			return fmt.Errorf("Invalid JSON value %v", fs.Arg(1))
+		}
+	}
+
+	return sendAndWait(c, *node, fs.Arg(0), value, *wait)
+}
+
+func reboot(c admin.Client, args []string) error {
+	fs := flag.NewFlagSet("reboot", flag.ExitOnError)
+	node := fs.String("node", "", "Only reboot this node")
+	wait := fs.Duration("wait", 2*time.Second, "How long to collect responses")
+	fs.Parse(args)
+
+	return sendAndWait(c, *node, "Reboot", nil, *wait)
+}
+
+// Sendet den Befehl und gibt die Antworten aus sobald wait abgelaufen ist
+// oder die Node target geantwortet hat
+func sendAndWait(c admin.Client, target, name string, value json.RawMessage, wait time.Duration) error {
+	id, err := c.Send(target, name, value)
+	if err != nil {
+		return err
+	}
+	fmt.Println("Command", id)
+
+	deadline := time.Now().Add(wait)
+	cmd := admin.Command{}
+	for {
+		cmd, err = c.Command(id)
+		if err != nil {
+			return err
+		}
+		if target != "" && isDone(cmd) {
+			break
+		}
+		if time.Now().After(deadline) {
+			break
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	if len(cmd.Results) == 0 {
+		return errors.New("No node responded")
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "NODE\tNAME\tSTATUS\tRESULT")
+	for _, r := range cmd.Results {
+		result := r.Error
+		if r.Error == "" && r.Result != nil {
+			b, err := json.Marshal(r.Result)
+			if err != nil {
+				return err
+			}
+			result = string(b)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\n", r.NodeID, orDash(r.NodeName), r.StatusText, result)
+	}
+
+	return w.Flush()
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
+
+func isDone(cmd admin.Command) bool {
+	for _, r := range cmd.Results {
+		if r.Status != dictator.StatusProgress {
+			return true
+		}
+	}
+
+	return false
+}
+
+func commands(c admin.Client) error {
+	cmds, err := c.Commands()
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tNAME\tTARGET\tSENT\tRESPONSES")
+	for _, cmd := range cmds {
+		target := cmd.Target
+		if target == "" {
+			target = "all"
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\n", cmd.ID, cmd.Name, target, cmd.Sent.Format(time.TimeOnly), cmd.Responses)
+	}
+
+	return w.Flush()
+}
+
+func lease(c admin.Client) error {
+	l, err := c.Lease()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%v received %v, %vs of %vs left\n",
+		l.IP,
+		l.Received.Format(time.DateTime),
+		int(l.RemainingSeconds),
+		int(l.DurationSeconds),
+	)
+
+	return nil
+}
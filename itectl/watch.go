@@ -0,0 +1,126 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"time"
+
+	"github.com/rrawrriw/ite/dictator"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type (
+	watchArgs struct {
+		Addr *net.UDPAddr
+		// Interface für die Multicast Gruppe, leer wählt das System
+		Interface string
+	}
+
+	// Gibt die empfangenen Pakete aus und merkt sich wann der letzte
+	// Heartbeat eines Diktators kam
+	watcher struct {
+		out  io.Writer
+		last map[string]time.Time
+	}
+)
+
+func parseWatchArgs(args []string) (watchArgs, error) {
+	fs := flag.NewFlagSet("watch", flag.ContinueOnError)
+	listen := fs.String("listen", "255.255.255.255:43001", "Address the cluster broadcasts to, may be a multicast group")
+	iface := fs.String("interface", "", "Interface to join the multicast group on")
+	err := fs.Parse(args)
+	if err != nil {
+		return watchArgs{}, err
+	}
+	if fs.NArg() > 0 {
+		return watchArgs{}, fmt.Errorf("watch expects no arguments, was %v", fs.Args())
+	}
+
+	addr, err := net.ResolveUDPAddr("udp", *listen)
+	if err != nil {
+		return watchArgs{}, err
+	}
+
+	return watchArgs{Addr: addr, Interface: *iface}, nil
+}
+
+// Gibt alle Heartbeats und Abdankungen aus. Es wird nur gelauscht, der
+// Cluster bemerkt itectl nicht.
+func watch(args []string) error {
+	wArgs, err := parseWatchArgs(args)
+	if err != nil {
+		return err
+	}
+	conn, err := dictator.ListenCluster(wArgs.Addr, wArgs.Interface)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	w := newWatcher(os.Stdout)
+	buf := make([]byte, dictator.MaxUDPPacketSize)
+	for {
+		size, _, err := conn.ReadFromUDP(buf)
+		if err != nil {
+			return err
+		}
+
+		w.print(dictator.UDPPacket{
+			Payload: buf[:size],
+			Size:    size,
+		}, time.Now())
+	}
+}
+
+func newWatcher(out io.Writer) watcher {
+	return watcher{
+		out:  out,
+		last: map[string]time.Time{},
+	}
+}
+
+// Andere Pakete als Heartbeats und Abdankungen werden ignoriert
+func (w watcher) print(packet dictator.UDPPacket, now time.Time) {
+	if !dictator.IsDictatorPayload(packet) {
+		return
+	}
+	payload, err := dictator.ReadDictatorPayload(packet)
+	if err != nil {
+		return
+	}
+
+	switch {
+	case dictator.IsHeartbeat(payload):
+		hb := dictator.ReadHeartbeat(payload)
+		interval := "-"
+		if t, ok := w.last[payload.DictatorID]; ok {
+			interval = now.Sub(t).Round(time.Millisecond).String()
+		}
+		w.last[payload.DictatorID] = now
+
+		fmt.Fprintf(w.out, "%v heartbeat  dictator=%v name=%q term=%v priority=%v interval=%v\n",
+			now.Format(time.TimeOnly),
+			payload.DictatorID,
+			hb.Name,
+			hb.Term,
+			hb.Priority,
+			interval,
+		)
+	case dictator.IsAbdication(payload):
+		blob := dictator.AbdicationBlob{}
+		err := bson.Unmarshal(payload.Blob, &blob)
+		if err != nil {
+			return
+		}
+		delete(w.last, payload.DictatorID)
+
+		fmt.Fprintf(w.out, "%v abdication dictator=%v successor=%q\n",
+			now.Format(time.TimeOnly),
+			payload.DictatorID,
+			blob.Successor,
+		)
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rrawrriw/ite/dictator"
+)
+
+func Test_ParseWatchArgs_Defaults(t *testing.T) {
+	wArgs, err := parseWatchArgs(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if wArgs.Addr.String() != "255.255.255.255:43001" {
+		t.Fatal("Expect 255.255.255.255:43001 was", wArgs.Addr)
+	}
+	if wArgs.Interface != "" {
+		t.Fatal("Expect no interface was", wArgs.Interface)
+	}
+}
+
+func Test_ParseWatchArgs_Multicast(t *testing.T) {
+	wArgs, err := parseWatchArgs([]string{"-listen", "239.1.2.3:43002", "-interface", "eth1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !wArgs.Addr.IP.IsMulticast() || wArgs.Addr.Port != 43002 {
+		t.Fatal("Expect 239.1.2.3:43002 was", wArgs.Addr)
+	}
+	if wArgs.Interface != "eth1" {
+		t.Fatal("Expect eth1 was", wArgs.Interface)
+	}
+}
+
+func Test_ParseWatchArgs_Invalid(t *testing.T) {
+	for _, args := range [][]string{
+		{"-listen", "no-port"},
+		{"extra"},
+		{"-unknown"},
+	} {
+		_, err := parseWatchArgs(args)
+		if err == nil {
+			t.Fatal("Expect an error for", args)
+		}
+	}
+}
+
+func Test_Watcher_Heartbeat(t *testing.T) {
+	packet, err := dictator.NewHeartbeatPacket("d1", dictator.HeartbeatBlob{
+		Priority: 2,
+		Term:     3,
+		Name:     "alpha",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	w := newWatcher(out)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w.print(packet, now)
+	w.print(packet, now.Add(250*time.Millisecond))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	expect := []string{
+		`12:00:00 heartbeat  dictator=d1 name="alpha" term=3 priority=2 interval=-`,
+		`12:00:00 heartbeat  dictator=d1 name="alpha" term=3 priority=2 interval=250ms`,
+	}
+	if len(lines) != len(expect) {
+		t.Fatal("Expect", len(expect), "lines was", lines)
+	}
+	for i := range expect {
+		if lines[i] != expect[i] {
+			t.Fatal("Expect", expect[i], "was", lines[i])
+		}
+	}
+}
+
+func Test_Watcher_Abdication(t *testing.T) {
+	hb, err := dictator.NewHeartbeatPacket("d1", dictator.HeartbeatBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	abdication, err := dictator.NewAbdicationPacket("d1", "d2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	out := &bytes.Buffer{}
+	w := newWatcher(out)
+	now := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	w.print(hb, now)
+	w.print(abdication, now)
+
+	if !strings.Contains(out.String(), `12:00:00 abdication dictator=d1 successor="d2"`) {
+		t.Fatal("Expect an abdication was", out.String())
+	}
+	if _, ok := w.last["d1"]; ok {
+		t.Fatal("Expect the heartbeat of d1 to be forgotten")
+	}
+}
+
+func Test_Watcher_Ignore(t *testing.T) {
+	out := &bytes.Buffer{}
+	w := newWatcher(out)
+	w.print(dictator.UDPPacket{Payload: []byte("noise")}, time.Now())
+
+	if out.Len() != 0 {
+		t.Fatal("Expect no output was", out.String())
+	}
+}
+
+func Test_Watcher_Discard(t *testing.T) {
+	packet, err := dictator.NewHeartbeatPacket("d1", dictator.HeartbeatBlob{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := newWatcher(io.Discard)
+	w.print(packet, time.Now())
+	if _, ok := w.last["d1"]; !ok {
+		t.Fatal("Expect the heartbeat of d1 to be remembered")
+	}
+}
@@ -0,0 +1,72 @@
+// Gemeinsamer Lebenszyklus der Contexte von dictator und dhcp. Beide
+// bauen auf einem context.Context auf, merken sich die Ursache des
+// Beendens und schließen dabei ihre UDP Verbindungen.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net"
+	"sync"
+
+	"github.com/rrawrriw/ite/logging"
+)
+
+// Die Ursache wenn Done aufgerufen wird
+var ShutdownError = errors.New("Shutdown")
+
+type Lifecycle struct {
+	Ctx context.Context
+	// Beendet den Context. Kann mehrfach aufgerufen werden.
+	Done func()
+	// Wie Done, merkt sich aber die Ursache. Diese liefert Err.
+	Cancel   func(cause error)
+	DoneChan <-chan struct{}
+}
+
+// Erzeugt einen Lifecycle welcher beendet wird sobald parent beendet wird
+// oder Done bzw. Cancel aufgerufen wird. Dabei werden alle conns
+// geschlossen, Fehler beim Schließen gehen an log.
+func New(parent context.Context, conns []*net.UDPConn, log *slog.Logger) Lifecycle {
+	ctx, cancel := context.WithCancelCause(parent)
+	log = logging.Or(log)
+
+	closeOnce := sync.Once{}
+	closeConns := func() {
+		closeOnce.Do(func() {
+			for _, c := range conns {
+				err := c.Close()
+				if err != nil && !errors.Is(err, net.ErrClosed) {
+					log.Error("Close connection", logging.Err(err))
+				}
+			}
+		})
+	}
+
+	// Wird parent beendet müssen die conns ebenfalls geschlossen werden
+	context.AfterFunc(ctx, closeConns)
+
+	cancelF := func(cause error) {
+		cancel(cause)
+		closeConns()
+	}
+
+	return Lifecycle{
+		Ctx: ctx,
+		Done: func() {
+			cancelF(ShutdownError)
+		},
+		Cancel:   cancelF,
+		DoneChan: ctx.Done(),
+	}
+}
+
+// Gibt die Ursache zurück warum der Context beendet wurde, ansonsten nil
+func (l Lifecycle) Err() error {
+	if l.Ctx == nil {
+		return nil
+	}
+
+	return context.Cause(l.Ctx)
+}
@@ -0,0 +1,64 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+)
+
+func Test_Lifecycle_Cancel(t *testing.T) {
+	a := net.UDPAddr{
+		IP:   net.ParseIP("127.0.0.1"),
+		Port: 12355,
+	}
+	c, err := net.ListenUDP("udp", &a)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	l := New(context.Background(), []*net.UDPConn{c}, nil)
+	if l.Err() != nil {
+		t.Fatal("Expect no error was", l.Err())
+	}
+
+	cause := errors.New("test")
+	l.Cancel(cause)
+	l.Done()
+
+	select {
+	case <-l.DoneChan:
+	default:
+		t.Fatal("Expect done channel to be closed")
+	}
+	if l.Err() != cause {
+		t.Fatal("Expect", cause, "was", l.Err())
+	}
+
+	// Die Verbindung ist bereits geschlossen
+	c, err = net.ListenUDP("udp", &a)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	c.Close()
+}
+
+func Test_Lifecycle_Parent(t *testing.T) {
+	parent, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	l := New(parent, nil, nil)
+	select {
+	case <-l.DoneChan:
+	case <-time.After(1 * time.Second):
+		t.Fatal("Expect done channel to be closed after the deadline")
+	}
+	if l.Err() != context.DeadlineExceeded {
+		t.Fatal("Expect", context.DeadlineExceeded, "was", l.Err())
+	}
+
+	if (Lifecycle{}).Err() != nil {
+		t.Fatal("Expect no error without a context")
+	}
+}
@@ -0,0 +1,66 @@
+// Gemeinsame Grundlage der strukturierten Logs von dictator und dhcp. Beide
+// Pakete loggen über einen *slog.Logger, welchen die Anwendung mit einem
+// eigenen slog.Handler erzeugen kann. Ohne eigenen Logger wird
+// slog.Default verwendet.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"strings"
+)
+
+// Feldnamen welche alle Pakete verwenden, damit sich die Logs nach Node,
+// Amtszeit oder Befehl filtern lassen
+const (
+	KeyNode      = "node"
+	KeyTerm      = "term"
+	KeyDictator  = "dictator"
+	KeyCommand   = "command"
+	KeyCommandID = "command_id"
+	KeyXID       = "xid"
+	KeyError     = "err"
+)
+
+// Erzeugt einen Handler für w. Mit json wird JSON statt key=value
+// geschrieben.
+func NewHandler(w io.Writer, level slog.Leveler, json bool) slog.Handler {
+	opts := &slog.HandlerOptions{
+		Level: level,
+	}
+	if json {
+		return slog.NewJSONHandler(w, opts)
+	}
+
+	return slog.NewTextHandler(w, opts)
+}
+
+// Liest debug, info, warn oder error
+func ParseLevel(s string) (slog.Level, error) {
+	switch strings.ToLower(s) {
+	case "debug":
+		return slog.LevelDebug, nil
+	case "info", "":
+		return slog.LevelInfo, nil
+	case "warn", "warning":
+		return slog.LevelWarn, nil
+	case "error":
+		return slog.LevelError, nil
+	}
+
+	return slog.LevelInfo, fmt.Errorf("Unknown log level %q", s)
+}
+
+// Gibt l zurück oder slog.Default falls l nil ist
+func Or(l *slog.Logger) *slog.Logger {
+	if l == nil {
+		return slog.Default()
+	}
+
+	return l
+}
+
+func Err(err error) slog.Attr {
+	return slog.Any(KeyError, err)
+}
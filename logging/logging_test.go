@@ -0,0 +1,43 @@
+package logging
+
+import (
+	"bytes"
+	"errors"
+	"log/slog"
+	"strings"
+	"testing"
+)
+
+func Test_NewHandler(t *testing.T) {
+	buf := &bytes.Buffer{}
+	l := slog.New(NewHandler(buf, slog.LevelInfo, false))
+
+	l.Debug("hidden")
+	l.With(KeyNode, "1").Error("failed", Err(errors.New("boom")))
+
+	out := buf.String()
+	if strings.Contains(out, "hidden") {
+		t.Fatal("Expect debug message to be filtered", out)
+	}
+	if !strings.Contains(out, "node=1") || !strings.Contains(out, "err=boom") {
+		t.Fatal("Expect node and err fields in", out)
+	}
+}
+
+func Test_ParseLevel(t *testing.T) {
+	l, err := ParseLevel("DEBUG")
+	if err != nil || l != slog.LevelDebug {
+		t.Fatal("Expect", slog.LevelDebug, "was", l, err)
+	}
+
+	_, err = ParseLevel("verbose")
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+}
+
+func Test_Or(t *testing.T) {
+	if Or(nil) != slog.Default() {
+		t.Fatal("Expect the default logger")
+	}
+}
@@ -0,0 +1,253 @@
+// Erfasst die Metrics der dictator und dhcp Pakete mit Prometheus
+package metrics
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "ite"
+
+// Implementiert dictator.Metrics und dhcp.Metrics
+type Prometheus struct {
+	electionsStarted  prometheus.Counter
+	electionsWon      prometheus.Counter
+	dictatorSeconds   prometheus.Counter
+	heartbeatsSent    prometheus.Counter
+	heartbeatsRecv    prometheus.Counter
+	heartbeatInterval prometheus.Histogram
+	heartbeatJitter   prometheus.Histogram
+	heartbeatsMissed  prometheus.Counter
+	commandsSent      *prometheus.CounterVec
+	commandsAcked     *prometheus.CounterVec
+	commandsFailed    *prometheus.CounterVec
+	handlerLatency    *prometheus.HistogramVec
+	packetsDropped    prometheus.Counter
+
+	dhcpAttempts prometheus.Counter
+	dhcpOffers   prometheus.Counter
+	dhcpAcks     prometheus.Counter
+	dhcpNaks     prometheus.Counter
+
+	mutex       *sync.Mutex
+	leaseExpire time.Time
+}
+
+func NewPrometheus(reg prometheus.Registerer) (*Prometheus, error) {
+	p := &Prometheus{
+		electionsStarted: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "elections_started_total",
+			Help:      "Number of elections started by this node.",
+		}),
+		electionsWon: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "elections_won_total",
+			Help:      "Number of elections this node won without a rival dictator.",
+		}),
+		dictatorSeconds: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dictator_seconds_total",
+			Help:      "Time this node spent as dictator.",
+		}),
+		heartbeatsSent: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "heartbeats_sent_total",
+			Help:      "Number of heartbeats sent as dictator.",
+		}),
+		heartbeatsRecv: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "heartbeats_received_total",
+			Help:      "Number of heartbeats received from a dictator.",
+		}),
+		heartbeatInterval: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "heartbeat_interval_seconds",
+			Help:      "Time between two received heartbeats.",
+			Buckets:   []float64{.05, .1, .125, .15, .2, .3, .5, 1, 1.5},
+		}),
+		heartbeatJitter: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "heartbeat_jitter_seconds",
+			Help:      "Difference between two consecutive heartbeat intervals.",
+			Buckets:   []float64{.001, .005, .01, .025, .05, .1, .25, .5},
+		}),
+		heartbeatsMissed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "heartbeats_missed_total",
+			Help:      "Number of times the dictator stopped sending heartbeats.",
+		}),
+		commandsSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_sent_total",
+			Help:      "Number of commands sent as dictator.",
+		}, []string{"command"}),
+		commandsAcked: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_acked_total",
+			Help:      "Number of successful command responses.",
+		}, []string{"command"}),
+		commandsFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "commands_failed_total",
+			Help:      "Number of failed command responses.",
+		}, []string{"command"}),
+		handlerLatency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "command_handler_seconds",
+			Help:      "Runtime of the command handlers.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"command"}),
+		packetsDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "packets_dropped_total",
+			Help:      "Number of received packets without a dictator payload.",
+		}),
+		dhcpAttempts: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dhcp_attempts_total",
+			Help:      "Number of DHCP discovers sent.",
+		}),
+		dhcpOffers: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dhcp_offers_total",
+			Help:      "Number of DHCP offers received.",
+		}),
+		dhcpAcks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dhcp_acks_total",
+			Help:      "Number of DHCP acks received.",
+		}),
+		dhcpNaks: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "dhcp_naks_total",
+			Help:      "Number of DHCP naks received.",
+		}),
+		mutex: &sync.Mutex{},
+	}
+
+	leaseRemaining := prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "dhcp_lease_remaining_seconds",
+		Help:      "Remaining time of the last DHCP lease.",
+	}, p.leaseRemaining)
+
+	collectors := []prometheus.Collector{
+		p.electionsStarted,
+		p.electionsWon,
+		p.dictatorSeconds,
+		p.heartbeatsSent,
+		p.heartbeatsRecv,
+		p.heartbeatInterval,
+		p.heartbeatJitter,
+		p.heartbeatsMissed,
+		p.commandsSent,
+		p.commandsAcked,
+		p.commandsFailed,
+		p.handlerLatency,
+		p.packetsDropped,
+		p.dhcpAttempts,
+		p.dhcpOffers,
+		p.dhcpAcks,
+		p.dhcpNaks,
+		leaseRemaining,
+	}
+	for _, c := range collectors {
+		err := reg.Register(c)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return p, nil
+}
+
+// Liefert die Metrics im Prometheus Format aus
+func Handler(g prometheus.Gatherer) http.Handler {
+	return promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+}
+
+func (p *Prometheus) ElectionStarted() {
+	p.electionsStarted.Inc()
+}
+
+func (p *Prometheus) ElectionWon() {
+	p.electionsWon.Inc()
+}
+
+func (p *Prometheus) DictatorTime(d time.Duration) {
+	p.dictatorSeconds.Add(d.Seconds())
+}
+
+func (p *Prometheus) HeartbeatSent() {
+	p.heartbeatsSent.Inc()
+}
+
+func (p *Prometheus) HeartbeatReceived(interval, jitter time.Duration) {
+	p.heartbeatsRecv.Inc()
+	p.heartbeatInterval.Observe(interval.Seconds())
+	p.heartbeatJitter.Observe(jitter.Seconds())
+}
+
+func (p *Prometheus) HeartbeatMissed() {
+	p.heartbeatsMissed.Inc()
+}
+
+func (p *Prometheus) CommandSent(name string) {
+	p.commandsSent.WithLabelValues(name).Inc()
+}
+
+func (p *Prometheus) CommandAcked(name string) {
+	p.commandsAcked.WithLabelValues(name).Inc()
+}
+
+func (p *Prometheus) CommandFailed(name string) {
+	p.commandsFailed.WithLabelValues(name).Inc()
+}
+
+func (p *Prometheus) HandlerLatency(name string, d time.Duration) {
+	p.handlerLatency.WithLabelValues(name).Observe(d.Seconds())
+}
+
+func (p *Prometheus) PacketDropped() {
+	p.packetsDropped.Inc()
+}
+
+func (p *Prometheus) DHCPAttempt() {
+	p.dhcpAttempts.Inc()
+}
+
+func (p *Prometheus) DHCPOffer() {
+	p.dhcpOffers.Inc()
+}
+
+func (p *Prometheus) DHCPAck() {
+	p.dhcpAcks.Inc()
+}
+
+func (p *Prometheus) DHCPNak() {
+	p.dhcpNaks.Inc()
+}
+
+func (p *Prometheus) DHCPLease(d time.Duration) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	p.leaseExpire = time.Now().Add(d)
+}
+
+func (p *Prometheus) leaseRemaining() float64 {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	remaining := time.Until(p.leaseExpire).Seconds()
+	if remaining < 0 {
+		return 0
+	}
+
+	return remaining
+}
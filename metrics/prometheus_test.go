@@ -0,0 +1,94 @@
+package metrics
+
+import (
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rrawrriw/ite/dhcp"
+	"github.com/rrawrriw/ite/dictator"
+)
+
+var (
+	_ dictator.Metrics = &Prometheus{}
+	_ dhcp.Metrics     = &Prometheus{}
+)
+
+func Test_Prometheus_Counters(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p, err := NewPrometheus(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p.ElectionStarted()
+	p.ElectionWon()
+	p.CommandSent("AssignIP")
+	p.CommandSent("AssignIP")
+	p.CommandFailed("Reboot")
+	p.DHCPAttempt()
+
+	if v := testutil.ToFloat64(p.electionsWon); v != 1 {
+		t.Fatal("Expect 1 won election was", v)
+	}
+	if v := testutil.ToFloat64(p.commandsSent.WithLabelValues("AssignIP")); v != 2 {
+		t.Fatal("Expect 2 sent commands was", v)
+	}
+	if v := testutil.ToFloat64(p.commandsFailed.WithLabelValues("Reboot")); v != 1 {
+		t.Fatal("Expect 1 failed command was", v)
+	}
+
+	// Ein zweites Registrieren muss fehlschlagen
+	_, err = NewPrometheus(reg)
+	if err == nil {
+		t.Fatal("Expect an error")
+	}
+}
+
+func Test_Prometheus_LeaseRemaining(t *testing.T) {
+	p, err := NewPrometheus(prometheus.NewRegistry())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if p.leaseRemaining() != 0 {
+		t.Fatal("Expect 0 without lease was", p.leaseRemaining())
+	}
+
+	p.DHCPLease(time.Hour)
+	r := p.leaseRemaining()
+	if r <= 3500 || r > 3600 {
+		t.Fatal("Expect about 3600 was", r)
+	}
+}
+
+func Test_Handler(t *testing.T) {
+	reg := prometheus.NewRegistry()
+	p, err := NewPrometheus(reg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p.HeartbeatSent()
+
+	srv := httptest.NewServer(Handler(reg))
+	defer srv.Close()
+
+	resp, err := srv.Client().Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(string(body), "ite_heartbeats_sent_total 1") {
+		t.Fatal("Expect heartbeat counter in", string(body))
+	}
+}
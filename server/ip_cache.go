@@ -1,10 +1,41 @@
 package main
 
 import (
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
 	"net"
 	"time"
 )
 
+// Sekunden welche ein Angebot auf seine Bestätigung wartet
+const DefaultTTL = 30
+
+const (
+	// Reserviert die nächste freie IP bis zum Ablauf der TTL
+	NextIPRequest = iota + 1
+	// Liest die IP zu einer ConfirmID
+	ReadIPRequest
+	// Der Client bestätigt die IP, diese läuft dann erst nach der Lease
+	// Time ab
+	ConfirmIPRequest
+	// Gibt die IP wieder frei
+	ReleaseIPRequest
+	// Verlängert das Angebot um die TTL oder die bestätigte IP um die
+	// Lease Time
+	RenewIPRequest
+)
+
+var (
+	NoFreeIPError           = errors.New("No free IP address in subnet")
+	UnknownConfirmIDError   = errors.New("Unknown confirm ID")
+	InvalidSubnetError      = errors.New("Invalid subnet")
+	DuplicateIPError        = errors.New("IP address already in cache")
+	DuplicateConfirmIDError = errors.New("Confirm ID already in cache")
+	ReservedIPInUseError    = errors.New("Reserved IP address is leased to another client")
+)
+
 type IPItemResponse struct {
 	IP        net.IP
 	ConfirmID string
@@ -12,74 +43,515 @@ type IPItemResponse struct {
 }
 
 type IPItem struct {
-	IP     net.IP
-	Expire time.Time
+	IP net.IP
+	// Der Nullwert läuft nie ab
+	Expire    time.Time
+	Confirmed bool
+	// Optional bei InitIPCache, ohne wird eine neue ConfirmID erzeugt
+	ConfirmID string `bson:",omitempty"`
+	// Der Client welcher die IP angefragt hat, leer wenn unbekannt
+	Owner Owner `bson:",omitempty"`
 }
 
 // Netmask 255.255.255.0 es wird nichts akzeptiert wie 255.0.255.255.255
+// From selbst wird nicht vergeben, z.B. die Adresse des Servers. Vergeben
+// wird bis einschließlich To.
 type SubnetSpec struct {
 	Sub  int
 	From net.IP
 	To   net.IP
+	// Optional, wird nicht vergeben
+	Gateway net.IP
+	// Optional, Bereiche welche nicht vergeben werden
+	Exclude []IPRange
 }
 
 type IPCacheRequest struct {
-	Request    int
+	Request   int
+	ConfirmID string
+	// Nur bei NextIPRequest, siehe Reservations
+	Owner      Owner
 	ResultChan chan IPItemResponse
 	ErrorChan  chan error
 }
 
 type IPCacheC chan IPCacheRequest
 
+// Alle vergebenen IPs nach ConfirmID
 type IPCache map[string]IPItem
 
-// Verwaltet IPv4 Adressen
+// Verwaltet IPv4 Adressen, bestätigte IPs laufen nicht ab
 // ttl in Sekunden
 func NewIPCache(subnet SubnetSpec, init []IPItem, ttl int) (IPCacheC, error) {
-	ipCacheC := make(chan IPCacheRequest)
+	return NewIPCacheWithConfig(IPCacheConfig{
+		Subnet: subnet,
+		Init:   init,
+		TTL:    ttl,
+	})
+}
+
+// Alle Einstellungen eines IPCache, siehe NewIPCacheWithConfig
+type IPCacheConfig struct {
+	Subnet SubnetSpec
+	Init   []IPItem
+	// Sekunden, 0 läuft nie ab. Bestätigte IPs laufen nach Lease ab
+	// falls sie nicht erneuert werden.
+	TTL   int
+	Lease int
+	// Optional, reservierte IPs werden nur an ihren Owner vergeben, siehe
+	// Reservations
+	Reservations *Reservations
+	// Optional, speichert jede Änderung, siehe WAL. Wird geschlossen
+	// sobald der Cache geschlossen wird.
+	Log IPCacheLog
+}
+
+func NewIPCacheWithConfig(c IPCacheConfig) (IPCacheC, error) {
+	pool, err := NewPool(c.Subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	ipCacheC := make(IPCacheC)
 	ipCache := IPCache{}
-	err := InitIPCache(init, &ipCache)
+	err = InitIPCache(c.Init, &ipCache)
 	if err != nil {
 		return nil, err
 	}
+	if c.Log != nil {
+		for id, item := range ipCache {
+			err := c.Log.Put(id, item)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	ttl, lease := c.TTL, c.Lease
 	go func() {
 		for req := range ipCacheC {
-			err := CleanIPCache(&ipCache)
+			// Abgelaufene Einträge werden wie jede Änderung zuerst gelöscht
+			expired := expiredIPs(ipCache)
+			err := expired.write(c.Log)
 			if err != nil {
-				req.ErrorChan <- err
+				go respond(req, err, IPItemResponse{})
 				continue
 			}
+			expired.apply(ipCache)
+
+			res, change := IPItemResponse{}, ipCacheChange{}
 			switch req.Request {
-			// Next IP
-			case 1:
-			// Read IP by confirm id
-			case 2:
+			case NextIPRequest:
+				res, change = nextIP(pool, c.Reservations, ipCache, req.Owner, ttl)
+			case ReadIPRequest:
+				go respond(req, nil, readIP(ipCache, req.ConfirmID))
+				continue
+			case ConfirmIPRequest:
+				res, change = confirmIP(ipCache, req.ConfirmID, lease)
+			case ReleaseIPRequest:
+				res, change = releaseIP(ipCache, req.ConfirmID)
+			case RenewIPRequest:
+				res, change = renewIP(ipCache, req.ConfirmID, ttl, lease)
+			default:
+				go respond(req, UnknowRequestError, IPItemResponse{})
+				continue
+			}
 
+			// Erst wenn die Änderung im Log steht wird sie übernommen
+			err = change.write(c.Log)
+			if err != nil {
+				go respond(req, err, IPItemResponse{})
+				continue
 			}
+			change.apply(ipCache)
+			go respond(req, nil, res)
 		}
 
+		if c.Log != nil {
+			c.Log.Close()
+		}
 	}()
 
-	return make(IPCacheC), nil
+	return ipCacheC, nil
+
+}
+
+// Die Änderung einer Anfrage am IPCache. Sie wird zuerst in das Log
+// geschrieben und erst danach übernommen.
+type ipCacheChange struct {
+	put    map[string]IPItem
+	remove []string
+}
+
+func (c *ipCacheChange) putItem(confirmID string, item IPItem) {
+	if c.put == nil {
+		c.put = map[string]IPItem{}
+	}
+	c.put[confirmID] = item
+}
+
+func (c ipCacheChange) write(l IPCacheLog) error {
+	if l == nil {
+		return nil
+	}
+
+	for _, id := range c.remove {
+		err := l.Delete(id)
+		if err != nil {
+			return err
+		}
+	}
+	for id, item := range c.put {
+		err := l.Put(id, item)
+		if err != nil {
+			return err
+		}
+	}
 
+	return nil
+}
+
+func (c ipCacheChange) apply(cache IPCache) {
+	for _, id := range c.remove {
+		delete(cache, id)
+	}
+	for id, item := range c.put {
+		cache[id] = item
+	}
+}
+
+// Antwortet außerhalb des Caches, damit ein langsamer Client diesen nicht
+// blockiert. Bei einem Fehler gibt es kein Ergebnis.
+func respond(req IPCacheRequest, err error, res IPItemResponse) {
+	req.ErrorChan <- err
+	if err != nil {
+		return
+	}
+	req.ResultChan <- res
 }
 
 func InitIPCache(initIP []IPItem, cache *IPCache) error {
+	used := map[string]bool{}
+	for _, item := range *cache {
+		used[item.IP.String()] = true
+	}
+
+	for _, item := range initIP {
+		if item.IP.To4() == nil {
+			return fmt.Errorf("%v is not an IPv4 address", item.IP)
+		}
+		if used[item.IP.String()] {
+			return fmt.Errorf("%w: %v", DuplicateIPError, item.IP)
+		}
+
+		id := item.ConfirmID
+		if id == "" {
+			var err error
+			id, err = NewConfirmID()
+			if err != nil {
+				return err
+			}
+		}
+		if _, ok := (*cache)[id]; ok {
+			return fmt.Errorf("%w: %v", DuplicateConfirmIDError, id)
+		}
+		(*cache)[id] = item
+		used[item.IP.String()] = true
+	}
+
 	return nil
 }
 
 // Entfernet alle Abgelaufen Einträge
 func CleanIPCache(cache *IPCache) error {
+	expiredIPs(*cache).apply(*cache)
+
 	return nil
 }
 
-func (c IPCacheC) NextIP(resultC chan IPItemResponse) <-chan error {
+// Entfernt die abgelaufenen Einträge
+func expiredIPs(cache IPCache) ipCacheChange {
+	change := ipCacheChange{}
+	now := time.Now()
+	for id, item := range cache {
+		if !item.Expire.IsZero() && item.Expire.Before(now) {
+			change.remove = append(change.remove, id)
+		}
+	}
+
+	return change
+}
+
+func NewConfirmID() (string, error) {
+	buf := make([]byte, 8)
+	_, err := rand.Read(buf)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%x", buf), nil
+}
+
+// Prüft ob From, To, Gateway und die ausgeschlossenen Bereiche im gleichen
+// Subnetz liegen
+func (s SubnetSpec) Validate() error {
+	if s.Sub < 8 || s.Sub > 30 {
+		return fmt.Errorf("%w: prefix length must be between 8 and 30, was %v", InvalidSubnetError, s.Sub)
+	}
+	if s.From.To4() == nil || s.To.To4() == nil {
+		return fmt.Errorf("%w: %v - %v is not an IPv4 range", InvalidSubnetError, s.From, s.To)
+	}
+
+	mask := s.mask()
+	from := ipToUint(s.From)
+	to := ipToUint(s.To)
+	if from&mask != to&mask {
+		return fmt.Errorf("%w: %v and %v are not in the same /%v", InvalidSubnetError, s.From, s.To, s.Sub)
+	}
+	if to <= from {
+		return fmt.Errorf("%w: %v must be greater than %v", InvalidSubnetError, s.To, s.From)
+	}
+
+	inside := func(ip net.IP) bool {
+		return ip.To4() != nil && ipToUint(ip)&mask == from&mask
+	}
+	if s.Gateway != nil && !inside(s.Gateway) {
+		return fmt.Errorf("%w: gateway %v is not in /%v of %v", InvalidSubnetError, s.Gateway, s.Sub, s.From)
+	}
+	for _, r := range s.Exclude {
+		if !inside(r.From) || !inside(r.To) || ipToUint(r.To) < ipToUint(r.From) {
+			return fmt.Errorf("%w: excluded %v - %v is not a range in /%v of %v", InvalidSubnetError, r.From, r.To, s.Sub, s.From)
+		}
+	}
+
+	return nil
+}
+
+// Das Subnetz des Servers mit der Adresse ip. Vergeben werden die Adressen
+// nach ip bis vor die Broadcast Adresse. Ohne mask wird die Standardmaske
+// der Adressklasse verwendet.
+func SubnetFromAddr(ip net.IP, mask net.IPMask) (SubnetSpec, error) {
+	if ip.To4() == nil {
+		return SubnetSpec{}, fmt.Errorf("%w: %v is not an IPv4 address", InvalidSubnetError, ip)
+	}
+	if mask == nil {
+		mask = ip.DefaultMask()
+	}
+	ones, bits := mask.Size()
+	if bits != 32 {
+		return SubnetSpec{}, fmt.Errorf("%w: %v is not an IPv4 netmask", InvalidSubnetError, mask)
+	}
+
+	s := SubnetSpec{
+		Sub:  ones,
+		From: ip,
+	}
+	broadcast := ipToUint(ip)&s.mask() | ^s.mask()
+	s.To = uintToIP(broadcast - 1)
+
+	return s, s.Validate()
+}
+
+func (s SubnetSpec) mask() uint32 {
+	return ^uint32(0) << (32 - s.Sub)
+}
+
+// Die reservierte IP von owner oder die kleinste freie IP nach From
+func nextIP(pool Pool, reservations *Reservations, cache IPCache, owner Owner, ttl int) (IPItemResponse, ipCacheChange) {
+	ip, ok := reservations.Lookup(owner)
+	if ok {
+		return reservedIP(reservations, cache, ip, owner, ttl)
+	}
+
+	used := map[uint32]bool{}
+	for _, item := range cache {
+		used[ipToUint(item.IP)] = true
+	}
+
+	for ip := pool.first(); ip <= pool.last(); ip++ {
+		if !pool.usable(ip) || used[ip] || reservations.Reserved(uintToIP(ip)) {
+			continue
+		}
+
+		id, err := NewConfirmID()
+		if err != nil {
+			return IPItemResponse{Err: err}, ipCacheChange{}
+		}
+		item := IPItem{
+			IP:     uintToIP(ip),
+			Expire: expire(ttl),
+			Owner:  owner,
+		}
+		change := ipCacheChange{}
+		change.putItem(id, item)
+
+		return IPItemResponse{
+			IP:        item.IP,
+			ConfirmID: id,
+		}, change
+	}
+
+	return IPItemResponse{Err: NoFreeIPError}, ipCacheChange{}
+}
+
+// Der Owner erhält seine IP bei jeder Anfrage mit einer neuen ConfirmID.
+// Bisherige Einträge des Owners und offene Angebote mit dieser IP werden
+// entfernt, z.B. ein Angebot dessen ConfirmID der Owner verloren hat. Ist
+// die IP an einen anderen Client bestätigt, muss der Owner warten bis
+// dieser sie freigibt oder sie abläuft.
+func reservedIP(reservations *Reservations, cache IPCache, ip net.IP, owner Owner, ttl int) (IPItemResponse, ipCacheChange) {
+	change := ipCacheChange{}
+	for id, item := range cache {
+		if !item.IP.Equal(ip) {
+			continue
+		}
+		own, ok := reservations.Lookup(item.Owner)
+		if item.Confirmed && !(ok && own.Equal(ip)) {
+			return IPItemResponse{Err: fmt.Errorf("%w: %v", ReservedIPInUseError, ip)}, ipCacheChange{}
+		}
+		change.remove = append(change.remove, id)
+	}
+
+	id, err := NewConfirmID()
+	if err != nil {
+		return IPItemResponse{Err: err}, ipCacheChange{}
+	}
+	change.putItem(id, IPItem{
+		IP:     ip,
+		Expire: expire(ttl),
+		Owner:  owner,
+	})
+
+	return IPItemResponse{
+		IP:        ip,
+		ConfirmID: id,
+	}, change
+}
+
+func readIP(cache IPCache, confirmID string) IPItemResponse {
+	item, ok := cache[confirmID]
+	if !ok {
+		return IPItemResponse{Err: UnknownConfirmIDError}
+	}
+
+	return IPItemResponse{
+		IP:        item.IP,
+		ConfirmID: confirmID,
+	}
+}
+
+func confirmIP(cache IPCache, confirmID string, lease int) (IPItemResponse, ipCacheChange) {
+	item, ok := cache[confirmID]
+	if !ok {
+		return IPItemResponse{Err: UnknownConfirmIDError}, ipCacheChange{}
+	}
+	item.Confirmed = true
+	item.Expire = expire(lease)
+	change := ipCacheChange{}
+	change.putItem(confirmID, item)
+
+	return IPItemResponse{
+		IP:        item.IP,
+		ConfirmID: confirmID,
+	}, change
+}
+
+func releaseIP(cache IPCache, confirmID string) (IPItemResponse, ipCacheChange) {
+	item, ok := cache[confirmID]
+	if !ok {
+		return IPItemResponse{Err: UnknownConfirmIDError}, ipCacheChange{}
+	}
+
+	return IPItemResponse{
+		IP:        item.IP,
+		ConfirmID: confirmID,
+	}, ipCacheChange{remove: []string{confirmID}}
+}
+
+func renewIP(cache IPCache, confirmID string, ttl, lease int) (IPItemResponse, ipCacheChange) {
+	item, ok := cache[confirmID]
+	if !ok {
+		return IPItemResponse{Err: UnknownConfirmIDError}, ipCacheChange{}
+	}
+	if item.Confirmed {
+		item.Expire = expire(lease)
+	} else {
+		item.Expire = expire(ttl)
+	}
+	change := ipCacheChange{}
+	change.putItem(confirmID, item)
+
+	return IPItemResponse{
+		IP:        item.IP,
+		ConfirmID: confirmID,
+	}, change
+}
+
+// Zeitpunkt in sec Sekunden, 0 läuft nie ab
+func expire(sec int) time.Time {
+	if sec == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(sec) * time.Second)
+}
+
+func ipToUint(ip net.IP) uint32 {
+	return binary.BigEndian.Uint32(ip.To4())
+}
+
+// Liefert die 16 Byte Form wie net.ParseIP
+func uintToIP(i uint32) net.IP {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, i)
+	return net.IPv4(b[0], b[1], b[2], b[3])
+}
+
+func (c IPCacheC) send(request int, confirmID string, owner Owner, resultC chan IPItemResponse) <-chan error {
 	errorC := make(chan error)
 	c <- IPCacheRequest{
-		Request:    1,
+		Request:    request,
+		ConfirmID:  confirmID,
+		Owner:      owner,
 		ResultChan: resultC,
 		ErrorChan:  errorC,
 	}
 
 	return errorC
 }
+
+func (c IPCacheC) NextIP(resultC chan IPItemResponse) <-chan error {
+	return c.send(NextIPRequest, "", Owner{}, resultC)
+}
+
+func (c IPCacheC) ReadIP(confirmID string, resultC chan IPItemResponse) <-chan error {
+	return c.send(ReadIPRequest, confirmID, Owner{}, resultC)
+}
+
+func (c IPCacheC) ConfirmIP(confirmID string, resultC chan IPItemResponse) <-chan error {
+	return c.send(ConfirmIPRequest, confirmID, Owner{}, resultC)
+}
+
+func (c IPCacheC) ReleaseIP(confirmID string, resultC chan IPItemResponse) <-chan error {
+	return c.send(ReleaseIPRequest, confirmID, Owner{}, resultC)
+}
+
+func (c IPCacheC) RenewIP(confirmID string, resultC chan IPItemResponse) <-chan error {
+	return c.send(RenewIPRequest, confirmID, Owner{}, resultC)
+}
+
+// Sendet request und wartet auf das Ergebnis
+func (c IPCacheC) Do(request int, confirmID string) (IPItemResponse, error) {
+	return c.DoFor(Owner{}, request, confirmID)
+}
+
+// Wie Do, owner erhält bei NextIPRequest seine reservierte IP
+func (c IPCacheC) DoFor(owner Owner, request int, confirmID string) (IPItemResponse, error) {
+	resultC := make(chan IPItemResponse)
+	err := <-c.send(request, confirmID, owner, resultC)
+	if err != nil {
+		return IPItemResponse{}, err
+	}
+
+	return <-resultC, nil
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"net"
 	"testing"
 	"time"
@@ -49,12 +50,16 @@ func Test_CleanIPCache(t *testing.T) {
 		},
 		"2": IPItem{
 			IP:     net.ParseIP("192.168.1.2"),
-			Expire: time.Now().Add(-1),
+			Expire: time.Now().Add(time.Minute),
+		},
+		// Bestätigt
+		"3": IPItem{
+			IP: net.ParseIP("192.168.1.3"),
 		},
 	}
 	CleanIPCache(&ipCache)
 
-	if len(ipCache) != 1 {
+	if len(ipCache) != 2 {
 		t.Fatal("Error to many IPItems in cache", ipCache)
 	}
 }
@@ -78,5 +83,113 @@ func Test_InitIPCache(t *testing.T) {
 	}
 }
 
+func Test_InitIPCache_Duplicate(t *testing.T) {
+	ipCache := IPCache{}
+	ipItems := []IPItem{
+		IPItem{IP: net.ParseIP("192.168.1.1")},
+		IPItem{IP: net.ParseIP("192.168.1.1")},
+	}
+
+	err := InitIPCache(ipItems, &ipCache)
+	if !errors.Is(err, DuplicateIPError) {
+		t.Fatal("Expect", DuplicateIPError, "was", err)
+	}
+}
+
+func requestIP(t *testing.T, errC <-chan error, resultC chan IPItemResponse) IPItemResponse {
+	err := <-errC
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return <-resultC
+}
+
 func Test_ReadIPByID_OK(t *testing.T) {
+	resultC := make(chan IPItemResponse)
+	spec := SubnetSpec{
+		Sub:  24,
+		From: net.ParseIP("192.168.1.1"),
+		To:   net.ParseIP("192.168.1.10"),
+	}
+
+	c, err := NewIPCache(spec, []IPItem{}, 5)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(c)
+
+	next := requestIP(t, c.NextIP(resultC), resultC)
+	if next.Err != nil {
+		t.Fatal(next.Err.Error())
+	}
+
+	read := requestIP(t, c.ReadIP(next.ConfirmID, resultC), resultC)
+	if read.Err != nil {
+		t.Fatal(read.Err.Error())
+	}
+	if !read.IP.Equal(next.IP) {
+		t.Fatal("Expect", next.IP, ", was", read.IP)
+	}
+
+	unknown := requestIP(t, c.ReadIP("unknown", resultC), resultC)
+	if !errors.Is(unknown.Err, UnknownConfirmIDError) {
+		t.Fatal("Expect", UnknownConfirmIDError, ", was", unknown.Err)
+	}
+}
+
+func Test_ConfirmIP_Expire(t *testing.T) {
+	resultC := make(chan IPItemResponse)
+	spec := SubnetSpec{
+		Sub:  24,
+		From: net.ParseIP("192.168.1.1"),
+		To:   net.ParseIP("192.168.1.3"),
+	}
+
+	c, err := NewIPCache(spec, []IPItem{}, 1)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(c)
+
+	confirmed := requestIP(t, c.NextIP(resultC), resultC)
+	pending := requestIP(t, c.NextIP(resultC), resultC)
+	if !pending.IP.Equal(net.ParseIP("192.168.1.3")) {
+		t.Fatal("Expect 192.168.1.3, was", pending.IP)
+	}
+
+	full := requestIP(t, c.NextIP(resultC), resultC)
+	if !errors.Is(full.Err, NoFreeIPError) {
+		t.Fatal("Expect", NoFreeIPError, ", was", full.Err)
+	}
+
+	res := requestIP(t, c.ConfirmIP(confirmed.ConfirmID, resultC), resultC)
+	if res.Err != nil {
+		t.Fatal(res.Err.Error())
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	// Die unbestätigte IP ist abgelaufen und wird erneut vergeben
+	next := requestIP(t, c.NextIP(resultC), resultC)
+	if !next.IP.Equal(pending.IP) {
+		t.Fatal("Expect", pending.IP, ", was", next.IP)
+	}
+	res = requestIP(t, c.ReadIP(confirmed.ConfirmID, resultC), resultC)
+	if res.Err != nil {
+		t.Fatal(res.Err.Error())
+	}
+}
+
+func Test_NewIPCache_InvalidSubnet(t *testing.T) {
+	spec := SubnetSpec{
+		Sub:  24,
+		From: net.ParseIP("192.168.1.1"),
+		To:   net.ParseIP("192.168.2.1"),
+	}
+
+	_, err := NewIPCache(spec, []IPItem{}, 5)
+	if !errors.Is(err, InvalidSubnetError) {
+		t.Fatal("Expect", InvalidSubnetError, ", was", err)
+	}
 }
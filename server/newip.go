@@ -7,11 +7,61 @@ import (
 	"gopkg.in/mgo.v2/bson"
 )
 
-var UnknowRequestError = errors.New("Unknow Request")
+const (
+	// Fordert eine IP an, der Server antwortet mit einem Angebot
+	RequestIP = iota + 1
+	// Bestätigt das Angebot zur ConfirmID
+	ConfirmIP
+	// Gibt die IP zur ConfirmID wieder frei
+	ReleaseIP
+	// Verlängert das Angebot oder die bestätigte IP zur ConfirmID
+	RenewIP
+)
+
+var (
+	UnknowRequestError = errors.New("Unknow Request")
+	// AppContext.Store fehlt, siehe OpenStore
+	NoStoreError = errors.New("No IP store")
+)
 
 type AppContext struct {
-	LocalAddr    net.IP
+	LocalAddr net.IP
+	// Ohne Maske gilt die Standardmaske der Adressklasse von LocalAddr
+	LocalMask    net.IPMask
 	MemcachedUrl string
+	// Sekunden welche ein Angebot gilt, ohne Angabe DefaultTTL
+	TTL int
+	// Vergibt die IPs, siehe IPStore und OpenStore
+	Store IPStore
+}
+
+// Baut beim Start einmalig den Store über memcached, dessen Pool sich aus
+// LocalAddr und LocalMask ergibt. Ein bereits gesetzter Store bleibt.
+func (appCtx AppContext) OpenStore() (AppContext, error) {
+	if appCtx.Store != nil {
+		return appCtx, nil
+	}
+
+	subnet, err := SubnetFromAddr(appCtx.LocalAddr, appCtx.LocalMask)
+	if err != nil {
+		return appCtx, err
+	}
+	ttl := appCtx.TTL
+	if ttl == 0 {
+		ttl = DefaultTTL
+	}
+
+	store, err := NewStore(StoreConfig{
+		Memcached: appCtx.MemcachedUrl,
+		Subnet:    subnet,
+		TTL:       ttl,
+	})
+	if err != nil {
+		return appCtx, err
+	}
+	appCtx.Store = store
+
+	return appCtx, nil
 }
 
 type UDPPacket struct {
@@ -21,38 +71,96 @@ type UDPPacket struct {
 
 type IteRequest struct {
 	Request int
+	// Nur bei ConfirmIP, ReleaseIP und RenewIP
+	ConfirmID string `bson:",omitempty"`
+	// Optional bei RequestIP, siehe Reservations
+	Owner `bson:",inline"`
 }
 
 type IteResponse struct {
 	NewIP     string
 	ServerIP  string
 	ConfirmID string
+	// Gesetzt falls die Anfrage nicht ausgeführt werden konnte, z.B. bei
+	// einer abgelaufenen ConfirmID
+	Error string `bson:",omitempty"`
 }
 
+// Beantwortet das nächste Paket aus queue. Kann das Paket nicht gelesen
+// werden geht der Fehler an errorC, alle anderen Fehler stehen in der
+// Antwort.
 func NewIP(appCtx AppContext, queue chan UDPPacket, resultC chan []byte, errorC chan error) {
 	udpPacket := <-queue
-	request := IteRequest{}
-	err := bson.Unmarshal(udpPacket.Payload, &request)
+	response, err := HandleIteRequest(appCtx, udpPacket.Payload)
 	if err != nil {
 		errorC <- err
 		return
 	}
 
-	if request.Request != 1 {
-		errorC <- UnknowRequestError
-		return
+	resultC <- response
+}
+
+// Führt die BSON kodierte Anfrage aus und gibt die BSON kodierte Antwort
+// zurück
+func HandleIteRequest(appCtx AppContext, payload []byte) ([]byte, error) {
+	request := IteRequest{}
+	err := bson.Unmarshal(payload, &request)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheRequest := 0
+	switch request.Request {
+	case RequestIP:
+		cacheRequest = NextIPRequest
+	case ConfirmIP:
+		cacheRequest = ConfirmIPRequest
+	case ReleaseIP:
+		cacheRequest = ReleaseIPRequest
+	case RenewIP:
+		cacheRequest = RenewIPRequest
+	default:
+		return nil, UnknowRequestError
 	}
 
-	//ip, confirmID, err := NextIPEtcd()
-	//ip, confirmID, err := NextIPMemcache(ctx)
+	var result IPItemResponse
+	store, ok := appCtx.Store.(ReservingStore)
+	if ok {
+		result, err = store.DoFor(request.Owner, cacheRequest, request.ConfirmID)
+	} else {
+		result, err = appCtx.Store.Do(cacheRequest, request.ConfirmID)
+	}
+	if err != nil {
+		return nil, err
+	}
 
-	resultC <- []byte("")
+	response := IteResponse{
+		ServerIP:  appCtx.LocalAddr.String(),
+		ConfirmID: result.ConfirmID,
+	}
+	if result.Err != nil {
+		response.ConfirmID = request.ConfirmID
+		response.Error = result.Err.Error()
+	} else {
+		response.NewIP = result.IP.String()
+	}
 
-	//Wenn etcd cluster verfügbar
-	//Nicht erzeug aus eigener IP neue IP und speicher in memcached
-	//Erzeuge Response
+	return bson.Marshal(response)
 }
 
+// Reserviert die nächste freie IP aus dem Store, siehe OpenStore
 func NextIPCache(appCtx AppContext) (net.IP, string, error) {
-	return net.ParseIP("192.168.1.1"), "", nil
+	if appCtx.Store == nil {
+		return nil, "", NoStoreError
+	}
+
+	res, err := appCtx.Store.Do(NextIPRequest, "")
+	if err != nil {
+		return nil, "", err
+	}
+	if res.Err != nil {
+		return nil, "", res.Err
+	}
+
+	return res.IP, res.ConfirmID, nil
 }
@@ -3,6 +3,7 @@ package main
 import (
 	"net"
 	"testing"
+	"time"
 
 	"gopkg.in/mgo.v2/bson"
 )
@@ -10,11 +11,55 @@ import (
 var TestIP = "192.168.0.1"
 var TestMemcachedUrl = "127.0.0.1"
 
+func makeTestIPCache(t *testing.T, ttl int) IPCacheC {
+	c, err := NewIPCache(SubnetSpec{
+		Sub:  24,
+		From: net.ParseIP(TestIP),
+		To:   net.ParseIP("192.168.0.20"),
+	}, []IPItem{}, ttl)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { close(c) })
+
+	return c
+}
+
+func sendIteRequest(t *testing.T, appCtx AppContext, req IteRequest) IteResponse {
+	payload, err := bson.Marshal(req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	result, err := HandleIteRequest(appCtx, payload)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	res := IteResponse{}
+	err = bson.Unmarshal(result, &res)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return res
+}
+
+func doTestStore(t *testing.T, s IPStore, request int, confirmID string) IPItemResponse {
+	res, err := s.Do(request, confirmID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return res
+}
+
 func Test_NewIP_WithoutEtcdNOMemecacheEntries_OK(t *testing.T) {
 
 	appCtx := AppContext{
 		LocalAddr:    net.ParseIP(TestIP),
 		MemcachedUrl: TestMemcachedUrl,
+		Store:        makeTestIPCache(t, 5),
 	}
 
 	inputC := make(chan UDPPacket, 1)
@@ -57,11 +102,74 @@ func Test_NewIP_WithoutEtcdNOMemecacheEntries_OK(t *testing.T) {
 	}
 }
 
+func Test_IteRequest_ConfirmReleaseRenew(t *testing.T) {
+	appCtx := AppContext{
+		LocalAddr: net.ParseIP(TestIP),
+		Store:     makeTestIPCache(t, 5),
+	}
+
+	offer := sendIteRequest(t, appCtx, IteRequest{Request: RequestIP})
+	if offer.Error != "" {
+		t.Fatal(offer.Error)
+	}
+	if offer.NewIP != "192.168.0.2" || offer.ServerIP != TestIP || offer.ConfirmID == "" {
+		t.Fatal("Expect offer of 192.168.0.2 was", offer)
+	}
+
+	for _, r := range []int{ConfirmIP, RenewIP, ReleaseIP} {
+		res := sendIteRequest(t, appCtx, IteRequest{Request: r, ConfirmID: offer.ConfirmID})
+		if res.Error != "" || res.NewIP != offer.NewIP {
+			t.Fatal("Expect", offer.NewIP, "for request", r, "was", res)
+		}
+	}
+
+	// Die IP wurde freigegeben
+	res := sendIteRequest(t, appCtx, IteRequest{Request: ConfirmIP, ConfirmID: offer.ConfirmID})
+	if res.Error != UnknownConfirmIDError.Error() || res.ConfirmID != offer.ConfirmID {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res)
+	}
+
+	next := sendIteRequest(t, appCtx, IteRequest{Request: RequestIP})
+	if next.NewIP != offer.NewIP {
+		t.Fatal("Expect released", offer.NewIP, "was", next.NewIP)
+	}
+}
+
+func Test_IteRequest_OfferExpires(t *testing.T) {
+	appCtx := AppContext{
+		LocalAddr: net.ParseIP(TestIP),
+		Store:     makeTestIPCache(t, 1),
+	}
+
+	offer := sendIteRequest(t, appCtx, IteRequest{Request: RequestIP})
+	time.Sleep(1100 * time.Millisecond)
+
+	res := sendIteRequest(t, appCtx, IteRequest{Request: ConfirmIP, ConfirmID: offer.ConfirmID})
+	if res.Error != UnknownConfirmIDError.Error() {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res)
+	}
+}
+
+func Test_IteRequest_Unknown(t *testing.T) {
+	payload, err := bson.Marshal(IteRequest{Request: 99})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, err = HandleIteRequest(AppContext{}, payload)
+	if err != UnknowRequestError {
+		t.Fatal("Expect", UnknowRequestError, "was", err)
+	}
+}
+
 // Test, es ext. kein etcd-Cluster und die der Memcache-DB ist noch kein Eintrag vorhanden
 func Test_NextIPMemcache_NoEntriesInDB_OK(t *testing.T) {
-	appCtx := AppContext{
+	appCtx, err := AppContext{
 		LocalAddr:    net.ParseIP(TestIP),
-		MemcachedUrl: TestMemcachedUrl,
+		MemcachedUrl: startTestMemcached(t),
+	}.OpenStore()
+	if err != nil {
+		t.Fatal(err.Error())
 	}
 
 	ip, confirmID, err := NextIPCache(appCtx)
@@ -78,3 +186,10 @@ func Test_NextIPMemcache_NoEntriesInDB_OK(t *testing.T) {
 		t.Fatal("No confirmID")
 	}
 }
+
+func Test_NextIPCache_NoStore(t *testing.T) {
+	_, _, err := NextIPCache(AppContext{LocalAddr: net.ParseIP(TestIP)})
+	if err != NoStoreError {
+		t.Fatal("Expect", NoStoreError, "was", err)
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"strings"
+)
+
+// Adressen von From bis einschließlich To
+type IPRange struct {
+	From net.IP
+	To   net.IP
+}
+
+// Die Adressen eines SubnetSpec welche vergeben werden dürfen
+type Pool struct {
+	Subnet    SubnetSpec
+	network   uint32
+	broadcast uint32
+	// 0 ohne Gateway
+	gateway uint32
+	exclude [][2]uint32
+}
+
+func NewPool(subnet SubnetSpec) (Pool, error) {
+	err := subnet.Validate()
+	if err != nil {
+		return Pool{}, err
+	}
+
+	mask := subnet.mask()
+	p := Pool{
+		Subnet:  subnet,
+		network: ipToUint(subnet.From) & mask,
+	}
+	p.broadcast = p.network | ^mask
+	if subnet.Gateway != nil {
+		p.gateway = ipToUint(subnet.Gateway)
+	}
+	for _, r := range subnet.Exclude {
+		p.exclude = append(p.exclude, [2]uint32{ipToUint(r.From), ipToUint(r.To)})
+	}
+
+	return p, nil
+}
+
+// Liest ein Subnetz wie 192.168.1.1/24. Die Adresse ist die des Servers,
+// vergeben wird wie bei SubnetFromAddr.
+func ParseSubnet(cidr string) (SubnetSpec, error) {
+	ip, network, err := net.ParseCIDR(cidr)
+	if err != nil {
+		return SubnetSpec{}, fmt.Errorf("%w: %v", InvalidSubnetError, err)
+	}
+
+	return SubnetFromAddr(ip, network.Mask)
+}
+
+// Liest komma getrennte Bereiche wie 192.168.1.10-192.168.1.20 oder
+// einzelne Adressen
+func ParseIPRanges(ranges string) ([]IPRange, error) {
+	result := []IPRange{}
+	for _, r := range strings.Split(ranges, ",") {
+		r = strings.TrimSpace(r)
+		if r == "" {
+			continue
+		}
+
+		from, to, ok := strings.Cut(r, "-")
+		if !ok {
+			to = from
+		}
+		ipRange := IPRange{
+			From: net.ParseIP(strings.TrimSpace(from)).To4(),
+			To:   net.ParseIP(strings.TrimSpace(to)).To4(),
+		}
+		if ipRange.From == nil || ipRange.To == nil {
+			return nil, fmt.Errorf("%w: %v is not an IPv4 range", InvalidSubnetError, r)
+		}
+		if ipToUint(ipRange.To) < ipToUint(ipRange.From) {
+			return nil, fmt.Errorf("%w: %v ends before it starts", InvalidSubnetError, r)
+		}
+		result = append(result, ipRange)
+	}
+
+	return result, nil
+}
+
+// Die erste und letzte IP welche vergeben werden darf
+func (p Pool) first() uint32 {
+	return ipToUint(p.Subnet.From) + 1
+}
+
+func (p Pool) last() uint32 {
+	return ipToUint(p.Subnet.To)
+}
+
+// Netz-, Broadcast- und Gateway Adresse werden nicht vergeben, ebenso die
+// ausgeschlossenen Bereiche. Adressen welche auf .0 oder .255 enden werden
+// ebenfalls ausgelassen, manche Clients halten diese für Netz- oder
+// Broadcast Adressen.
+func (p Pool) usable(ip uint32) bool {
+	last := ip & 0xff
+	if ip == p.network || ip == p.broadcast || ip == p.gateway || last == 0 || last == 255 {
+		return false
+	}
+	for _, r := range p.exclude {
+		if ip >= r[0] && ip <= r[1] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Prüft ob ip aus diesem Pool vergeben werden darf
+func (p Pool) Contains(ip net.IP) bool {
+	if ip.To4() == nil {
+		return false
+	}
+	i := ipToUint(ip)
+
+	return i >= p.first() && i <= p.last() && p.usable(i)
+}
+
+// Ruft f der Reihe nach mit jeder Adresse des Pools auf bis f false
+// zurückgibt
+func (p Pool) Each(f func(ip net.IP) bool) {
+	for ip := p.first(); ip <= p.last() && ip >= p.first(); ip++ {
+		if p.usable(ip) && !f(uintToIP(ip)) {
+			return
+		}
+	}
+}
+
+// Anzahl der Adressen im Pool
+func (p Pool) Size() int {
+	n := 0
+	p.Each(func(net.IP) bool {
+		n++
+		return true
+	})
+
+	return n
+}
+
+// Zählt die freien und die vergebenen Adressen. Adressen außerhalb des
+// Pools und doppelte werden nicht gezählt.
+func (p Pool) Count(used []net.IP) (int, int) {
+	seen := map[uint32]bool{}
+	for _, ip := range used {
+		if p.Contains(ip) {
+			seen[ipToUint(ip)] = true
+		}
+	}
+
+	return p.Size() - len(seen), len(seen)
+}
@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"testing"
+)
+
+func makeTestPool(t *testing.T, subnet SubnetSpec) Pool {
+	p, err := NewPool(subnet)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return p
+}
+
+func Test_ParseSubnet(t *testing.T) {
+	s, err := ParseSubnet("10.0.0.1/29")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Sub != 29 || !s.From.Equal(net.ParseIP("10.0.0.1")) || !s.To.Equal(net.ParseIP("10.0.0.6")) {
+		t.Fatal("Expect 10.0.0.1 - 10.0.0.6 /29 was", s)
+	}
+
+	_, err = ParseSubnet("10.0.0.1")
+	if !errors.Is(err, InvalidSubnetError) {
+		t.Fatal("Expect", InvalidSubnetError, "was", err)
+	}
+}
+
+func Test_ParseIPRanges(t *testing.T) {
+	ranges, err := ParseIPRanges("10.0.0.5-10.0.0.7, 10.0.0.9")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(ranges) != 2 || !ranges[1].From.Equal(ranges[1].To) {
+		t.Fatal("Expect two ranges, the second a single address, was", ranges)
+	}
+
+	ranges, err = ParseIPRanges("")
+	if err != nil || len(ranges) != 0 {
+		t.Fatal("Expect no ranges was", ranges, err)
+	}
+
+	for _, r := range []string{"10.0.0.7-10.0.0.5", "10.0.0.x", "::1"} {
+		_, err = ParseIPRanges(r)
+		if !errors.Is(err, InvalidSubnetError) {
+			t.Fatal("Expect", InvalidSubnetError, "for", r, "was", err)
+		}
+	}
+}
+
+func Test_SubnetSpec_Validate_Inside(t *testing.T) {
+	specs := []SubnetSpec{
+		{
+			Sub:     24,
+			From:    net.ParseIP("10.0.0.1"),
+			To:      net.ParseIP("10.0.0.20"),
+			Gateway: net.ParseIP("10.0.1.1"),
+		},
+		{
+			Sub:  24,
+			From: net.ParseIP("10.0.0.1"),
+			To:   net.ParseIP("10.0.0.20"),
+			Exclude: []IPRange{
+				{From: net.ParseIP("10.0.0.250"), To: net.ParseIP("10.0.1.5")},
+			},
+		},
+	}
+
+	for _, s := range specs {
+		_, err := NewPool(s)
+		if !errors.Is(err, InvalidSubnetError) {
+			t.Fatal("Expect", InvalidSubnetError, "was", err)
+		}
+	}
+}
+
+func Test_Pool_Each(t *testing.T) {
+	p := makeTestPool(t, SubnetSpec{
+		Sub:     16,
+		From:    net.ParseIP("192.168.1.250"),
+		To:      net.ParseIP("192.168.2.5"),
+		Gateway: net.ParseIP("192.168.1.252"),
+		Exclude: []IPRange{
+			{From: net.ParseIP("192.168.2.2"), To: net.ParseIP("192.168.2.3")},
+		},
+	})
+
+	expect := []string{
+		"192.168.1.251",
+		"192.168.1.253",
+		"192.168.1.254",
+		"192.168.2.1",
+		"192.168.2.4",
+		"192.168.2.5",
+	}
+	ips := []string{}
+	p.Each(func(ip net.IP) bool {
+		ips = append(ips, ip.String())
+		return true
+	})
+	if len(ips) != len(expect) {
+		t.Fatal("Expect", expect, "was", ips)
+	}
+	for x := range expect {
+		if ips[x] != expect[x] {
+			t.Fatal("Expect", expect, "was", ips)
+		}
+	}
+
+	if p.Size() != len(expect) {
+		t.Fatal("Expect", len(expect), "was", p.Size())
+	}
+	if p.Contains(net.ParseIP("192.168.1.252")) || p.Contains(net.ParseIP("192.168.2.0")) {
+		t.Fatal("Expect gateway and .0 not to be in the pool")
+	}
+}
+
+func Test_Pool_Count(t *testing.T) {
+	p := makeTestPool(t, SubnetSpec{
+		Sub:  29,
+		From: net.ParseIP("10.0.0.1"),
+		To:   net.ParseIP("10.0.0.6"),
+	})
+
+	used := []net.IP{
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.2"),
+		net.ParseIP("10.0.0.5"),
+		// Außerhalb des Pools
+		net.ParseIP("10.0.0.1"),
+		net.ParseIP("10.0.0.7"),
+	}
+	free, inUse := p.Count(used)
+	if free != 3 || inUse != 2 {
+		t.Fatal("Expect 3 free and 2 used was", free, inUse)
+	}
+}
+
+// Ausgeschlossene Adressen vergibt der Cache nicht
+func Test_NextIP_Exclude(t *testing.T) {
+	c, err := NewIPCache(SubnetSpec{
+		Sub:     24,
+		From:    net.ParseIP("10.0.0.1"),
+		To:      net.ParseIP("10.0.0.5"),
+		Gateway: net.ParseIP("10.0.0.2"),
+		Exclude: []IPRange{
+			{From: net.ParseIP("10.0.0.3"), To: net.ParseIP("10.0.0.4")},
+		},
+	}, []IPItem{}, 0)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(c)
+
+	res, err := c.Do(NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !res.IP.Equal(net.ParseIP("10.0.0.5")) {
+		t.Fatal("Expect 10.0.0.5 was", res.IP)
+	}
+
+	res, err = c.Do(NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Err != NoFreeIPError {
+		t.Fatal("Expect", NoFreeIPError, "was", res.Err)
+	}
+}
@@ -0,0 +1,233 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"gopkg.in/yaml.v3"
+)
+
+// Sekunden zwischen zwei Prüfungen der Reservierungsdatei
+const DefaultReloadInterval = 10
+
+var (
+	InvalidReservationError   = errors.New("Invalid reservation")
+	DuplicateReservationError = errors.New("Duplicate reservation")
+)
+
+// Der Client einer Anfrage, leere Felder sind unbekannt
+type Owner struct {
+	MAC      string `bson:",omitempty"`
+	ClientID string `bson:",omitempty"`
+	// ID des Knotens, siehe dictator.Identity
+	NodeID string `bson:",omitempty"`
+}
+
+// Die IP geht immer an den Client mit einem der Schlüssel
+type Reservation struct {
+	IP       string `yaml:"ip" toml:"ip"`
+	MAC      string `yaml:"mac" toml:"mac"`
+	ClientID string `yaml:"client_id" toml:"client_id"`
+	NodeID   string `yaml:"node_id" toml:"node_id"`
+}
+
+type ReservationFile struct {
+	Reservations []Reservation `yaml:"reservations" toml:"reservations"`
+}
+
+// Die aktuellen Reservierungen, können zur Laufzeit ersetzt werden. Ein
+// nil *Reservations enthält keine Reservierungen.
+type Reservations struct {
+	mutex *sync.RWMutex
+	// Reservierte IPs müssen aus diesem Pool stammen
+	pool Pool
+	// Schlüssel wie mac:aa:bb:cc:dd:ee:ff
+	owners map[string]net.IP
+	ips    map[string]bool
+}
+
+// pool ist der Pool des IPCache welcher die Reservierungen vergibt
+func NewReservations(pool Pool, list []Reservation) (*Reservations, error) {
+	r := &Reservations{
+		mutex: &sync.RWMutex{},
+		pool:  pool,
+	}
+
+	return r, r.Set(list)
+}
+
+func macKey(mac string) (string, error) {
+	hw, err := net.ParseMAC(mac)
+	if err != nil {
+		return "", err
+	}
+
+	return "mac:" + hw.String(), nil
+}
+
+// Die Schlüssel unter welchen owner eine Reservierung haben kann
+func (o Owner) keys() []string {
+	keys := []string{}
+	if o.NodeID != "" {
+		keys = append(keys, "node:"+o.NodeID)
+	}
+	if o.ClientID != "" {
+		keys = append(keys, "client-id:"+o.ClientID)
+	}
+	if o.MAC != "" {
+		key, err := macKey(o.MAC)
+		if err == nil {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+// Ersetzt alle Reservierungen. Bei einem Fehler bleiben die bisherigen
+// erhalten.
+func (r *Reservations) Set(list []Reservation) error {
+	owners := map[string]net.IP{}
+	ips := map[string]bool{}
+	for _, res := range list {
+		ip := net.ParseIP(res.IP).To4()
+		if ip == nil {
+			return fmt.Errorf("%w: %q is not an IPv4 address", InvalidReservationError, res.IP)
+		}
+		if !r.pool.Contains(ip) {
+			return fmt.Errorf("%w: %v is not in the pool", InvalidReservationError, ip)
+		}
+		if ips[ip.String()] {
+			return fmt.Errorf("%w: %v", DuplicateReservationError, ip)
+		}
+		ips[ip.String()] = true
+
+		owner := Owner{NodeID: res.NodeID, ClientID: res.ClientID}
+		if res.MAC != "" {
+			_, err := macKey(res.MAC)
+			if err != nil {
+				return fmt.Errorf("%w: %v: %v", InvalidReservationError, ip, err)
+			}
+			owner.MAC = res.MAC
+		}
+		keys := owner.keys()
+		if len(keys) == 0 {
+			return fmt.Errorf("%w: %v needs a mac, client_id or node_id", InvalidReservationError, ip)
+		}
+		for _, key := range keys {
+			if _, ok := owners[key]; ok {
+				return fmt.Errorf("%w: %v", DuplicateReservationError, key)
+			}
+			owners[key] = ip
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.owners = owners
+	r.ips = ips
+
+	return nil
+}
+
+// Die reservierte IP von owner
+func (r *Reservations) Lookup(owner Owner) (net.IP, bool) {
+	if r == nil {
+		return nil, false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+	for _, key := range owner.keys() {
+		ip, ok := r.owners[key]
+		if ok {
+			return ip, true
+		}
+	}
+
+	return nil, false
+}
+
+// Prüft ob ip reserviert ist und nicht frei vergeben werden darf
+func (r *Reservations) Reserved(ip net.IP) bool {
+	if r == nil {
+		return false
+	}
+
+	r.mutex.RLock()
+	defer r.mutex.RUnlock()
+
+	return r.ips[ip.String()]
+}
+
+// Liest die Reservierungen aus einer .yaml, .yml oder .toml Datei
+func LoadReservations(path string) ([]Reservation, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	file := ReservationFile{}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		err = yaml.Unmarshal(data, &file)
+	case ".toml":
+		_, err = toml.Decode(string(data), &file)
+	default:
+		return nil, fmt.Errorf("%v: unknown reservation format, use .yaml, .yml or .toml", path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%v: %w", path, err)
+	}
+
+	return file.Reservations, nil
+}
+
+// Lädt die Datei path neu sobald sich diese ändert bis done geschlossen
+// wird. Eine fehlerhafte Datei wird geloggt, die bisherigen
+// Reservierungen bleiben dann erhalten.
+func WatchReservations(path string, r *Reservations, interval time.Duration, done <-chan struct{}) {
+	modTime := time.Time{}
+	info, err := os.Stat(path)
+	if err == nil {
+		modTime = info.ModTime()
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		info, err := os.Stat(path)
+		if err != nil {
+			log.Println("ERROR:", err.Error())
+			continue
+		}
+		if info.ModTime().Equal(modTime) {
+			continue
+		}
+		modTime = info.ModTime()
+
+		list, err := LoadReservations(path)
+		if err == nil {
+			err = r.Set(list)
+		}
+		if err != nil {
+			log.Println("ERROR:", err.Error())
+			continue
+		}
+		log.Println("Reload reservations from", path)
+	}
+}
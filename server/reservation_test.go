@@ -0,0 +1,309 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// Das Netz der Caches mit Reservierungen
+var testReservedSubnet = SubnetSpec{
+	Sub:  24,
+	From: net.ParseIP("192.168.0.1"),
+	To:   net.ParseIP("192.168.0.4"),
+}
+
+// Reservierungen im Pool von testReservedSubnet
+func makeTestReservations(t *testing.T, list []Reservation) *Reservations {
+	pool, err := NewPool(testReservedSubnet)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r, err := NewReservations(pool, list)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return r
+}
+
+func makeTestReservedCache(t *testing.T, r *Reservations) IPCacheC {
+	c, err := NewIPCacheWithConfig(IPCacheConfig{
+		Subnet:       testReservedSubnet,
+		TTL:          5,
+		Reservations: r,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { close(c) })
+
+	return c
+}
+
+func Test_Reservations_Lookup(t *testing.T) {
+	r := makeTestReservations(t, []Reservation{
+		{IP: "192.168.0.2", MAC: "AA:BB:CC:DD:EE:FF"},
+		{IP: "192.168.0.3", ClientID: "box", NodeID: "node-3"},
+	})
+
+	ip, ok := r.Lookup(Owner{MAC: "aa:bb:cc:dd:ee:ff"})
+	if !ok || !ip.Equal(net.ParseIP("192.168.0.2")) {
+		t.Fatal("Expect 192.168.0.2 was", ip)
+	}
+	ip, ok = r.Lookup(Owner{NodeID: "node-3"})
+	if !ok || !ip.Equal(net.ParseIP("192.168.0.3")) {
+		t.Fatal("Expect 192.168.0.3 was", ip)
+	}
+	_, ok = r.Lookup(Owner{ClientID: "other"})
+	if ok {
+		t.Fatal("Expect no reservation for other")
+	}
+	if !r.Reserved(net.ParseIP("192.168.0.3")) || r.Reserved(net.ParseIP("192.168.0.4")) {
+		t.Fatal("Expect only 192.168.0.2 and 192.168.0.3 to be reserved")
+	}
+
+	var empty *Reservations
+	_, ok = empty.Lookup(Owner{NodeID: "node-3"})
+	if ok || empty.Reserved(net.ParseIP("192.168.0.3")) {
+		t.Fatal("Expect nil reservations to be empty")
+	}
+}
+
+func Test_Reservations_Invalid(t *testing.T) {
+	lists := map[error][]Reservation{
+		InvalidReservationError: {
+			{IP: "192.168.0.4", NodeID: "a"},
+			{IP: "192.168.0.5", NodeID: "c"},
+		},
+		DuplicateReservationError: {
+			{IP: "192.168.0.2", NodeID: "a"},
+			{IP: "192.168.0.3", NodeID: "a"},
+		},
+	}
+
+	for expect, list := range lists {
+		r := makeTestReservations(t, []Reservation{{IP: "192.168.0.4", NodeID: "b"}})
+		err := r.Set(list)
+		if !errors.Is(err, expect) {
+			t.Fatal("Expect", expect, "was", err)
+		}
+		// Die bisherigen Reservierungen bleiben erhalten
+		_, ok := r.Lookup(Owner{NodeID: "b"})
+		if !ok {
+			t.Fatal("Expect the old reservations after", err)
+		}
+	}
+
+	invalid := []Reservation{
+		{IP: "192.168.0.x", NodeID: "a"},
+		{IP: "192.168.0.2"},
+		{IP: "192.168.0.2", MAC: "xx"},
+		// Die Adresse des Servers und außerhalb des Subnetzes
+		{IP: "192.168.0.1", NodeID: "a"},
+		{IP: "10.0.0.2", NodeID: "a"},
+	}
+	for _, res := range invalid {
+		err := makeTestReservations(t, nil).Set([]Reservation{res})
+		if !errors.Is(err, InvalidReservationError) {
+			t.Fatal("Expect", InvalidReservationError, "was", err)
+		}
+	}
+}
+
+// Der Owner erhält immer seine IP, andere Clients nie
+func Test_NextIP_Reserved(t *testing.T) {
+	owner := Owner{MAC: "aa:bb:cc:dd:ee:ff"}
+	c := makeTestReservedCache(t, makeTestReservations(t, []Reservation{
+		{IP: "192.168.0.2", MAC: owner.MAC},
+	}))
+
+	for x := 0; x < 2; x++ {
+		res, err := c.DoFor(owner, NextIPRequest, "")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !res.IP.Equal(net.ParseIP("192.168.0.2")) {
+			t.Fatal("Expect 192.168.0.2 was", res.IP)
+		}
+	}
+
+	expect := []string{"192.168.0.3", "192.168.0.4"}
+	for _, ip := range expect {
+		res, err := c.DoFor(Owner{MAC: "11:22:33:44:55:66"}, NextIPRequest, "")
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if !res.IP.Equal(net.ParseIP(ip)) {
+			t.Fatal("Expect", ip, "was", res.IP)
+		}
+	}
+
+	res, err := c.Do(NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Err != NoFreeIPError {
+		t.Fatal("Expect", NoFreeIPError, "was", res.Err)
+	}
+}
+
+// Eine an einen anderen Client bestätigte IP wird dem Owner erst nach der
+// Freigabe vergeben
+func Test_NextIP_ReservedInUse(t *testing.T) {
+	owner := Owner{NodeID: "node-2"}
+	r := makeTestReservations(t, nil)
+	c := makeTestReservedCache(t, r)
+
+	other, err := c.DoFor(Owner{NodeID: "other"}, NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	_, err = c.Do(ConfirmIPRequest, other.ConfirmID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	err = r.Set([]Reservation{{IP: other.IP.String(), NodeID: owner.NodeID}})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res, err := c.DoFor(owner, NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if !errors.Is(res.Err, ReservedIPInUseError) {
+		t.Fatal("Expect", ReservedIPInUseError, "was", res.Err)
+	}
+	res, err = c.Do(ReadIPRequest, other.ConfirmID)
+	if err != nil || res.Err != nil {
+		t.Fatal("Expect the lease of the other client to be kept was", res.Err, err)
+	}
+
+	_, err = c.Do(ReleaseIPRequest, other.ConfirmID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res, err = c.DoFor(owner, NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Err != nil || !res.IP.Equal(other.IP) {
+		t.Fatal("Expect", other.IP, "was", res)
+	}
+
+	// Die eigene bestätigte IP erhält der Owner erneut
+	_, err = c.Do(ConfirmIPRequest, res.ConfirmID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	res, err = c.DoFor(owner, NextIPRequest, "")
+	if err != nil || res.Err != nil || !res.IP.Equal(other.IP) {
+		t.Fatal("Expect", other.IP, "was", res, err)
+	}
+}
+
+func Test_IteRequest_Reserved(t *testing.T) {
+	appCtx := AppContext{
+		LocalAddr: net.ParseIP("192.168.0.1"),
+		Store: makeTestReservedCache(t, makeTestReservations(t, []Reservation{
+			{IP: "192.168.0.4", NodeID: "node-4"},
+		})),
+	}
+
+	res := sendIteRequest(t, appCtx, IteRequest{
+		Request: RequestIP,
+		Owner:   Owner{NodeID: "node-4"},
+	})
+	if res.NewIP != "192.168.0.4" {
+		t.Fatal("Expect 192.168.0.4 was", res.NewIP)
+	}
+
+	res = sendIteRequest(t, appCtx, IteRequest{
+		Request:   ConfirmIP,
+		ConfirmID: res.ConfirmID,
+	})
+	if res.Error != "" || res.NewIP != "192.168.0.4" {
+		t.Fatal("Expect confirmed 192.168.0.4 was", res)
+	}
+}
+
+func Test_NewStore_ReservationsNeedCache(t *testing.T) {
+	_, err := NewStore(StoreConfig{
+		Memcached:    "127.0.0.1",
+		Reservations: makeTestReservations(t, []Reservation{}),
+	})
+	if err != ReservationsNeedCacheError {
+		t.Fatal("Expect", ReservationsNeedCacheError, "was", err)
+	}
+}
+
+func Test_WatchReservations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reservations.yaml")
+	err := os.WriteFile(path, []byte("reservations:\n  - ip: 192.168.0.2\n    node_id: a\n"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	list, err := LoadReservations(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	r := makeTestReservations(t, list)
+
+	done := make(chan struct{})
+	defer close(done)
+	go WatchReservations(path, r, 10*time.Millisecond, done)
+
+	// Eine fehlerhafte Datei ändert nichts
+	err = os.WriteFile(path, []byte("reservations:\n  - ip: nope\n"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(time.Second))
+	time.Sleep(50 * time.Millisecond)
+	_, ok := r.Lookup(Owner{NodeID: "a"})
+	if !ok {
+		t.Fatal("Expect the reservation of a to be kept")
+	}
+
+	err = os.WriteFile(path, []byte("reservations:\n  - ip: 192.168.0.3\n    node_id: b\n"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	os.Chtimes(path, time.Now(), time.Now().Add(2*time.Second))
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		ip, ok := r.Lookup(Owner{NodeID: "b"})
+		if ok && ip.Equal(net.ParseIP("192.168.0.3")) {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expect the reservation of b after the reload")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	_, ok = r.Lookup(Owner{NodeID: "a"})
+	if ok {
+		t.Fatal("Expect the reservation of a to be removed")
+	}
+}
+
+func Test_LoadReservations_TOML(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "reservations.toml")
+	err := os.WriteFile(path, []byte("[[reservations]]\nip = \"192.168.0.2\"\nmac = \"aa:bb:cc:dd:ee:ff\"\n"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	list, err := LoadReservations(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(list) != 1 || list[0].MAC != "aa:bb:cc:dd:ee:ff" {
+		t.Fatal("Expect one reservation was", list)
+	}
+}
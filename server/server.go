@@ -1,36 +1,105 @@
 package main
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"net"
-	"strconv"
-
-	"gopkg.in/mgo.v2/bson"
+	"time"
 )
 
+// Größer als jede IteRequest
+const MaxPacketSize = 2048
+
 type (
 	IPServer struct {
-		Addr string
-	}
-	IPResponse struct {
-		NewIP string
+		Addr   string
+		AppCtx AppContext
 	}
 )
 
 func main() {
 	serverIP := flag.String("ip", "255.255.255.255", "Server IP")
 	serverPort := flag.Int("port", 0, "Server Port")
+	from := flag.String("from", "192.168.1.1", "Address of the server, addresses after it are handed out")
+	to := flag.String("to", "192.168.1.254", "Last address handed out")
+	sub := flag.Int("sub", 24, "Prefix length of the subnet")
+	cidr := flag.String("cidr", "", "Server address and prefix like 192.168.1.1/24, replaces -from, -to and -sub")
+	gateway := flag.String("gateway", "", "Gateway address, never handed out")
+	exclude := flag.String("exclude", "", "Comma separated addresses or ranges like 192.168.1.10-192.168.1.20, never handed out")
+	ttl := flag.Int("ttl", DefaultTTL, "Seconds an offer waits for its confirmation")
+	lease := flag.Int("lease", 0, "Seconds a confirmed address is valid without renewal, 0 means forever")
+	etcd := flag.String("etcd", "", "Comma separated etcd endpoints, without the pool is local to this server")
+	etcdPrefix := flag.String("etcd-prefix", "/ite", "Prefix of the etcd keys")
+	memcached := flag.String("memcached", "", "Comma separated memcached servers, used without -etcd")
+	stateDir := flag.String("state-dir", "", "Directory to persist the local pool across restarts, not used with -etcd or -memcached")
+	reservations := flag.String("reservations", "", "File with reserved addresses, .yaml, .yml or .toml, reloaded on change")
+	reload := flag.Int("reload", DefaultReloadInterval, "Seconds between checks of the reservation file")
 	flag.Parse()
 
 	if (*serverIP != "") && (*serverPort != 0) {
+		subnet := SubnetSpec{
+			Sub:  *sub,
+			From: net.ParseIP(*from),
+			To:   net.ParseIP(*to),
+		}
+		var err error
+		if *cidr != "" {
+			subnet, err = ParseSubnet(*cidr)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+		}
+		if *gateway != "" {
+			subnet.Gateway = net.ParseIP(*gateway)
+		}
+		subnet.Exclude, err = ParseIPRanges(*exclude)
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
+		var reserved *Reservations
+		if *reservations != "" {
+			list, err := LoadReservations(*reservations)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			pool, err := NewPool(subnet)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			reserved, err = NewReservations(pool, list)
+			if err != nil {
+				log.Fatal(err.Error())
+			}
+			go WatchReservations(*reservations, reserved, time.Duration(*reload)*time.Second, nil)
+		}
+
+		store, err := NewStore(StoreConfig{
+			Etcd:         *etcd,
+			EtcdPrefix:   *etcdPrefix,
+			Memcached:    *memcached,
+			Subnet:       subnet,
+			TTL:          *ttl,
+			Lease:        *lease,
+			Reservations: reserved,
+			StateDir:     *stateDir,
+		})
+		if err != nil {
+			log.Fatal(err.Error())
+		}
+
 		s := IPServer{
 			Addr: fmt.Sprintf(
 				"%v:%v",
 				*serverIP,
 				*serverPort,
 			),
+			AppCtx: AppContext{
+				LocalAddr: subnet.From,
+				Store:     store,
+			},
 		}
 		log.Fatal(s.Run())
 	}
@@ -40,47 +109,47 @@ func (s IPServer) Run() error {
 	log.Println("Run server - ", s.Addr)
 	addr, err := net.ResolveUDPAddr("udp", s.Addr)
 	if err != nil {
-		log.Fatal(err.Error())
+		return err
 	}
 
 	conn, err := net.ListenUDP("udp", addr)
 	if err != nil {
-		log.Fatal(err.Error())
+		return err
 	}
+	defer conn.Close()
+
+	return s.Serve(conn)
+}
 
-	for x := 1; ; x++ {
-		request := make([]byte, 2)
-		_, rAddr, err := conn.ReadFromUDP(request)
+// Beantwortet die Anfragen auf conn bis diese geschlossen wird. Eine
+// fehlerhafte Anfrage beendet den Server nicht.
+func (s IPServer) Serve(conn *net.UDPConn) error {
+	request := make([]byte, MaxPacketSize)
+	for {
+		n, rAddr, err := conn.ReadFromUDP(request)
+		if errors.Is(err, net.ErrClosed) {
+			return err
+		}
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Println("ERROR:", err.Error())
+			continue
 		}
 		log.Println(
 			"Receive IP Request From",
 			rAddr,
 		)
 
-		tmpIP := "192.168.1." + strconv.Itoa(x)
-		ipResponse := IPResponse{
-			NewIP: tmpIP,
-		}
-		response, err := bson.Marshal(ipResponse)
+		response, err := HandleIteRequest(s.AppCtx, request[:n])
 		if err != nil {
-			log.Println("ERROR:", err.Error())
+			log.Println("ERROR:", rAddr, err.Error())
 			continue
 		}
 
-		_, err = conn.WriteToUDP(
-			response,
-			&net.UDPAddr{
-				IP:   net.ParseIP("255.255.255.255"),
-				Port: 12346,
-			},
-		)
+		_, err = conn.WriteToUDP(response, rAddr)
 		if err != nil {
-			log.Fatal(err.Error())
+			log.Println("ERROR:", rAddr, err.Error())
+			continue
 		}
-		log.Println("Response with IP", ipResponse.NewIP)
+		log.Println("Response to", rAddr)
 	}
-
-	return nil
 }
@@ -2,149 +2,121 @@ package main
 
 import (
 	"errors"
-	"gopkg.in/mgo.v2/bson"
-	"log"
 	"net"
-	"os"
-	"os/exec"
-	"strconv"
 	"testing"
 	"time"
-)
 
-const (
-	IPServerIP   = "255.255.255.255"
-	IPServerPort = 12345
-	IPClientIP   = "255.255.255.255"
-	IPClientPort = 12346
+	"gopkg.in/mgo.v2/bson"
 )
 
-/* Tester Funktion
- * Sind alle Ausgegeben IP Adressen unterschiedlich
- * und werden alle Request beantwortet.
- */
-func Tester(numberOfClients int, boom <-chan time.Time, testerResult chan error, testerIPs chan string) {
-	ips := make(map[string]int)
-	for {
-		select {
-		case ip := <-testerIPs:
-			log.Println("Tester receive", ip)
-			_, ok := ips[ip]
-			if ok {
-				testerResult <- errors.New("Got same IP")
-			}
-
-			ips[ip] = 1
-			log.Println("Collected IPs", strconv.Itoa(len(ips)))
-
-			if len(ips) == numberOfClients {
-				testerResult <- nil
-			}
-		case <-boom:
-			testerResult <- errors.New("You are to slow!")
-		}
+func makeTestServer(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.ParseIP("127.0.0.1")})
+	if err != nil {
+		t.Fatal(err.Error())
 	}
 
-	testerResult <- nil
-}
-
-func AskForIPs(numberOfClients int) {
-	log.Println("Ask for IPs")
-	for x := 0; x < numberOfClients; x++ {
-
-		go func(n int) {
-			rAddr := net.UDPAddr{
-				IP:   net.ParseIP(IPServerIP),
-				Port: IPServerPort,
-			}
-
-			conn, err := net.DialUDP("udp", nil, &rAddr)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-			defer conn.Close()
-			log.Println("Ask For IP", n)
-			_, err = conn.Write([]byte("1"))
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-		}(x)
-
+	s := IPServer{
+		AppCtx: AppContext{
+			LocalAddr: net.ParseIP(TestIP),
+			Store:     makeTestIPCache(t, 5),
+		},
 	}
+	done := make(chan error, 1)
+	go func() {
+		done <- s.Serve(conn)
+	}()
+
+	t.Cleanup(func() {
+		conn.Close()
+		err := <-done
+		if !errors.Is(err, net.ErrClosed) {
+			t.Error("Expect", net.ErrClosed, "was", err)
+		}
+	})
+
+	return conn
 }
 
-func IPReceivers(numberOfClients int, tester chan string) {
-	log.Println("Start IPReceivers")
-	addr := net.UDPAddr{
-		IP:   net.ParseIP(IPClientIP),
-		Port: IPClientPort,
-	}
-	conn, err := net.ListenUDP("udp", &addr)
+// Sendet payload an den Server und gibt dessen Antwort zurück
+func AskForIP(server *net.UDPConn, payloads ...[]byte) (IteResponse, error) {
+	conn, err := net.DialUDP("udp", nil, server.LocalAddr().(*net.UDPAddr))
 	if err != nil {
-		log.Fatal(err.Error())
+		return IteResponse{}, err
 	}
-	for x := 0; x < numberOfClients; x++ {
-		response := make([]byte, 2048)
-		_, rAddr, err := conn.ReadFromUDP(response)
+	defer conn.Close()
+
+	for _, p := range payloads {
+		_, err = conn.Write(p)
 		if err != nil {
-			log.Fatal(err.Error())
+			return IteResponse{}, err
 		}
-		go func(n int, rAddr *net.UDPAddr, response []byte) {
-			log.Println("Handle IP response", n)
-			if err != nil {
-				log.Fatal(err.Error())
-			}
-			ipResponse := IPResponse{}
-			err := bson.Unmarshal(response, &ipResponse)
-			if err != nil {
-				log.Println("ERROR BSON:", err.Error())
-				return
-			}
-			log.Println(
-				"IP Response value",
-				rAddr,
-				ipResponse.NewIP,
-			)
-			tester <- ipResponse.NewIP
-		}(x, rAddr, response)
 	}
+
+	conn.SetReadDeadline(time.Now().Add(3 * time.Second))
+	response := make([]byte, MaxPacketSize)
+	n, err := conn.Read(response)
+	if err != nil {
+		return IteResponse{}, err
+	}
+
+	res := IteResponse{}
+	err = bson.Unmarshal(response[:n], &res)
+	return res, err
 }
 
+/* Sind alle ausgegebenen IP Adressen unterschiedlich
+ * und werden alle Requests beantwortet.
+ */
 func Test_GetIPFromIPServer(t *testing.T) {
-
 	numberOfClients := 10
+	server := makeTestServer(t)
 
-	cmd := exec.Command(
-		"./ite-server",
-		"-ip", IPServerIP,
-		"-port", strconv.Itoa(IPServerPort),
-	)
-
-	cmd.Stdout = os.Stdout
-	cmd.Stderr = os.Stderr
-
-	if err := cmd.Start(); err != nil {
+	req, err := bson.Marshal(IteRequest{Request: RequestIP})
+	if err != nil {
 		t.Fatal(err.Error())
 	}
-	defer cmd.Wait()
-	defer cmd.Process.Kill()
 
-	log.Println(cmd.Process.Pid)
-	time.Sleep(500 * time.Millisecond)
-
-	boom := time.After(3 * time.Second)
-	testerResult := make(chan error)
-	testerIPs := make(chan string, numberOfClients)
-
-	go Tester(numberOfClients, boom, testerResult, testerIPs)
+	type result struct {
+		res IteResponse
+		err error
+	}
+	results := make(chan result, numberOfClients)
+	for x := 0; x < numberOfClients; x++ {
+		go func() {
+			res, err := AskForIP(server, req)
+			results <- result{res, err}
+		}()
+	}
 
-	go IPReceivers(numberOfClients, testerIPs)
+	ips := map[string]bool{}
+	for x := 0; x < numberOfClients; x++ {
+		r := <-results
+		if r.err != nil {
+			t.Fatal(r.err.Error())
+		}
+		if r.res.Error != "" {
+			t.Fatal(r.res.Error)
+		}
+		if ips[r.res.NewIP] {
+			t.Fatal("Got same IP", r.res.NewIP)
+		}
+		ips[r.res.NewIP] = true
+	}
+}
 
-	go AskForIPs(numberOfClients)
+func Test_IPServer_SurvivesBadRequest(t *testing.T) {
+	server := makeTestServer(t)
 
-	err := <-testerResult
+	req, err := bson.Marshal(IteRequest{Request: RequestIP})
 	if err != nil {
 		t.Fatal(err.Error())
 	}
 
+	res, err := AskForIP(server, []byte("1"), req)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.NewIP != "192.168.0.2" {
+		t.Fatal("Expect 192.168.0.2 was", res.NewIP)
+	}
 }
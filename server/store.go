@@ -0,0 +1,114 @@
+package main
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// Vergibt die IPs. Ohne Cluster genügt IPCache, mehrere Server teilen sich
+// einen Pool über EtcdStore oder MemcacheStore.
+type IPStore interface {
+	// Führt einen der IPCache Requests aus. Fehler der Vergabe, z.B. eine
+	// unbekannte ConfirmID, stehen in IPItemResponse.Err.
+	Do(request int, confirmID string) (IPItemResponse, error)
+}
+
+// Ein IPStore welcher Reservierungen kennt, bisher nur IPCache
+type ReservingStore interface {
+	IPStore
+	// Wie Do, owner erhält bei NextIPRequest seine reservierte IP
+	DoFor(owner Owner, request int, confirmID string) (IPItemResponse, error)
+}
+
+var (
+	ReservationsNeedCacheError = errors.New("Reservations are only supported without etcd and memcached")
+	StateDirNeedsCacheError    = errors.New("A state dir is only supported without etcd and memcached")
+)
+
+type StoreConfig struct {
+	// Komma getrennte etcd Endpoints
+	Etcd       string
+	EtcdPrefix string
+	// Komma getrennte memcached Server, ohne Port wird 11211 verwendet
+	Memcached string
+	Subnet    SubnetSpec
+	// Sekunden wie bei IPCacheConfig
+	TTL   int
+	Lease int
+	// Optional, siehe IPCacheConfig
+	Reservations *Reservations
+	// Optional, der IPCache übersteht mit einem WAL in diesem Verzeichnis
+	// einen Neustart
+	StateDir string
+}
+
+// Wird unter den ConfirmIDs in etcd und memcached gespeichert
+type storeItem struct {
+	IP        string
+	Confirmed bool
+}
+
+// Ohne etcd oder memcached vergibt ein IPCache die IPs nur für diesen
+// Server
+func NewStore(c StoreConfig) (IPStore, error) {
+	if c.Reservations != nil && (c.Etcd != "" || c.Memcached != "") {
+		return nil, ReservationsNeedCacheError
+	}
+	if c.StateDir != "" && (c.Etcd != "" || c.Memcached != "") {
+		return nil, StateDirNeedsCacheError
+	}
+
+	switch {
+	case c.Etcd != "":
+		client, err := clientv3.New(clientv3.Config{
+			Endpoints:   strings.Split(c.Etcd, ","),
+			DialTimeout: DefaultEtcdTimeout,
+		})
+		if err != nil {
+			return nil, err
+		}
+
+		s, err := NewEtcdStore(client, c.EtcdPrefix, c.Subnet, c.TTL, c.Lease)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		return s, nil
+	case c.Memcached != "":
+		client := memcache.New(memcacheServers(c.Memcached)...)
+		s, err := NewMemcacheStore(client, DefaultMemcachePrefix, c.Subnet, c.TTL, c.Lease)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+
+	config := IPCacheConfig{
+		Subnet:       c.Subnet,
+		Init:         []IPItem{},
+		TTL:          c.TTL,
+		Lease:        c.Lease,
+		Reservations: c.Reservations,
+	}
+	if c.StateDir != "" {
+		wal, items, err := OpenWAL(c.StateDir)
+		if err != nil {
+			return nil, err
+		}
+		config.Init = items
+		config.Log = wal
+	}
+
+	cache, err := NewIPCacheWithConfig(config)
+	if err != nil {
+		if config.Log != nil {
+			config.Log.Close()
+		}
+		return nil, err
+	}
+
+	return cache, nil
+}
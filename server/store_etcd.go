@@ -0,0 +1,300 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net"
+	"time"
+
+	"go.etcd.io/etcd/api/v3/v3rpc/rpctypes"
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const DefaultEtcdTimeout = 5 * time.Second
+
+// Teilt einen Pool zwischen mehreren Servern. Jede vergebene IP belegt
+// zwei Schlüssel, <Prefix>/ips/<IP> mit der ConfirmID und
+// <Prefix>/ids/<ConfirmID> mit dem storeItem. Beide hängen an einer Lease,
+// läuft diese ab ist die IP wieder frei.
+type EtcdStore struct {
+	Client *clientv3.Client
+	Prefix string
+	Pool   Pool
+	// Sekunden wie bei IPCacheConfig, 0 läuft nie ab
+	TTL   int
+	Lease int
+	// Maximale Dauer einer Anfrage an etcd
+	Timeout time.Duration
+}
+
+// Ein gelesener Eintrag unter <Prefix>/ids/
+type etcdEntry struct {
+	storeItem
+	rev   int64
+	lease clientv3.LeaseID
+}
+
+func NewEtcdStore(client *clientv3.Client, prefix string, subnet SubnetSpec, ttl, lease int) (*EtcdStore, error) {
+	pool, err := NewPool(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &EtcdStore{
+		Client:  client,
+		Prefix:  prefix,
+		Pool:    pool,
+		TTL:     ttl,
+		Lease:   lease,
+		Timeout: DefaultEtcdTimeout,
+	}, nil
+}
+
+func (s *EtcdStore) Do(request int, confirmID string) (IPItemResponse, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), s.Timeout)
+	defer cancel()
+
+	switch request {
+	case NextIPRequest:
+		return s.next(ctx)
+	case ReadIPRequest:
+		return s.read(ctx, confirmID)
+	case ConfirmIPRequest:
+		return s.confirm(ctx, confirmID)
+	case ReleaseIPRequest:
+		return s.release(ctx, confirmID)
+	case RenewIPRequest:
+		return s.renew(ctx, confirmID)
+	}
+
+	return IPItemResponse{}, UnknowRequestError
+}
+
+func (s *EtcdStore) ipKey(ip string) string {
+	return s.Prefix + "/ips/" + ip
+}
+
+func (s *EtcdStore) idKey(confirmID string) string {
+	return s.Prefix + "/ids/" + confirmID
+}
+
+// Ohne TTL hängen die Schlüssel an keiner Lease
+func (s *EtcdStore) grant(ctx context.Context, sec int) (clientv3.LeaseID, error) {
+	if sec == 0 {
+		return clientv3.NoLease, nil
+	}
+
+	lease, err := s.Client.Grant(ctx, int64(sec))
+	if err != nil {
+		return clientv3.NoLease, err
+	}
+
+	return lease.ID, nil
+}
+
+func (s *EtcdStore) revoke(ctx context.Context, lease clientv3.LeaseID) {
+	if lease == clientv3.NoLease {
+		return
+	}
+
+	// Ohne Revoke läuft die Lease einfach ab
+	s.Client.Revoke(ctx, lease)
+}
+
+// Versucht die freien IPs der Reihe nach zu belegen. Eine IP welche ein
+// anderer Server gleichzeitig vergibt, schlägt im Vergleich fehl.
+func (s *EtcdStore) next(ctx context.Context) (IPItemResponse, error) {
+	resp, err := s.Client.Get(ctx, s.ipKey(""), clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return IPItemResponse{}, err
+	}
+	used := map[string]bool{}
+	for _, kv := range resp.Kvs {
+		used[string(kv.Key)] = true
+	}
+
+	lease, err := s.grant(ctx, s.TTL)
+	if err != nil {
+		return IPItemResponse{}, err
+	}
+
+	for ip := s.Pool.first(); ip <= s.Pool.last(); ip++ {
+		key := s.ipKey(uintToIP(ip).String())
+		if !s.Pool.usable(ip) || used[key] {
+			continue
+		}
+
+		id, err := NewConfirmID()
+		if err != nil {
+			s.revoke(ctx, lease)
+			return IPItemResponse{}, err
+		}
+		item, err := bson.Marshal(storeItem{IP: uintToIP(ip).String()})
+		if err != nil {
+			s.revoke(ctx, lease)
+			return IPItemResponse{}, err
+		}
+
+		txn, err := s.Client.Txn(ctx).
+			If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+			Then(
+				clientv3.OpPut(key, id, clientv3.WithLease(lease)),
+				clientv3.OpPut(s.idKey(id), string(item), clientv3.WithLease(lease)),
+			).
+			Commit()
+		if err != nil {
+			s.revoke(ctx, lease)
+			return IPItemResponse{}, err
+		}
+		if !txn.Succeeded {
+			continue
+		}
+
+		return IPItemResponse{
+			IP:        uintToIP(ip),
+			ConfirmID: id,
+		}, nil
+	}
+
+	s.revoke(ctx, lease)
+	return IPItemResponse{Err: NoFreeIPError}, nil
+}
+
+// Liest den Eintrag zur ConfirmID, UnknownConfirmIDError falls es diesen
+// nicht gibt
+func (s *EtcdStore) get(ctx context.Context, confirmID string) (etcdEntry, error) {
+	resp, err := s.Client.Get(ctx, s.idKey(confirmID))
+	if err != nil {
+		return etcdEntry{}, err
+	}
+	if len(resp.Kvs) == 0 {
+		return etcdEntry{}, UnknownConfirmIDError
+	}
+
+	kv := resp.Kvs[0]
+	entry := etcdEntry{
+		rev:   kv.ModRevision,
+		lease: clientv3.LeaseID(kv.Lease),
+	}
+	err = bson.Unmarshal(kv.Value, &entry.storeItem)
+
+	return entry, err
+}
+
+// Eine unbekannte ConfirmID ist ein Fehler der Vergabe, kein Fehler von
+// etcd
+func etcdResult(err error) (IPItemResponse, error) {
+	if errors.Is(err, UnknownConfirmIDError) {
+		return IPItemResponse{Err: err}, nil
+	}
+
+	return IPItemResponse{}, err
+}
+
+func (s *EtcdStore) read(ctx context.Context, confirmID string) (IPItemResponse, error) {
+	entry, err := s.get(ctx, confirmID)
+	if err != nil {
+		return etcdResult(err)
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(entry.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+// Hängt beide Schlüssel an eine neue Lease mit der Lease Time
+func (s *EtcdStore) confirm(ctx context.Context, confirmID string) (IPItemResponse, error) {
+	entry, err := s.get(ctx, confirmID)
+	if err != nil {
+		return etcdResult(err)
+	}
+
+	lease, err := s.grant(ctx, s.Lease)
+	if err != nil {
+		return IPItemResponse{}, err
+	}
+	entry.Confirmed = true
+	value, err := bson.Marshal(entry.storeItem)
+	if err != nil {
+		s.revoke(ctx, lease)
+		return IPItemResponse{}, err
+	}
+
+	idKey := s.idKey(confirmID)
+	txn, err := s.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(idKey), "=", entry.rev)).
+		Then(
+			clientv3.OpPut(s.ipKey(entry.IP), confirmID, clientv3.WithLease(lease)),
+			clientv3.OpPut(idKey, string(value), clientv3.WithLease(lease)),
+		).
+		Commit()
+	if err != nil {
+		s.revoke(ctx, lease)
+		return IPItemResponse{}, err
+	}
+	// Abgelaufen oder freigegeben seit get
+	if !txn.Succeeded {
+		s.revoke(ctx, lease)
+		return IPItemResponse{Err: UnknownConfirmIDError}, nil
+	}
+	s.revoke(ctx, entry.lease)
+
+	return IPItemResponse{
+		IP:        net.ParseIP(entry.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+func (s *EtcdStore) release(ctx context.Context, confirmID string) (IPItemResponse, error) {
+	entry, err := s.get(ctx, confirmID)
+	if err != nil {
+		return etcdResult(err)
+	}
+
+	idKey := s.idKey(confirmID)
+	txn, err := s.Client.Txn(ctx).
+		If(clientv3.Compare(clientv3.ModRevision(idKey), "=", entry.rev)).
+		Then(
+			clientv3.OpDelete(s.ipKey(entry.IP)),
+			clientv3.OpDelete(idKey),
+		).
+		Commit()
+	if err != nil {
+		return IPItemResponse{}, err
+	}
+	if !txn.Succeeded {
+		return IPItemResponse{Err: UnknownConfirmIDError}, nil
+	}
+	s.revoke(ctx, entry.lease)
+
+	return IPItemResponse{
+		IP:        net.ParseIP(entry.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+// Die Lease wurde mit der TTL oder der Lease Time erzeugt, KeepAlive setzt
+// diese wieder auf den vollen Wert
+func (s *EtcdStore) renew(ctx context.Context, confirmID string) (IPItemResponse, error) {
+	entry, err := s.get(ctx, confirmID)
+	if err != nil {
+		return etcdResult(err)
+	}
+
+	if entry.lease != clientv3.NoLease {
+		_, err := s.Client.KeepAliveOnce(ctx, entry.lease)
+		if errors.Is(err, rpctypes.ErrLeaseNotFound) {
+			return IPItemResponse{Err: UnknownConfirmIDError}, nil
+		}
+		if err != nil {
+			return IPItemResponse{}, err
+		}
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(entry.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
@@ -0,0 +1,181 @@
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	clientv3 "go.etcd.io/etcd/client/v3"
+	"go.etcd.io/etcd/server/v3/embed"
+)
+
+func freeTestURL(t *testing.T) url.URL {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer l.Close()
+
+	return url.URL{Scheme: "http", Host: l.Addr().String()}
+}
+
+// Startet einen etcd Server im Prozess und gibt einen Client für diesen
+// zurück
+func startTestEtcd(t *testing.T) *clientv3.Client {
+	cfg := embed.NewConfig()
+	cfg.Dir = t.TempDir()
+	cfg.LogLevel = "error"
+	clientURL := freeTestURL(t)
+	peerURL := freeTestURL(t)
+	cfg.ListenClientUrls = []url.URL{clientURL}
+	cfg.AdvertiseClientUrls = []url.URL{clientURL}
+	cfg.ListenPeerUrls = []url.URL{peerURL}
+	cfg.AdvertisePeerUrls = []url.URL{peerURL}
+	cfg.InitialCluster = cfg.InitialClusterFromName(cfg.Name)
+
+	e, err := embed.StartEtcd(cfg)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(e.Close)
+
+	select {
+	case <-e.Server.ReadyNotify():
+	case <-time.After(10 * time.Second):
+		t.Fatal("etcd is not ready")
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   []string{clientURL.String()},
+		DialTimeout: 5 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { client.Close() })
+
+	return client
+}
+
+func makeTestEtcdStore(t *testing.T, client *clientv3.Client, ttl, lease int) *EtcdStore {
+	s, err := NewEtcdStore(client, "/test", SubnetSpec{
+		Sub:  24,
+		From: net.ParseIP("192.168.0.1"),
+		To:   net.ParseIP("192.168.0.20"),
+	}, ttl, lease)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return s
+}
+
+// Mehrere Server vergeben gleichzeitig aus einem Pool
+func Test_EtcdStore_NoCollisions(t *testing.T) {
+	client := startTestEtcd(t)
+	stores := []*EtcdStore{
+		makeTestEtcdStore(t, client, 30, 0),
+		makeTestEtcdStore(t, client, 30, 0),
+		makeTestEtcdStore(t, client, 30, 0),
+	}
+
+	// 192.168.0.2 - 192.168.0.20
+	free := 19
+	results := make(chan IPItemResponse, free+len(stores))
+	errs := make(chan error, free+len(stores))
+	for x := 0; x < free+len(stores); x++ {
+		go func(s *EtcdStore) {
+			res, err := s.Do(NextIPRequest, "")
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- res
+		}(stores[x%len(stores)])
+	}
+
+	ips := map[string]bool{}
+	full := 0
+	for x := 0; x < free+len(stores); x++ {
+		select {
+		case err := <-errs:
+			t.Fatal(err.Error())
+		case res := <-results:
+			if res.Err == NoFreeIPError {
+				full++
+				continue
+			}
+			if res.Err != nil {
+				t.Fatal(res.Err.Error())
+			}
+			if ips[res.IP.String()] {
+				t.Fatal("Got same IP", res.IP)
+			}
+			ips[res.IP.String()] = true
+		}
+	}
+
+	if len(ips) != free || full != len(stores) {
+		t.Fatal(fmt.Sprintf("Expect %v IPs and %v full pools, was %v and %v", free, len(stores), len(ips), full))
+	}
+}
+
+func Test_EtcdStore_ConfirmReleaseRenew(t *testing.T) {
+	client := startTestEtcd(t)
+	s := makeTestEtcdStore(t, client, 30, 60)
+
+	offer := doTestStore(t, s, NextIPRequest, "")
+	if offer.Err != nil {
+		t.Fatal(offer.Err.Error())
+	}
+	if !offer.IP.Equal(net.ParseIP("192.168.0.2")) {
+		t.Fatal("Expect 192.168.0.2 was", offer.IP)
+	}
+
+	for _, r := range []int{ReadIPRequest, ConfirmIPRequest, RenewIPRequest, ReleaseIPRequest} {
+		res := doTestStore(t, s, r, offer.ConfirmID)
+		if res.Err != nil || !res.IP.Equal(offer.IP) {
+			t.Fatal("Expect", offer.IP, "for request", r, "was", res)
+		}
+	}
+
+	res := doTestStore(t, s, ConfirmIPRequest, offer.ConfirmID)
+	if res.Err != UnknownConfirmIDError {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res.Err)
+	}
+
+	next := doTestStore(t, s, NextIPRequest, "")
+	if !next.IP.Equal(offer.IP) {
+		t.Fatal("Expect released", offer.IP, "was", next.IP)
+	}
+}
+
+func Test_EtcdStore_OfferExpires(t *testing.T) {
+	client := startTestEtcd(t)
+	s := makeTestEtcdStore(t, client, 1, 0)
+
+	offer := doTestStore(t, s, NextIPRequest, "")
+	if offer.Err != nil {
+		t.Fatal(offer.Err.Error())
+	}
+
+	// etcd rundet kurze Leases auf
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		res := doTestStore(t, s, ReadIPRequest, offer.ConfirmID)
+		if res.Err == UnknownConfirmIDError {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("Expect the offer to expire")
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	next := doTestStore(t, s, NextIPRequest, "")
+	if !next.IP.Equal(offer.IP) {
+		t.Fatal("Expect expired", offer.IP, "was", next.IP)
+	}
+}
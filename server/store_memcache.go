@@ -0,0 +1,274 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"strings"
+
+	"github.com/bradfitz/gomemcache/memcache"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	DefaultMemcachePrefix = "ite:"
+	DefaultMemcachePort   = "11211"
+
+	// Ein negativer Ablauf löscht den Schlüssel sofort, mit cas nur falls
+	// dieser noch unverändert ist
+	memcacheExpireNow = -1
+)
+
+// Teilt einen Pool über memcached. Jede vergebene IP belegt die Schlüssel
+// <Prefix>ip:<IP> mit der ConfirmID und <Prefix>id:<ConfirmID> mit dem
+// storeItem. Beide laufen wie bei IPCache nach TTL oder Lease Sekunden ab.
+// Belegt wird mit add, geändert nur mit cas, so vergeben zwei Server nie
+// die gleiche IP.
+type MemcacheStore struct {
+	Client *memcache.Client
+	Prefix string
+	Pool   Pool
+	TTL    int
+	Lease  int
+}
+
+func NewMemcacheStore(client *memcache.Client, prefix string, subnet SubnetSpec, ttl, lease int) (*MemcacheStore, error) {
+	pool, err := NewPool(subnet)
+	if err != nil {
+		return nil, err
+	}
+
+	return &MemcacheStore{
+		Client: client,
+		Prefix: prefix,
+		Pool:   pool,
+		TTL:    ttl,
+		Lease:  lease,
+	}, nil
+}
+
+// Ergänzt den Standardport
+func memcacheServers(servers string) []string {
+	addrs := []string{}
+	for _, s := range strings.Split(servers, ",") {
+		s = strings.TrimSpace(s)
+		if _, _, err := net.SplitHostPort(s); err != nil {
+			s = net.JoinHostPort(s, DefaultMemcachePort)
+		}
+		addrs = append(addrs, s)
+	}
+
+	return addrs
+}
+
+func (s *MemcacheStore) Do(request int, confirmID string) (IPItemResponse, error) {
+	switch request {
+	case NextIPRequest:
+		return s.next()
+	case ReadIPRequest:
+		return s.read(confirmID)
+	case ConfirmIPRequest:
+		return s.confirm(confirmID)
+	case ReleaseIPRequest:
+		return s.release(confirmID)
+	case RenewIPRequest:
+		return s.renew(confirmID)
+	}
+
+	return IPItemResponse{}, UnknowRequestError
+}
+
+func (s *MemcacheStore) ipKey(ip string) string {
+	return s.Prefix + "ip:" + ip
+}
+
+func (s *MemcacheStore) idKey(confirmID string) string {
+	return s.Prefix + "id:" + confirmID
+}
+
+// memcached kann die belegten IPs nicht auflisten, deshalb wird jede freie
+// IP der Reihe nach mit add versucht
+func (s *MemcacheStore) next() (IPItemResponse, error) {
+	for ip := s.Pool.first(); ip <= s.Pool.last(); ip++ {
+		if !s.Pool.usable(ip) {
+			continue
+		}
+
+		id, err := NewConfirmID()
+		if err != nil {
+			return IPItemResponse{}, err
+		}
+		addr := uintToIP(ip).String()
+		err = s.Client.Add(&memcache.Item{
+			Key:        s.ipKey(addr),
+			Value:      []byte(id),
+			Expiration: int32(s.TTL),
+		})
+		if errors.Is(err, memcache.ErrNotStored) {
+			continue
+		}
+		if err != nil {
+			return IPItemResponse{}, err
+		}
+
+		value, err := bson.Marshal(storeItem{IP: addr})
+		if err == nil {
+			err = s.Client.Add(&memcache.Item{
+				Key:        s.idKey(id),
+				Value:      value,
+				Expiration: int32(s.TTL),
+			})
+		}
+		if err != nil {
+			s.Client.Delete(s.ipKey(addr))
+			return IPItemResponse{}, err
+		}
+
+		return IPItemResponse{
+			IP:        uintToIP(ip),
+			ConfirmID: id,
+		}, nil
+	}
+
+	return IPItemResponse{Err: NoFreeIPError}, nil
+}
+
+// Liest beide Schlüssel der ConfirmID. Gehört die IP inzwischen einer
+// anderen ConfirmID, gibt es die ConfirmID nicht mehr.
+func (s *MemcacheStore) get(confirmID string) (storeItem, *memcache.Item, *memcache.Item, error) {
+	idItem, err := s.Client.Get(s.idKey(confirmID))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return storeItem{}, nil, nil, UnknownConfirmIDError
+	}
+	if err != nil {
+		return storeItem{}, nil, nil, err
+	}
+
+	item := storeItem{}
+	err = bson.Unmarshal(idItem.Value, &item)
+	if err != nil {
+		return storeItem{}, nil, nil, err
+	}
+
+	ipItem, err := s.Client.Get(s.ipKey(item.IP))
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return storeItem{}, nil, nil, UnknownConfirmIDError
+	}
+	if err != nil {
+		return storeItem{}, nil, nil, err
+	}
+	if string(ipItem.Value) != confirmID {
+		return storeItem{}, nil, nil, UnknownConfirmIDError
+	}
+
+	return item, idItem, ipItem, nil
+}
+
+// Ein fehlgeschlagenes cas bedeutet die IP ist abgelaufen oder wurde
+// freigegeben
+func memcacheResult(err error) (IPItemResponse, error) {
+	if errors.Is(err, UnknownConfirmIDError) {
+		return IPItemResponse{Err: err}, nil
+	}
+	if errors.Is(err, memcache.ErrCASConflict) || errors.Is(err, memcache.ErrCacheMiss) || errors.Is(err, memcache.ErrNotStored) {
+		return IPItemResponse{Err: UnknownConfirmIDError}, nil
+	}
+
+	return IPItemResponse{}, err
+}
+
+func (s *MemcacheStore) read(confirmID string) (IPItemResponse, error) {
+	item, _, _, err := s.get(confirmID)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(item.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+// Setzt den Ablauf beider Schlüssel auf expire. Die IP zuerst, damit eine
+// inzwischen anders vergebene IP nicht verlängert wird.
+func (s *MemcacheStore) update(item storeItem, idItem, ipItem *memcache.Item, expire int) error {
+	ipItem.Expiration = int32(expire)
+	err := s.Client.CompareAndSwap(ipItem)
+	if err != nil {
+		return err
+	}
+
+	value, err := bson.Marshal(item)
+	if err != nil {
+		return err
+	}
+	idItem.Value = value
+	idItem.Expiration = int32(expire)
+	err = s.Client.CompareAndSwap(idItem)
+	if err != nil {
+		// Die ConfirmID gibt es nicht mehr, die IP wieder freigeben
+		s.Client.Touch(ipItem.Key, memcacheExpireNow)
+	}
+
+	return err
+}
+
+func (s *MemcacheStore) confirm(confirmID string) (IPItemResponse, error) {
+	item, idItem, ipItem, err := s.get(confirmID)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	item.Confirmed = true
+	err = s.update(item, idItem, ipItem, s.Lease)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(item.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+func (s *MemcacheStore) renew(confirmID string) (IPItemResponse, error) {
+	item, idItem, ipItem, err := s.get(confirmID)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	expire := s.TTL
+	if item.Confirmed {
+		expire = s.Lease
+	}
+	err = s.update(item, idItem, ipItem, expire)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(item.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
+
+func (s *MemcacheStore) release(confirmID string) (IPItemResponse, error) {
+	item, idItem, ipItem, err := s.get(confirmID)
+	if err != nil {
+		return memcacheResult(err)
+	}
+
+	ipItem.Expiration = memcacheExpireNow
+	err = s.Client.CompareAndSwap(ipItem)
+	if err != nil {
+		return memcacheResult(err)
+	}
+	err = s.Client.Delete(idItem.Key)
+	if err != nil && !errors.Is(err, memcache.ErrCacheMiss) {
+		return IPItemResponse{}, err
+	}
+
+	return IPItemResponse{
+		IP:        net.ParseIP(item.IP),
+		ConfirmID: confirmID,
+	}, nil
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bradfitz/gomemcache/memcache"
+)
+
+type (
+	// Versteht die Befehle des memcached Textprotokolls welche
+	// MemcacheStore verwendet
+	testMemcached struct {
+		mutex *sync.Mutex
+		items map[string]testMemcachedItem
+		cas   uint64
+	}
+
+	testMemcachedItem struct {
+		value  []byte
+		flags  uint32
+		cas    uint64
+		expire time.Time
+	}
+)
+
+// Startet den Server und gibt dessen Adresse zurück
+func startTestMemcached(t *testing.T) string {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { l.Close() })
+
+	m := &testMemcached{
+		mutex: &sync.Mutex{},
+		items: map[string]testMemcachedItem{},
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go m.serve(conn)
+		}
+	}()
+
+	return l.Addr().String()
+}
+
+func (m *testMemcached) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	w := bufio.NewWriter(conn)
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+
+		switch fields[0] {
+		case "get", "gets":
+			for _, key := range fields[1:] {
+				item, ok := m.get(key)
+				if ok {
+					fmt.Fprintf(w, "VALUE %s %d %d %d\r\n%s\r\n", key, item.flags, len(item.value), item.cas, item.value)
+				}
+			}
+			w.WriteString("END\r\n")
+		case "set", "add", "cas":
+			if len(fields) < 5 {
+				w.WriteString("ERROR\r\n")
+				break
+			}
+			flags, _ := strconv.ParseUint(fields[2], 10, 32)
+			exp, _ := strconv.Atoi(fields[3])
+			size, _ := strconv.Atoi(fields[4])
+			cas := uint64(0)
+			if fields[0] == "cas" && len(fields) > 5 {
+				cas, _ = strconv.ParseUint(fields[5], 10, 64)
+			}
+			value := make([]byte, size+2)
+			_, err := io.ReadFull(r, value)
+			if err != nil {
+				return
+			}
+			w.WriteString(m.store(fields[0], fields[1], value[:size], uint32(flags), exp, cas))
+		case "delete":
+			w.WriteString(m.delete(fields[1]))
+		case "touch":
+			exp, _ := strconv.Atoi(fields[2])
+			w.WriteString(m.touch(fields[1], exp))
+		default:
+			w.WriteString("ERROR\r\n")
+		}
+
+		err = w.Flush()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func testMemcachedExpire(exp int) time.Time {
+	if exp == 0 {
+		return time.Time{}
+	}
+
+	return time.Now().Add(time.Duration(exp) * time.Second)
+}
+
+func (m *testMemcached) get(key string) (testMemcachedItem, bool) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	item, ok := m.items[key]
+	if ok && !item.expire.IsZero() && !item.expire.After(time.Now()) {
+		delete(m.items, key)
+		return testMemcachedItem{}, false
+	}
+
+	return item, ok
+}
+
+func (m *testMemcached) store(cmd, key string, value []byte, flags uint32, exp int, cas uint64) string {
+	old, ok := m.get(key)
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	switch {
+	case cmd == "add" && ok:
+		return "NOT_STORED\r\n"
+	case cmd == "cas" && !ok:
+		return "NOT_FOUND\r\n"
+	case cmd == "cas" && old.cas != cas:
+		return "EXISTS\r\n"
+	}
+
+	m.cas++
+	m.items[key] = testMemcachedItem{
+		value:  value,
+		flags:  flags,
+		cas:    m.cas,
+		expire: testMemcachedExpire(exp),
+	}
+
+	return "STORED\r\n"
+}
+
+func (m *testMemcached) delete(key string) string {
+	_, ok := m.get(key)
+	if !ok {
+		return "NOT_FOUND\r\n"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	delete(m.items, key)
+
+	return "DELETED\r\n"
+}
+
+func (m *testMemcached) touch(key string, exp int) string {
+	item, ok := m.get(key)
+	if !ok {
+		return "NOT_FOUND\r\n"
+	}
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	item.expire = testMemcachedExpire(exp)
+	m.items[key] = item
+
+	return "TOUCHED\r\n"
+}
+
+func makeTestMemcacheStore(t *testing.T, addr string, ttl, lease int) *MemcacheStore {
+	subnet, err := SubnetFromAddr(net.ParseIP("192.168.0.1"), net.CIDRMask(24, 32))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	s, err := NewMemcacheStore(memcache.New(addr), DefaultMemcachePrefix, subnet, ttl, lease)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	return s
+}
+
+func Test_SubnetFromAddr(t *testing.T) {
+	s, err := SubnetFromAddr(net.ParseIP("10.1.2.3"), net.CIDRMask(16, 32))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Sub != 16 || !s.To.Equal(net.ParseIP("10.1.255.254")) {
+		t.Fatal("Expect 10.1.2.3 - 10.1.255.254 /16 was", s)
+	}
+
+	s, err = SubnetFromAddr(net.ParseIP("192.168.0.1"), nil)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if s.Sub != 24 || !s.To.Equal(net.ParseIP("192.168.0.254")) {
+		t.Fatal("Expect the default mask /24 was", s)
+	}
+}
+
+// Mehrere Server vergeben gleichzeitig aus einem Pool
+func Test_MemcacheStore_NoCollisions(t *testing.T) {
+	addr := startTestMemcached(t)
+	stores := []*MemcacheStore{
+		makeTestMemcacheStore(t, addr, 30, 0),
+		makeTestMemcacheStore(t, addr, 30, 0),
+	}
+
+	n := 40
+	results := make(chan IPItemResponse, n)
+	errs := make(chan error, n)
+	for x := 0; x < n; x++ {
+		go func(s *MemcacheStore) {
+			res, err := s.Do(NextIPRequest, "")
+			if err != nil {
+				errs <- err
+				return
+			}
+			results <- res
+		}(stores[x%len(stores)])
+	}
+
+	ips := map[string]bool{}
+	for x := 0; x < n; x++ {
+		select {
+		case err := <-errs:
+			t.Fatal(err.Error())
+		case res := <-results:
+			if res.Err != nil {
+				t.Fatal(res.Err.Error())
+			}
+			if ips[res.IP.String()] {
+				t.Fatal("Got same IP", res.IP)
+			}
+			ips[res.IP.String()] = true
+		}
+	}
+}
+
+func Test_MemcacheStore_ConfirmReleaseRenew(t *testing.T) {
+	s := makeTestMemcacheStore(t, startTestMemcached(t), 30, 60)
+
+	offer := doTestStore(t, s, NextIPRequest, "")
+	if offer.Err != nil {
+		t.Fatal(offer.Err.Error())
+	}
+
+	for _, r := range []int{ReadIPRequest, ConfirmIPRequest, RenewIPRequest, ReleaseIPRequest} {
+		res := doTestStore(t, s, r, offer.ConfirmID)
+		if res.Err != nil || !res.IP.Equal(offer.IP) {
+			t.Fatal("Expect", offer.IP, "for request", r, "was", res)
+		}
+	}
+
+	res := doTestStore(t, s, ConfirmIPRequest, offer.ConfirmID)
+	if res.Err != UnknownConfirmIDError {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res.Err)
+	}
+
+	next := doTestStore(t, s, NextIPRequest, "")
+	if !next.IP.Equal(offer.IP) {
+		t.Fatal("Expect released", offer.IP, "was", next.IP)
+	}
+}
+
+func Test_MemcacheStore_OfferExpires(t *testing.T) {
+	s := makeTestMemcacheStore(t, startTestMemcached(t), 1, 0)
+
+	offer := doTestStore(t, s, NextIPRequest, "")
+	confirmed := doTestStore(t, s, NextIPRequest, "")
+	res := doTestStore(t, s, ConfirmIPRequest, confirmed.ConfirmID)
+	if res.Err != nil {
+		t.Fatal(res.Err.Error())
+	}
+
+	time.Sleep(1100 * time.Millisecond)
+
+	res = doTestStore(t, s, ReadIPRequest, offer.ConfirmID)
+	if res.Err != UnknownConfirmIDError {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res.Err)
+	}
+	res = doTestStore(t, s, ReadIPRequest, confirmed.ConfirmID)
+	if res.Err != nil {
+		t.Fatal(res.Err.Error())
+	}
+
+	next := doTestStore(t, s, NextIPRequest, "")
+	if !next.IP.Equal(offer.IP) {
+		t.Fatal("Expect expired", offer.IP, "was", next.IP)
+	}
+}
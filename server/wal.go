@@ -0,0 +1,354 @@
+package main
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	// Nach so vielen Einträgen im Log wird ein Snapshot geschrieben
+	DefaultSnapshotEvery = 1000
+
+	walFile      = "ipcache.wal"
+	snapshotFile = "ipcache.snapshot"
+	// Länge und CRC32 des Inhalts
+	walHeaderSize = 8
+	// Größer als jeder Snapshot eines /8
+	maxWALRecordSize = 1 << 30
+)
+
+const (
+	walPut = iota + 1
+	walDelete
+)
+
+var (
+	// Der Eintrag wurde nicht vollständig geschrieben
+	TornRecordError       = errors.New("Torn log record")
+	CorruptSnapshotError  = errors.New("Corrupt IP cache snapshot")
+	UnknownLogRecordError = errors.New("Unknown log record")
+)
+
+// Speichert die Änderungen eines IPCache, siehe IPCacheConfig
+type IPCacheLog interface {
+	Put(confirmID string, item IPItem) error
+	Delete(confirmID string) error
+	Close() error
+}
+
+type walRecord struct {
+	Seq       uint64
+	Op        int
+	ConfirmID string
+	Item      IPItem
+}
+
+// Der Stand aller Einträge bis einschließlich Seq
+type walSnapshot struct {
+	Seq   uint64
+	Items []IPItem
+}
+
+// Hängt jede Änderung an die Datei ipcache.wal in Dir an. Alle
+// SnapshotEvery Einträge wird der ganze Stand nach ipcache.snapshot
+// geschrieben und das Log geleert.
+type WAL struct {
+	Dir           string
+	SnapshotEvery int
+	file          *os.File
+	seq           uint64
+	records       int
+	// Der Stand nach allen Einträgen, für den nächsten Snapshot
+	items IPCache
+}
+
+// Öffnet das Log in dir und gibt die noch gültigen Einträge zurück, diese
+// gehen an InitIPCache. Ein unvollständiger letzter Eintrag wird
+// abgeschnitten.
+func OpenWAL(dir string) (*WAL, []IPItem, error) {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	w := &WAL{
+		Dir:           dir,
+		SnapshotEvery: DefaultSnapshotEvery,
+		items:         IPCache{},
+	}
+	err = w.readSnapshot()
+	if err != nil {
+		return nil, nil, err
+	}
+	err = w.replay()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Abgelaufene Einträge verwerfen und mit einem leeren Log beginnen
+	CleanIPCache(&w.items)
+	err = w.snapshot()
+	if err != nil {
+		w.file.Close()
+		return nil, nil, err
+	}
+
+	items := []IPItem{}
+	for id, item := range w.items {
+		item.ConfirmID = id
+		items = append(items, item)
+	}
+
+	return w, items, nil
+}
+
+func readWALRecord(r io.Reader, v interface{}) (int, error) {
+	header := make([]byte, walHeaderSize)
+	_, err := io.ReadFull(r, header)
+	if err == io.EOF {
+		return 0, err
+	}
+	if err != nil {
+		return 0, TornRecordError
+	}
+
+	size := binary.BigEndian.Uint32(header)
+	if size > maxWALRecordSize {
+		return 0, TornRecordError
+	}
+	payload := make([]byte, size)
+	_, err = io.ReadFull(r, payload)
+	if err != nil {
+		return 0, TornRecordError
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:]) {
+		return 0, TornRecordError
+	}
+
+	err = bson.Unmarshal(payload, v)
+	if err != nil {
+		return 0, TornRecordError
+	}
+
+	return walHeaderSize + int(size), nil
+}
+
+// Schreibt den Eintrag mit einem Write, ein Absturz hinterlässt höchstens
+// einen unvollständigen letzten Eintrag
+func writeWALRecord(w io.Writer, v interface{}) error {
+	payload, err := bson.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	buf := make([]byte, walHeaderSize, walHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(buf, uint32(len(payload)))
+	binary.BigEndian.PutUint32(buf[4:], crc32.ChecksumIEEE(payload))
+	_, err = w.Write(append(buf, payload...))
+
+	return err
+}
+
+func (w *WAL) readSnapshot() error {
+	f, err := os.Open(filepath.Join(w.Dir, snapshotFile))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	// Der Snapshot wird erst nach dem Schreiben umbenannt, ein Fehler ist
+	// kein Absturz beim Schreiben
+	snapshot := walSnapshot{}
+	_, err = readWALRecord(f, &snapshot)
+	if err != nil {
+		return fmt.Errorf("%w: %v", CorruptSnapshotError, err)
+	}
+
+	w.seq = snapshot.Seq
+	for _, item := range snapshot.Items {
+		w.items[item.ConfirmID] = item
+	}
+
+	return nil
+}
+
+// Wendet alle Einträge nach dem Snapshot an und schneidet das Log nach
+// dem letzten vollständigen Eintrag ab
+func (w *WAL) replay() error {
+	path := filepath.Join(w.Dir, walFile)
+	f, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	offset := int64(0)
+	for {
+		rec := walRecord{}
+		n, err := readWALRecord(f, &rec)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			log.Println("ERROR:", path, "truncated after", offset, "bytes:", err.Error())
+			err = f.Truncate(offset)
+			if err != nil {
+				f.Close()
+				return err
+			}
+			break
+		}
+		offset += int64(n)
+
+		// Bereits im Snapshot enthalten
+		if rec.Seq <= w.seq {
+			continue
+		}
+		err = w.apply(rec)
+		if err != nil {
+			f.Close()
+			return err
+		}
+	}
+
+	w.file = f
+	return nil
+}
+
+// Eine IP gehört immer nur einer ConfirmID, ein neuer Eintrag mit der
+// gleichen IP ersetzt den alten
+func (w *WAL) apply(rec walRecord) error {
+	switch rec.Op {
+	case walPut:
+		for id, item := range w.items {
+			if id != rec.ConfirmID && item.IP.Equal(rec.Item.IP) {
+				delete(w.items, id)
+			}
+		}
+		w.items[rec.ConfirmID] = rec.Item
+	case walDelete:
+		delete(w.items, rec.ConfirmID)
+	default:
+		return fmt.Errorf("%w: %v", UnknownLogRecordError, rec.Op)
+	}
+	w.seq = rec.Seq
+
+	return nil
+}
+
+func (w *WAL) append(rec walRecord) error {
+	rec.Seq = w.seq + 1
+	err := writeWALRecord(w.file, rec)
+	if err != nil {
+		return err
+	}
+	err = w.file.Sync()
+	if err != nil {
+		return err
+	}
+	err = w.apply(rec)
+	if err != nil {
+		return err
+	}
+
+	w.records++
+	if w.SnapshotEvery > 0 && w.records >= w.SnapshotEvery {
+		return w.snapshot()
+	}
+
+	return nil
+}
+
+func (w *WAL) Put(confirmID string, item IPItem) error {
+	item.ConfirmID = confirmID
+	old, ok := w.items[confirmID]
+	if ok && old.IP.Equal(item.IP) && old.Expire.Equal(item.Expire) && old.Confirmed == item.Confirmed {
+		return nil
+	}
+
+	return w.append(walRecord{
+		Op:        walPut,
+		ConfirmID: confirmID,
+		Item:      item,
+	})
+}
+
+func (w *WAL) Delete(confirmID string) error {
+	if _, ok := w.items[confirmID]; !ok {
+		return nil
+	}
+
+	return w.append(walRecord{
+		Op:        walDelete,
+		ConfirmID: confirmID,
+	})
+}
+
+// Schreibt den ganzen Stand in eine neue Datei und ersetzt damit den
+// alten Snapshot, danach wird das Log geleert. Stürzt der Server
+// dazwischen ab, überspringt replay die Einträge anhand von Seq.
+func (w *WAL) snapshot() error {
+	snapshot := walSnapshot{
+		Seq:   w.seq,
+		Items: []IPItem{},
+	}
+	for id, item := range w.items {
+		item.ConfirmID = id
+		snapshot.Items = append(snapshot.Items, item)
+	}
+
+	path := filepath.Join(w.Dir, snapshotFile)
+	f, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	err = writeWALRecord(f, snapshot)
+	if err == nil {
+		err = f.Sync()
+	}
+	if err != nil {
+		f.Close()
+		return err
+	}
+	err = f.Close()
+	if err != nil {
+		return err
+	}
+	err = os.Rename(path+".tmp", path)
+	if err != nil {
+		return err
+	}
+	syncDir(w.Dir)
+
+	err = w.file.Truncate(0)
+	if err != nil {
+		return err
+	}
+	w.records = 0
+
+	return w.file.Sync()
+}
+
+// Damit das Umbenennen einen Absturz übersteht
+func syncDir(dir string) {
+	d, err := os.Open(dir)
+	if err != nil {
+		return
+	}
+	d.Sync()
+	d.Close()
+}
+
+func (w *WAL) Close() error {
+	return w.file.Close()
+}
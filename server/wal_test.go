@@ -0,0 +1,342 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+func openTestWAL(t *testing.T, dir string) (*WAL, map[string]IPItem) {
+	w, items, err := OpenWAL(dir)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	t.Cleanup(func() { w.Close() })
+
+	byID := map[string]IPItem{}
+	for _, item := range items {
+		byID[item.ConfirmID] = item
+	}
+
+	return w, byID
+}
+
+func putTestWAL(t *testing.T, w *WAL, confirmID, ip string, confirmed bool) {
+	err := w.Put(confirmID, IPItem{
+		IP:        net.ParseIP(ip),
+		Confirmed: confirmed,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+}
+
+func Test_WAL_Replay(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := openTestWAL(t, dir)
+	putTestWAL(t, w, "a", "192.168.0.2", false)
+	putTestWAL(t, w, "b", "192.168.0.3", false)
+	putTestWAL(t, w, "a", "192.168.0.2", true)
+	err := w.Delete("b")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w.Close()
+
+	_, items := openTestWAL(t, dir)
+	if len(items) != 1 {
+		t.Fatal("Expect 1 item was", items)
+	}
+	a := items["a"]
+	if !a.IP.Equal(net.ParseIP("192.168.0.2")) || !a.Confirmed || !a.Expire.IsZero() {
+		t.Fatal("Expect confirmed 192.168.0.2 without expiry was", a)
+	}
+}
+
+// Ein beim Absturz nur teilweise geschriebener Eintrag wird verworfen
+func Test_WAL_TornTail(t *testing.T) {
+	tails := map[string]func([]byte) []byte{
+		"short header": func(last []byte) []byte { return last[:3] },
+		"short payload": func(last []byte) []byte {
+			return last[:len(last)-2]
+		},
+		"bad checksum": func(last []byte) []byte {
+			torn := append([]byte{}, last...)
+			torn[len(torn)-1] ^= 0xff
+			return torn
+		},
+	}
+
+	for name, tail := range tails {
+		dir := t.TempDir()
+		w, _ := openTestWAL(t, dir)
+		w.SnapshotEvery = 0
+		putTestWAL(t, w, "a", "192.168.0.2", true)
+		path := filepath.Join(dir, walFile)
+		info, err := os.Stat(path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		putTestWAL(t, w, "b", "192.168.0.3", true)
+		w.Close()
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		good := data[:info.Size()]
+		err = os.WriteFile(path, append(good, tail(data[info.Size():])...), 0644)
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+
+		w, items := openTestWAL(t, dir)
+		if len(items) != 1 || !items["a"].IP.Equal(net.ParseIP("192.168.0.2")) {
+			t.Fatal(name, "Expect only a was", items)
+		}
+
+		// Das Log ist danach wieder beschreibbar
+		putTestWAL(t, w, "c", "192.168.0.4", true)
+		w.Close()
+		_, items = openTestWAL(t, dir)
+		if len(items) != 2 {
+			t.Fatal(name, "Expect a and c was", items)
+		}
+	}
+}
+
+func Test_WAL_Snapshot(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := openTestWAL(t, dir)
+	w.SnapshotEvery = 3
+	for x := 2; x < 10; x++ {
+		putTestWAL(t, w, string(rune('a'+x)), uintToIP(ipToUint(net.ParseIP("192.168.0.0"))+uint32(x)).String(), false)
+	}
+	info, err := os.Stat(filepath.Join(dir, walFile))
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if w.records != 2 || info.Size() == 0 {
+		t.Fatal("Expect 2 records after the last snapshot was", w.records, info.Size())
+	}
+	w.Close()
+
+	_, items := openTestWAL(t, dir)
+	if len(items) != 8 {
+		t.Fatal("Expect 8 items was", len(items))
+	}
+}
+
+// Eine neue ConfirmID für eine IP ersetzt die alte, wie bei reservedIP
+func Test_WAL_SameIP(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := openTestWAL(t, dir)
+	putTestWAL(t, w, "a", "192.168.0.2", false)
+	putTestWAL(t, w, "b", "192.168.0.2", false)
+	w.Close()
+
+	_, items := openTestWAL(t, dir)
+	if _, ok := items["b"]; !ok || len(items) != 1 {
+		t.Fatal("Expect only b was", items)
+	}
+}
+
+func Test_WAL_DropsExpired(t *testing.T) {
+	dir := t.TempDir()
+	w, _ := openTestWAL(t, dir)
+	err := w.Put("a", IPItem{
+		IP:     net.ParseIP("192.168.0.2"),
+		Expire: time.Now().Add(-time.Second),
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	w.Close()
+
+	_, items := openTestWAL(t, dir)
+	if len(items) != 0 {
+		t.Fatal("Expect no items was", items)
+	}
+}
+
+func Test_WAL_CorruptSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	err := os.WriteFile(filepath.Join(dir, snapshotFile), []byte("nope"), 0644)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+
+	_, _, err = OpenWAL(dir)
+	if err == nil {
+		t.Fatal("Expect", CorruptSnapshotError)
+	}
+}
+
+// Ein Log welches nach Bedarf fehlschlägt
+type failingLog struct {
+	Err error
+}
+
+func (l *failingLog) Put(confirmID string, item IPItem) error {
+	return l.Err
+}
+
+func (l *failingLog) Delete(confirmID string) error {
+	return l.Err
+}
+
+func (l *failingLog) Close() error {
+	return nil
+}
+
+// Kann eine Änderung nicht geschrieben werden bleibt der Cache unverändert
+func Test_IPCache_LogBeforeApply(t *testing.T) {
+	l := &failingLog{Err: errors.New("disk full")}
+	c, err := NewIPCacheWithConfig(IPCacheConfig{
+		Subnet: SubnetSpec{
+			Sub:  24,
+			From: net.ParseIP(TestIP),
+			To:   net.ParseIP("192.168.0.20"),
+		},
+		TTL: 5,
+		Log: l,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(c)
+
+	_, err = c.Do(NextIPRequest, "")
+	if err != l.Err {
+		t.Fatal("Expect", l.Err, "was", err)
+	}
+
+	l.Err = nil
+	offer, err := c.Do(NextIPRequest, "")
+	if err != nil || !offer.IP.Equal(net.ParseIP("192.168.0.2")) {
+		t.Fatal("Expect 192.168.0.2 was", offer, err)
+	}
+
+	l.Err = errors.New("disk full")
+	_, err = c.Do(ReleaseIPRequest, offer.ConfirmID)
+	if err != l.Err {
+		t.Fatal("Expect", l.Err, "was", err)
+	}
+	res, err := c.Do(ReadIPRequest, offer.ConfirmID)
+	if err != nil || res.Err != nil {
+		t.Fatal("Expect the offer to be kept was", res.Err, err)
+	}
+}
+
+// Ein Log welches die gelöschten ConfirmIDs aufzeichnet
+type recordingLog struct {
+	mutex   sync.Mutex
+	deleted []string
+}
+
+func (l *recordingLog) Put(confirmID string, item IPItem) error {
+	return nil
+}
+
+func (l *recordingLog) Delete(confirmID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.deleted = append(l.deleted, confirmID)
+	return nil
+}
+
+func (l *recordingLog) Close() error {
+	return nil
+}
+
+// Abgelaufene Angebote werden auch im Log gelöscht
+func Test_IPCache_LogExpired(t *testing.T) {
+	l := &recordingLog{}
+	c, err := NewIPCacheWithConfig(IPCacheConfig{
+		Subnet: SubnetSpec{
+			Sub:  24,
+			From: net.ParseIP(TestIP),
+			To:   net.ParseIP("192.168.0.20"),
+		},
+		TTL: 1,
+		Log: l,
+	})
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(c)
+
+	offer, err := c.Do(NextIPRequest, "")
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	time.Sleep(1100 * time.Millisecond)
+
+	res, err := c.Do(ReadIPRequest, offer.ConfirmID)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if res.Err != UnknownConfirmIDError {
+		t.Fatal("Expect", UnknownConfirmIDError, "was", res.Err)
+	}
+
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if len(l.deleted) != 1 || l.deleted[0] != offer.ConfirmID {
+		t.Fatal("Expect", offer.ConfirmID, "to be deleted was", l.deleted)
+	}
+}
+
+// Nach einem Neustart kennt der Server die vergebenen IPs
+func Test_NewStore_StateDir(t *testing.T) {
+	dir := t.TempDir()
+	config := StoreConfig{
+		Subnet: SubnetSpec{
+			Sub:  24,
+			From: net.ParseIP("192.168.0.1"),
+			To:   net.ParseIP("192.168.0.20"),
+		},
+		TTL:      30,
+		StateDir: dir,
+	}
+
+	store, err := NewStore(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	offer := doTestStore(t, store, NextIPRequest, "")
+	res := doTestStore(t, store, ConfirmIPRequest, offer.ConfirmID)
+	if res.Err != nil {
+		t.Fatal(res.Err.Error())
+	}
+	close(store.(IPCacheC))
+
+	store, err = NewStore(config)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	defer close(store.(IPCacheC))
+
+	res = doTestStore(t, store, ReadIPRequest, offer.ConfirmID)
+	if res.Err != nil || !res.IP.Equal(offer.IP) {
+		t.Fatal("Expect", offer.IP, "was", res)
+	}
+	next := doTestStore(t, store, NextIPRequest, "")
+	if next.IP.Equal(offer.IP) {
+		t.Fatal("Expect a new IP was", next.IP)
+	}
+}
+
+func Test_NewStore_StateDirNeedsCache(t *testing.T) {
+	_, err := NewStore(StoreConfig{
+		Memcached: "127.0.0.1",
+		StateDir:  t.TempDir(),
+	})
+	if err != StateDirNeedsCacheError {
+		t.Fatal("Expect", StateDirNeedsCacheError, "was", err)
+	}
+}